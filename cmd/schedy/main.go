@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ksamirdev/schedy/internal/api"
@@ -47,7 +48,8 @@ func main() {
 		return
 	}
 
-	// Terminal tasks are retained for history, then purged after this TTL.
+	// Succeeded and cancelled tasks are retained for history, then purged
+	// after this TTL.
 	historyTTL := 72 * time.Hour
 	if v := os.Getenv("SCHEDY_HISTORY_TTL"); v != "" {
 		d, err := time.ParseDuration(v)
@@ -58,7 +60,29 @@ func main() {
 		historyTTL = d
 	}
 
-	store, err := scheduler.NewBadgerStore(dataDir(), historyTTL)
+	// A finished task releases its Idempotency-Key unless told to hold it, so a
+	// create retried after delivery returns the original instead of re-running.
+	var storeOpts []scheduler.Option
+	if v := os.Getenv("SCHEDY_IDEMPOTENCY_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			slog.Error("invalid SCHEDY_IDEMPOTENCY_RETENTION", "value", v, "want", `a Go duration like "24h"`)
+			os.Exit(1)
+		}
+		storeOpts = append(storeOpts, scheduler.WithIdempotencyRetention(d))
+	}
+
+	// Failed tasks are dead letters, kept until redriven unless told otherwise.
+	if v := os.Getenv("SCHEDY_DEAD_LETTER_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			slog.Error("invalid SCHEDY_DEAD_LETTER_RETENTION", "value", v, "want", `a positive Go duration like "720h"`)
+			os.Exit(1)
+		}
+		storeOpts = append(storeOpts, scheduler.WithDeadLetterRetention(d))
+	}
+
+	store, err := scheduler.NewBadgerStore(dataDir(), historyTTL, storeOpts...)
 	if err != nil {
 		slog.Error("open store", "error", err)
 		os.Exit(1)
@@ -69,13 +93,38 @@ func main() {
 		slog.Error("recover running tasks", "error", err)
 	}
 
+	// The Ed25519 key is generated on first boot, into SCHEDY_ED25519_KEY_FILE
+	// if set (so it can be kept apart from the data), else into the store.
+	var edKey *scheduler.Ed25519Key
+	if path := os.Getenv("SCHEDY_ED25519_KEY_FILE"); path != "" {
+		edKey, err = scheduler.LoadEd25519KeyFile(path)
+	} else {
+		edKey, err = store.Ed25519Key()
+	}
+	if err != nil {
+		slog.Error("load ed25519 key", "error", err)
+		os.Exit(1)
+	}
+
 	exec := executor.NewExecutor()
+	exec.Keys = store.SigningKey
+	exec.Ed25519 = edKey
+	// New registers for the store's write notifications, so tasks fire at their
+	// due time; the interval is only the backstop poll.
 	r := runner.New(store, exec, 10*time.Second)
 	handler := api.New(store)
+	handler.KnownQueue = r.HasQueue
+	handler.Maintenance = r.Maintenance
+	handler.Deliveries = r
+	handler.Recount = store.Recount
+	handler.PublicKeys = func() []scheduler.JWK { return []scheduler.JWK{edKey.JWK()} }
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /healthz", handler.Health)
 	mux.HandleFunc("GET /readyz", handler.Ready)
+	// Unauthenticated, like the probes: receivers verify ed25519 signatures
+	// against these keys without holding an API key.
+	mux.HandleFunc("GET /.well-known/schedy-keys", handler.PublishedKeys)
 	// Behind the API key: queue depth and backlog are operational detail, and a
 	// Prometheus scrape config can carry the header.
 	mux.HandleFunc("GET /metrics", handler.WithAuth(handler.Metrics))
@@ -86,6 +135,16 @@ func main() {
 	mux.HandleFunc("POST /tasks/{id}/run", handler.WithAuth(handler.ReplayTask))
 	mux.HandleFunc("DELETE /tasks/{id}", handler.WithAuth(handler.DeleteTask))
 	mux.HandleFunc("DELETE /tasks", handler.WithAuth(handler.DeleteTasks))
+	mux.HandleFunc("GET /series/{id}", handler.WithAuth(handler.GetSeries))
+	mux.HandleFunc("DELETE /series/{id}", handler.WithAuth(handler.CancelSeries))
+	mux.HandleFunc("GET /dead-letters", handler.WithAuth(handler.ListDeadLetters))
+	mux.HandleFunc("POST /dead-letters/redrive", handler.WithAuth(handler.RedriveDeadLetters))
+	// Named signing keys. A secret is in the response that creates or
+	// rotates it, and nowhere after.
+	mux.HandleFunc("POST /admin/signing-keys", handler.WithAuth(handler.CreateSigningKey))
+	mux.HandleFunc("GET /admin/signing-keys", handler.WithAuth(handler.ListSigningKeys))
+	mux.HandleFunc("POST /admin/signing-keys/{id}/rotate", handler.WithAuth(handler.RotateSigningKey))
+	mux.HandleFunc("DELETE /admin/signing-keys/{id}", handler.WithAuth(handler.RetireSigningKey))
 	// Online snapshot of the whole store, behind the API key. Streamed, so a
 	// mid-stream failure can only truncate the download (logged), not corrupt
 	// anything; restore validates the file offline.
@@ -96,6 +155,22 @@ func main() {
 			slog.Error("backup", "error", err)
 		}
 	}))
+	mux.HandleFunc("POST /admin/recount", handler.WithAuth(handler.RecountTasks))
+
+	// Per-host circuit breakers: which hosts are failing, and a manual reset.
+	mux.HandleFunc("GET /admin/breakers", handler.WithAuth(handler.ListBreakers))
+	mux.HandleFunc("POST /admin/breakers/{host}/reset", handler.WithAuth(handler.ResetBreaker))
+
+	// Queues declared in SCHEDY_QUEUES, and pausing one without touching its
+	// tasks.
+	mux.HandleFunc("GET /queues", handler.WithAuth(handler.ListQueues))
+	mux.HandleFunc("POST /queues/{name}/pause", handler.WithAuth(handler.PauseQueue))
+	mux.HandleFunc("POST /queues/{name}/resume", handler.WithAuth(handler.ResumeQueue))
+
+	// Maintenance: stop delivering everything without taking task creation
+	// down with it.
+	mux.HandleFunc("POST /admin/pause", handler.WithAuth(handler.PauseDeliveries))
+	mux.HandleFunc("POST /admin/resume", handler.WithAuth(handler.ResumeDeliveries))
 
 	addr := ":" + *port
 	srv := &http.Server{Addr: addr, Handler: api.CORS(os.Getenv("SCHEDY_CORS_ORIGIN"), mux)}
@@ -103,6 +178,23 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	// SIGHUP re-reads the certificates and CA bundles SCHEDY_TLS names, so
+	// they can be rotated without a restart. Without SCHEDY_TLS it is left
+	// alone, so a SIGHUP still terminates the process as it always has.
+	if exec.HasTLS() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := exec.ReloadTLS(); err != nil {
+					slog.Error("reload tls", "error", err)
+					continue
+				}
+				slog.Info("reloaded tls settings")
+			}
+		}()
+	}
+
 	// Signal when the runner has returned - its drain of in-flight deliveries
 	// must finish before the store closes underneath them.
 	runnerDone := make(chan struct{})
@@ -120,6 +212,14 @@ func main() {
 		close(gcDone)
 	}()
 
+	// Bring the task counters back in line after history TTL purges, which
+	// happen inside Badger where no transaction can count them.
+	reconcileDone := make(chan struct{})
+	go func() {
+		store.RunReconcile(ctx, 5*time.Minute)
+		close(reconcileDone)
+	}()
+
 	go func() {
 		slog.Info("listening", "addr", addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -139,6 +239,7 @@ func main() {
 	cancel()
 	<-runnerDone
 	<-gcDone
+	<-reconcileDone
 	if err := store.Close(); err != nil {
 		slog.Error("close store", "error", err)
 	}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ListBreakers handles GET /admin/breakers: which hosts are failing.
+func (h *Handler) ListBreakers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"breakers": h.Deliveries.Breakers()})
+}
+
+// ResetBreaker handles POST /admin/breakers/{host}/reset, for when an
+// operator knows a host is back before its probe does.
+func (h *Handler) ResetBreaker(w http.ResponseWriter, r *http.Request) {
+	if !h.Deliveries.ResetBreaker(r.PathValue("host")) {
+		http.Error(w, "no breaker for host", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerHandlers(t *testing.T) {
+	reset := func(h *Handler, host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/breakers/"+host+"/reset", nil)
+		req.SetPathValue("host", host)
+		w := httptest.NewRecorder()
+		h.ResetBreaker(w, req)
+		return w
+	}
+	list := func(h *Handler) string {
+		w := httptest.NewRecorder()
+		h.ListBreakers(w, httptest.NewRequest(http.MethodGet, "/admin/breakers", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		return w.Body.String()
+	}
+
+	t.Run("list and reset", func(t *testing.T) {
+		retryAt := time.Date(2030, 1, 1, 12, 0, 30, 0, time.UTC)
+		h := withDeliveries(&fakeDeliveries{breakers: []scheduler.BreakerStatus{
+			{Host: "api.partner.com", State: scheduler.BreakerOpen, Failures: 5, RetryAt: &retryAt},
+			{Host: "hooks.example.com", State: scheduler.BreakerClosed, Failures: 2},
+		}})
+
+		assert.JSONEq(t, `{"breakers": [
+			{"host": "api.partner.com", "state": "open", "consecutive_failures": 5, "retry_at": "2030-01-01T12:00:30Z"},
+			{"host": "hooks.example.com", "state": "closed", "consecutive_failures": 2}
+		]}`, list(h))
+
+		assert.Equal(t, http.StatusNoContent, reset(h, "API.partner.com").Code)
+		assert.NotContains(t, list(h), "api.partner.com")
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		h := withDeliveries(&fakeDeliveries{})
+		assert.JSONEq(t, `{"breakers": []}`, list(h))
+
+		w := reset(h, "nowhere.example.com")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "no breaker for host")
+	})
+}
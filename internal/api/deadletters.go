@@ -0,0 +1,213 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/metrics"
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// Failed tasks are the dead-letter queue: work that ran out of retries (or was
+// too stale to try) and is still owed. They stay in the failed partition under
+// their own retention rather than the history TTL, and come back out through a
+// redrive.
+
+// deadLetterFilter selects dead letters, for listing and for redrive alike.
+type deadLetterFilter struct {
+	Queue      string `json:"queue"`       // queue name
+	URL        string `json:"url"`         // exact delivery url
+	Error      string `json:"error"`       // substring of the last attempt's error
+	StatusCode int    `json:"status_code"` // the last attempt's HTTP status
+}
+
+func (f deadLetterFilter) listFilter() scheduler.ListFilter {
+	return scheduler.ListFilter{
+		Status:     string(scheduler.StatusFailed),
+		Queue:      f.Queue,
+		URL:        f.URL,
+		Error:      f.Error,
+		StatusCode: f.StatusCode,
+	}
+}
+
+// validStatusCode accepts 0 (no filter) or an HTTP status.
+func validStatusCode(code int) bool {
+	return code == 0 || (code >= 100 && code <= 599)
+}
+
+// ListDeadLetters returns one page of failed tasks, optionally filtered by
+// ?queue=, exact ?url=, ?error= (a substring of the last attempt's error) and
+// ?status_code= (the last attempt's HTTP status; 0 for a transport error is
+// not filterable). Paged like ListTasks.
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit, ok := pageLimit(w, q)
+	if !ok {
+		return
+	}
+
+	filter := deadLetterFilter{Queue: q.Get("queue"), URL: q.Get("url"), Error: q.Get("error")}
+	if filter.Queue != "" && !scheduler.ValidQueueName(filter.Queue) {
+		http.Error(w, "invalid queue", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("status_code"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n == 0 || !validStatusCode(n) {
+			http.Error(w, "invalid status_code (100-599)", http.StatusBadRequest)
+			return
+		}
+		filter.StatusCode = n
+	}
+
+	h.writePage(w, filter.listFilter(), q.Get("cursor"), limit)
+}
+
+// redriveRequest selects dead letters to replay and how to replay them.
+type redriveRequest struct {
+	Filter deadLetterFilter `json:"filter"`
+	// Limit caps how many are redriven by this call (1-MaxPageSize, default
+	// MaxPageSize). A larger set is redriven by calling again.
+	Limit int `json:"limit"`
+	// Rate, if set, spaces the redriven tasks' execute_at at this many per
+	// second (minRedriveRate-maxRedriveRate) instead of making them all due
+	// at once.
+	Rate float64 `json:"rate"`
+	// Edit is applied to every redriven task on the way out.
+	Edit struct {
+		URL     string            `json:"url"`     // replaces the delivery url
+		Headers map[string]string `json:"headers"` // merged over the task's own
+	} `json:"edit"`
+}
+
+// A redrive rate is bounded so the spacing it gives is a sane duration: below
+// one per 1000s a page of redrives would be spread over weeks, and at the far
+// end of float64 1/rate overflows time.Duration altogether.
+const (
+	minRedriveRate = 0.001
+	maxRedriveRate = 1000
+)
+
+// redriveResult reports what a redrive did.
+type redriveResult struct {
+	Redriven int      `json:"redriven"`
+	IDs      []string `json:"ids"`
+	// HasMore is true when more dead letters matched than Limit allowed.
+	HasMore bool `json:"has_more"`
+}
+
+// RedriveDeadLetters replays every failed task matching the filter, up to the
+// limit: each is re-armed exactly as a single replay would be - same id,
+// attempts kept, a fresh retry budget - with the optional edits applied.
+//
+// The rate cap is enforced by scheduling rather than by sleeping: the set is
+// written at once with execute_at spaced 1/rate apart, and the runner delivers
+// it on that schedule. The request returns immediately, and a redrive of
+// thousands can't pin a handler for minutes. A rated redrive starts after the
+// last one scheduled by an earlier rated call, so paging through a large set
+// keeps to the rate instead of stacking each page on the one before.
+//
+// Each task moves with its own failed->pending transition, so a task cancelled,
+// deleted or replayed since it was listed is skipped rather than re-armed
+// twice; the response lists the ids that were actually redriven.
+func (h *Handler) RedriveDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var req redriveRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxTaskBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if req.Filter.Queue != "" && !scheduler.ValidQueueName(req.Filter.Queue) {
+		http.Error(w, "invalid filter.queue", http.StatusBadRequest)
+		return
+	}
+	if !validStatusCode(req.Filter.StatusCode) {
+		http.Error(w, "invalid filter.status_code (100-599)", http.StatusBadRequest)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = scheduler.MaxPageSize
+	}
+	if req.Limit < 1 || req.Limit > scheduler.MaxPageSize {
+		http.Error(w, fmt.Sprintf("invalid limit (1-%d)", scheduler.MaxPageSize), http.StatusBadRequest)
+		return
+	}
+	if req.Rate != 0 && !(req.Rate >= minRedriveRate && req.Rate <= maxRedriveRate) {
+		http.Error(w, fmt.Sprintf("invalid rate (%g-%d deliveries per second)", minRedriveRate, maxRedriveRate), http.StatusBadRequest)
+		return
+	}
+	if req.Edit.URL != "" {
+		u, err := url.Parse(req.Edit.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "invalid edit.url (absolute http(s) URL required)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tasks, next, err := h.Store.ListTasks(req.Filter.listFilter(), "", req.Limit)
+	if err != nil {
+		http.Error(w, "could not list dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	res := redriveResult{IDs: []string{}, HasMore: next != ""}
+	var spacing time.Duration
+	start := time.Now().UTC()
+	if req.Rate > 0 {
+		spacing = time.Duration(float64(time.Second) / req.Rate)
+		h.redriveMu.Lock()
+		defer h.redriveMu.Unlock()
+		if h.redriveNext.After(start) {
+			start = h.redriveNext
+		}
+		defer func() { h.redriveNext = start.Add(time.Duration(res.Redriven) * spacing) }()
+	}
+	for _, t := range tasks {
+		at := start.Add(time.Duration(res.Redriven) * spacing)
+		_, err := h.Store.Transition(t.ID, scheduler.StatusFailed, scheduler.StatusPending, func(task *scheduler.Task) error {
+			task.ExecuteAt = at
+			task.FinishedAt = nil
+			task.NextAttemptAt = nil
+			task.RetryCount = 0
+			task.RunStartedAt = nil
+			task.Replays++
+			dropPassedExpiry(task)
+			if req.Edit.URL != "" {
+				task.URL = req.Edit.URL
+			}
+			if len(req.Edit.Headers) > 0 {
+				headers := make(map[string]string, len(task.Headers)+len(req.Edit.Headers))
+				maps.Copy(headers, task.Headers)
+				maps.Copy(headers, req.Edit.Headers)
+				task.Headers = headers
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, scheduler.ErrNotFound), errors.Is(err, scheduler.ErrConflict):
+			continue // moved since it was listed: not ours to re-arm
+		case err != nil:
+			http.Error(w, "could not redrive dead letters", http.StatusInternalServerError)
+			return
+		}
+		metrics.ObserveReplay()
+		res.Redriven++
+		res.IDs = append(res.IDs, t.ID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
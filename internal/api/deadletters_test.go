@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedDeadLetters stores failed tasks whose last attempt ended with the given
+// status codes, ids dl0, dl1, ... in order.
+func seedDeadLetters(t *testing.T, store *mockStore, url string, codes ...int) {
+	t.Helper()
+	finished := time.Now().Add(-time.Hour)
+	for i, code := range codes {
+		require.NoError(t, store.Update(scheduler.Task{
+			ID:         fmt.Sprintf("dl%d", i),
+			URL:        url,
+			Method:     http.MethodPost,
+			Headers:    map[string]string{"Authorization": "Bearer old", "X-Trace": "keep"},
+			ExecuteAt:  time.Now().Add(-2 * time.Hour),
+			Status:     scheduler.StatusFailed,
+			Retries:    2,
+			RetryCount: 2,
+			Attempts:   []scheduler.Attempt{{N: 1, StatusCode: code, Error: "unexpected status code: " + http.StatusText(code)}},
+			FinishedAt: &finished,
+		}))
+	}
+}
+
+func TestListDeadLetters(t *testing.T) {
+	store := newMockStore()
+	handler := New(store)
+	seedDeadLetters(t, store, "http://example.com/a", 500, 503, 503)
+	require.NoError(t, store.Save(scheduler.Task{ID: "live", URL: "http://example.com/a", ExecuteAt: time.Now().Add(time.Hour)}))
+
+	list := func(t *testing.T, query string) (int, taskPage) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/dead-letters?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.ListDeadLetters(w, req)
+		var page taskPage
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		}
+		return w.Code, page
+	}
+
+	code, page := list(t, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, page.Tasks, 3, "only failed tasks are dead letters")
+
+	_, page = list(t, "status_code=503")
+	assert.Len(t, page.Tasks, 2)
+
+	_, page = list(t, "error=Internal")
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, "dl0", page.Tasks[0].ID)
+
+	_, page = list(t, "url=http://example.com/b")
+	assert.Empty(t, page.Tasks)
+
+	code, _ = list(t, "status_code=abc")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = list(t, "status_code=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = list(t, "limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRedriveDeadLetters(t *testing.T) {
+	redrive := func(t *testing.T, handler *Handler, body map[string]any) (int, redriveResult) {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/dead-letters/redrive", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handler.RedriveDeadLetters(w, req)
+		var res redriveResult
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	t.Run("re-arms the filtered set with a fresh budget", func(t *testing.T) {
+		store := newMockStore()
+		handler := New(store)
+		seedDeadLetters(t, store, "http://example.com/a", 500, 503, 503)
+
+		code, res := redrive(t, handler, map[string]any{"filter": map[string]any{"status_code": 503}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, res.Redriven)
+		assert.ElementsMatch(t, []string{"dl1", "dl2"}, res.IDs)
+		assert.False(t, res.HasMore)
+
+		got, _ := store.GetTask("dl1")
+		assert.Equal(t, scheduler.StatusPending, got.Status)
+		assert.Nil(t, got.FinishedAt)
+		assert.Zero(t, got.RetryCount)
+		assert.Len(t, got.Attempts, 1, "the attempts that failed are kept")
+		assert.Equal(t, "dl1_1", got.MessageID(), "a redrive is a new message to the receiver")
+		assert.WithinDuration(t, time.Now(), got.ExecuteAt, 5*time.Second)
+
+		untouched, _ := store.GetTask("dl0")
+		assert.Equal(t, scheduler.StatusFailed, untouched.Status)
+	})
+
+	t.Run("applies edits", func(t *testing.T) {
+		store := newMockStore()
+		handler := New(store)
+		seedDeadLetters(t, store, "http://old.example.com/a", 500)
+
+		code, _ := redrive(t, handler, map[string]any{
+			"edit": map[string]any{
+				"url":     "https://new.example.com/a",
+				"headers": map[string]string{"Authorization": "Bearer new"},
+			},
+		})
+		require.Equal(t, http.StatusOK, code)
+
+		got, _ := store.GetTask("dl0")
+		assert.Equal(t, "https://new.example.com/a", got.URL)
+		assert.Equal(t, map[string]string{"Authorization": "Bearer new", "X-Trace": "keep"}, got.Headers,
+			"edited headers are merged over the task's own")
+	})
+
+	t.Run("a rate spaces execute_at", func(t *testing.T) {
+		store := newMockStore()
+		handler := New(store)
+		seedDeadLetters(t, store, "http://example.com/a", 500, 500, 500)
+
+		code, res := redrive(t, handler, map[string]any{"rate": 2})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, res.IDs, 3)
+
+		var times []time.Time
+		for _, id := range res.IDs {
+			got, _ := store.GetTask(id)
+			times = append(times, got.ExecuteAt)
+		}
+		assert.Equal(t, 500*time.Millisecond, times[1].Sub(times[0]))
+		assert.Equal(t, 500*time.Millisecond, times[2].Sub(times[1]))
+	})
+
+	t.Run("a limit leaves the rest for the next call", func(t *testing.T) {
+		store := newMockStore()
+		handler := New(store)
+		seedDeadLetters(t, store, "http://example.com/a", 500, 500, 500)
+
+		code, res := redrive(t, handler, map[string]any{"limit": 2})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, res.Redriven)
+		assert.True(t, res.HasMore)
+
+		_, res = redrive(t, handler, map[string]any{"limit": 2})
+		assert.Equal(t, 1, res.Redriven)
+		assert.False(t, res.HasMore)
+	})
+
+	t.Run("rejects bad input", func(t *testing.T) {
+		handler := New(newMockStore())
+		for _, body := range []map[string]any{
+			{"rate": -1},
+			{"rate": 1e-300}, // 1/rate overflows a time.Duration
+			{"rate": 0.0001},
+			{"rate": 1001},
+			{"rate": 1e308},
+			{"limit": scheduler.MaxPageSize + 1},
+			{"filter": map[string]any{"status_code": 42}},
+			{"edit": map[string]any{"url": "not a url"}},
+		} {
+			code, _ := redrive(t, handler, body)
+			assert.Equal(t, http.StatusBadRequest, code, "%v", body)
+		}
+		// Past float64: JSON has no infinity, and this is the nearest to one.
+		w := httptest.NewRecorder()
+		handler.RedriveDeadLetters(w, httptest.NewRequest(http.MethodPost, "/dead-letters/redrive", strings.NewReader(`{"rate": 1e999}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("the rate holds across calls", func(t *testing.T) {
+		store := newMockStore()
+		handler := New(store)
+		seedDeadLetters(t, store, "http://example.com/a", 500, 500, 500, 500)
+
+		var times []time.Time
+		for range 2 {
+			code, res := redrive(t, handler, map[string]any{"rate": 10, "limit": 2})
+			require.Equal(t, http.StatusOK, code)
+			require.Len(t, res.IDs, 2)
+			for _, id := range res.IDs {
+				got, _ := store.GetTask(id)
+				times = append(times, got.ExecuteAt)
+			}
+		}
+		for i := 1; i < len(times); i++ {
+			assert.Equal(t, 100*time.Millisecond, times[i].Sub(times[i-1]), "the second page follows on from the first")
+		}
+
+		// A redrive without a rate isn't held back by one with.
+		seedDeadLetters(t, store, "http://example.com/b", 500)
+		code, _ := redrive(t, handler, map[string]any{"filter": map[string]any{"url": "http://example.com/b"}})
+		require.Equal(t, http.StatusOK, code)
+		got, _ := store.GetTask("dl0")
+		assert.WithinDuration(t, time.Now(), got.ExecuteAt, time.Second)
+	})
+}
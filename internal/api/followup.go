@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// validateFollowUp checks an on_success template the way decodeTaskRequest
+// checks a task, applying the same defaults, so a follow-up that could never
+// be created is refused now rather than dropped when its parent succeeds.
+// Nested follow-ups are checked too; errors name the field by its path
+// ("on_success.on_success.url").
+func (h *Handler) validateFollowUp(tpl *scheduler.TaskTemplate) error {
+	if tpl.Depth() > scheduler.MaxFollowUpDepth {
+		return fmt.Errorf("on_success nests too deeply (at most %d follow-ups)", scheduler.MaxFollowUpDepth)
+	}
+	for path := "on_success"; tpl != nil; path, tpl = path+".on_success", tpl.OnSuccess {
+		if err := h.validateTemplate(tpl); err != nil {
+			var fe *fieldError
+			if errors.As(err, &fe) {
+				fe.field = path + "." + fe.field
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTemplate checks a single template, leaving its OnSuccess alone.
+func (h *Handler) validateTemplate(tpl *scheduler.TaskTemplate) error {
+	if err := h.validateSpec(&tpl.TaskSpec); err != nil {
+		return err
+	}
+	if tpl.Delay != "" {
+		if d, err := time.ParseDuration(tpl.Delay); err != nil || d < 0 {
+			return invalidField("delay", `invalid %s (Go duration like "5m" required)`)
+		}
+	}
+	return nil
+}
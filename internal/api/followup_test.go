@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWithFollowUp(t *testing.T) {
+	create := func(t *testing.T, handler *Handler, onSuccess any) *httptest.ResponseRecorder {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{
+			"url":        "http://example.com/a",
+			"execute_in": "1h",
+			"on_success": onSuccess,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handler.CreateTask(w, req)
+		return w
+	}
+
+	t.Run("stores the template with defaults applied", func(t *testing.T) {
+		store := newMockStore()
+		w := create(t, New(store), map[string]any{
+			"url":     "http://example.com/b",
+			"method":  "put",
+			"payload": map[string]any{"step": "b"},
+			"delay":   "10m",
+			"on_success": map[string]any{
+				"url": "http://example.com/c",
+			},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var task scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+
+		tpl := task.OnSuccess
+		require.NotNil(t, tpl)
+		assert.Equal(t, http.MethodPut, tpl.Method)
+		assert.Equal(t, "10m", tpl.Delay)
+		assert.Equal(t, scheduler.DefaultQueue, tpl.Queue)
+		assert.Equal(t, scheduler.RetryFixed, tpl.RetryMode)
+		require.NotNil(t, tpl.RetryInterval)
+		assert.Equal(t, DEFAULT_RETRY_INTERVAL, *tpl.RetryInterval)
+		require.NotNil(t, tpl.OnSuccess, "nested follow-ups are kept")
+		assert.Equal(t, http.MethodPost, tpl.OnSuccess.Method, "nested templates get the defaults too")
+
+		stored, _ := store.GetTask(task.ID)
+		require.NotNil(t, stored)
+		assert.Equal(t, tpl, stored.OnSuccess)
+	})
+
+	t.Run("rejects an invalid template", func(t *testing.T) {
+		handler := New(newMockStore())
+		handler.KnownQueue = func(name string) bool { return name == scheduler.DefaultQueue }
+		for _, tc := range []struct {
+			tpl  map[string]any
+			want string
+		}{
+			{map[string]any{}, "on_success.url is required"},
+			{map[string]any{"url": "http://example.com/b", "method": "BREW"}, "on_success.method"},
+			{map[string]any{"url": "http://example.com/b", "delay": "-1m"}, "on_success.delay"},
+			{map[string]any{"url": "http://example.com/b", "delay": "soon"}, "on_success.delay"},
+			{map[string]any{"url": "http://example.com/b", "retry_mode": "random"}, "on_success.retry_mode"},
+			{map[string]any{"url": "http://example.com/b", "on_failure_url": "/hook"}, "on_success.on_failure_url"},
+			{map[string]any{"url": "http://example.com/b", "queue": "billing"}, "on_success.queue"},
+			{map[string]any{"url": "http://example.com/b", "priority": 10}, "on_success.priority"},
+			{map[string]any{"url": "http://example.com/b", "jitter": "0s"}, "on_success.jitter"},
+			{map[string]any{"url": "http://example.com/b", "on_success": map[string]any{"method": "GET"}}, "on_success.on_success.url"},
+		} {
+			w := create(t, handler, tc.tpl)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%v", tc.tpl)
+			assert.Contains(t, w.Body.String(), tc.want)
+		}
+	})
+
+	t.Run("bounds the nesting", func(t *testing.T) {
+		var tpl map[string]any
+		for range scheduler.MaxFollowUpDepth + 1 {
+			tpl = map[string]any{"url": "http://example.com/b", "on_success": tpl}
+		}
+		w := create(t, New(newMockStore()), tpl)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "on_success nests too deeply"), w.Body.String())
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/ksamirdev/schedy/internal/metrics"
@@ -40,10 +41,30 @@ var validMethods = map[string]bool{
 type Handler struct {
 	Store  scheduler.Store
 	APIKey string
-	// createMu serializes the findDuplicate + Save pair so two concurrent
+	// KnownQueue reports whether a queue is declared; a task naming any
+	// other is rejected. Nil accepts every valid queue name.
+	KnownQueue func(name string) bool
+	// Maintenance reports the pause of every delivery, nil while delivering,
+	// for the health endpoints. Nil reports deliveries as running.
+	Maintenance func() *scheduler.Maintenance
+	// PublicKeys returns the public keys ed25519 signatures verify against,
+	// for /.well-known/schedy-keys. Nil publishes none.
+	PublicKeys func() []scheduler.JWK
+	// Deliveries backs the queue, maintenance and circuit-breaker endpoints.
+	Deliveries Deliveries
+	// Recount corrects the task counters from a full scan and returns the
+	// drift it found, for POST /admin/recount.
+	Recount func() (map[scheduler.TaskStatus]int, error)
+	// createMu serializes the FindDuplicate + Save pair so two concurrent
 	// creates carrying the same Idempotency-Key can't both miss the duplicate
-	// check and both persist. Schedy is single-process, so one mutex is enough.
+	// check and both persist. Schedy is single-process, so one mutex is enough,
+	// and the check is an index lookup, so holding it is cheap.
 	createMu sync.Mutex
+	// redriveNext is when the next task of a rated dead-letter redrive may
+	// be due: the slot after the last one an earlier rated redrive took.
+	// In memory, so it starts afresh on restart. Guarded by redriveMu.
+	redriveMu   sync.Mutex
+	redriveNext time.Time
 }
 
 func New(store scheduler.Store) *Handler {
@@ -76,24 +97,29 @@ func (h *Handler) WithAuth(next http.HandlerFunc) http.HandlerFunc {
 // taskRequest is the client-owned shape of a task, shared by create and update.
 // Server-owned state (id, status, attempts, finished_at) is deliberately absent.
 type taskRequest struct {
-	URL           string              `json:"url"`
-	Method        string              `json:"method"` // HTTP verb, defaults to POST
-	Headers       map[string]string   `json:"headers"`
-	Payload       any                 `json:"payload"`
-	ExecuteAt     string              `json:"execute_at"` // RFC3339; exactly one of execute_at / execute_in
-	ExecuteIn     string              `json:"execute_in"` // positive Go duration ("5m") relative to now
-	Retries       int                 `json:"retries"`
-	RetryInterval *int                `json:"retry_interval"` // milliseconds
-	RetryMode     scheduler.RetryMode `json:"retry_mode"`     // fixed (default) or exponential
-	Schedule      string              `json:"schedule"`       // optional Go duration ("15m"); recurring re-enqueue
-	TimeoutMs     int                 `json:"timeout_ms"`     // per-attempt delivery timeout; 0 = server default
-	OnFailureURL  string              `json:"on_failure_url"` // per-task failure callback, overrides SCHEDY_ON_FAILURE_URL
+	scheduler.TaskSpec
+	ExecuteAt    string                 `json:"execute_at"`    // RFC3339; exactly one of execute_at / execute_in
+	ExecuteIn    string                 `json:"execute_in"`    // positive Go duration ("5m") relative to now
+	Schedule     string                 `json:"schedule"`      // optional recurrence: a Go duration ("15m"), or a calendar spec
+	ScheduleType scheduler.ScheduleType `json:"schedule_type"` // interval (default) or calendar
+	Timezone     string                 `json:"timezone"`      // calendar only: IANA zone, defaults to UTC
+	CatchUp      scheduler.CatchUp      `json:"catch_up"`      // recurring only: once (default), skip or all
+	MaxRuns      int                    `json:"max_runs"`      // recurring only: last run number; 0 = unbounded
+	Until        string                 `json:"until"`         // recurring only: RFC3339; no run due after this
+	ExpireAt     string                 `json:"expire_at"`     // RFC3339; not delivered after this
+
+	expireAt *time.Time    // ExpireAt, parsed by decodeTaskRequest
+	until    *time.Time    // Until, parsed by decodeTaskRequest
+	jitter   time.Duration // Jitter, parsed by decodeTaskRequest
 }
 
+// maxDestination bounds a task's destination key. It names a limit, not data.
+const maxDestination = 255
+
 // decodeTaskRequest reads and validates a task body, applying defaults for the
 // optional fields. It writes the error response itself; the bool reports
 // whether the caller may continue.
-func decodeTaskRequest(w http.ResponseWriter, r *http.Request) (taskRequest, time.Time, bool) {
+func (h *Handler) decodeTaskRequest(w http.ResponseWriter, r *http.Request) (taskRequest, time.Time, bool) {
 	var req taskRequest
 	r.Body = http.MaxBytesReader(w, r.Body, maxTaskBody)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -105,29 +131,24 @@ func decodeTaskRequest(w http.ResponseWriter, r *http.Request) (taskRequest, tim
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return req, time.Time{}, false
 	}
-	if req.URL == "" {
-		http.Error(w, "url is required", http.StatusBadRequest)
-		return req, time.Time{}, false
-	}
-	if req.Method == "" {
-		req.Method = http.MethodPost
-	}
-	req.Method = strings.ToUpper(req.Method)
-	if !validMethods[req.Method] {
-		http.Error(w, "invalid method", http.StatusBadRequest)
+	if err := h.validateSpec(&req.TaskSpec); err != nil {
+		specError(w, err)
 		return req, time.Time{}, false
 	}
 	// The fire time comes from exactly one of execute_at (absolute RFC3339) or
 	// execute_in (a positive Go duration relative to now). Both at once is
-	// ambiguous, so it's rejected rather than silently picking one.
+	// ambiguous, so it's rejected rather than silently picking one. A calendar
+	// schedule may give neither and start at its next time.
 	var t time.Time
 	switch {
 	case req.ExecuteAt != "" && req.ExecuteIn != "":
 		http.Error(w, "provide execute_at or execute_in, not both", http.StatusBadRequest)
 		return req, time.Time{}, false
 	case req.ExecuteAt == "" && req.ExecuteIn == "":
-		http.Error(w, "execute_at or execute_in is required", http.StatusBadRequest)
-		return req, time.Time{}, false
+		if req.ScheduleType != scheduler.ScheduleCalendar {
+			http.Error(w, "execute_at or execute_in is required", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
 	case req.ExecuteIn != "":
 		d, err := time.ParseDuration(req.ExecuteIn)
 		if err != nil || d <= 0 {
@@ -147,47 +168,210 @@ func decodeTaskRequest(w http.ResponseWriter, r *http.Request) (taskRequest, tim
 			return req, time.Time{}, false
 		}
 	}
-	if req.RetryInterval == nil {
-		req.RetryInterval = new(int)
-		*req.RetryInterval = DEFAULT_RETRY_INTERVAL
+	// Recurrence is a plain Go duration or a restricted calendar, never cron:
+	// neither parser accepts a cron expression.
+	if req.Schedule == "" && (req.ScheduleType != "" || req.Timezone != "" || req.CatchUp != "") {
+		http.Error(w, "schedule_type, timezone and catch_up require schedule", http.StatusBadRequest)
+		return req, time.Time{}, false
+	}
+	if !req.CatchUp.Valid() {
+		http.Error(w, "invalid catch_up (once, skip or all)", http.StatusBadRequest)
+		return req, time.Time{}, false
+	}
+	if req.Schedule != "" {
+		if req.ScheduleType == "" {
+			req.ScheduleType = scheduler.ScheduleInterval
+		}
+		if req.CatchUp == "" {
+			req.CatchUp = scheduler.CatchUpOnce
+		}
+		if req.ScheduleType == scheduler.ScheduleCalendar && req.Timezone == "" {
+			req.Timezone = "UTC"
+		}
+		rec, err := scheduler.ParseSchedule(req.ScheduleType, req.Schedule, req.Timezone)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid schedule (%v)", err), http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		if t.IsZero() {
+			next, ok := rec.Next(time.Now().UTC())
+			if !ok {
+				http.Error(w, "invalid schedule (it never fires)", http.StatusBadRequest)
+				return req, time.Time{}, false
+			}
+			t = next
+		}
 	}
-	if req.RetryMode == "" {
-		req.RetryMode = scheduler.RetryFixed
+	if req.MaxRuns < 0 {
+		http.Error(w, "invalid max_runs (0 or more)", http.StatusBadRequest)
+		return req, time.Time{}, false
 	}
-	if !req.RetryMode.Valid() {
-		http.Error(w, "invalid retry_mode", http.StatusBadRequest)
+	if (req.MaxRuns != 0 || req.Until != "") && req.Schedule == "" {
+		http.Error(w, "max_runs and until require schedule", http.StatusBadRequest)
 		return req, time.Time{}, false
 	}
-	if req.TimeoutMs < 0 || req.TimeoutMs > scheduler.MaxTimeoutMs {
-		http.Error(w, fmt.Sprintf("invalid timeout_ms (0-%d)", scheduler.MaxTimeoutMs), http.StatusBadRequest)
+	if req.Until != "" {
+		until, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil {
+			http.Error(w, "invalid until (ISO required)", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		if until.Before(t) {
+			http.Error(w, "until must not be before the execution time", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		until = until.UTC()
+		req.until = &until
+	}
+	req.jitter, _ = time.ParseDuration(req.Jitter) // checked by validateSpec
+	// A deadline at or before the fire time would retire the task unfired, so
+	// it is a mistake, not a request. An absolute expire_at means nothing to
+	// the runs of a recurring task after the first; max_lateness is relative,
+	// so it carries over.
+	if req.ExpireAt != "" {
+		at, err := time.Parse(time.RFC3339, req.ExpireAt)
+		if err != nil {
+			http.Error(w, "invalid expire_at (ISO required)", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		if !at.After(t.Add(req.jitter)) {
+			http.Error(w, "expire_at must be after the execution time plus any jitter", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		if req.Schedule != "" {
+			http.Error(w, "expire_at can't be combined with schedule (use max_lateness)", http.StatusBadRequest)
+			return req, time.Time{}, false
+		}
+		at = at.UTC()
+		req.expireAt = &at
+	}
+	if err := h.validateFollowUp(req.OnSuccess); err != nil {
+		specError(w, err)
 		return req, time.Time{}, false
 	}
+	return req, t, true
+}
+
+// fieldError is a task field that failed validation. Its format takes the
+// field's name as its first verb, so a follow-up's error can name the field by
+// its path instead ("on_success.url is required").
+type fieldError struct {
+	field  string
+	format string
+	args   []any
+	// unchecked means the field couldn't be checked - the store failed - not
+	// that it is wrong.
+	unchecked bool
+}
+
+func invalidField(field, format string, args ...any) *fieldError {
+	return &fieldError{field: field, format: format, args: args}
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf(e.format, append([]any{e.field}, e.args...)...)
+}
+
+// specError writes the response for a validateSpec or validateFollowUp error.
+func specError(w http.ResponseWriter, err error) {
+	var fe *fieldError
+	if errors.As(err, &fe) && fe.unchecked {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// validateSpec checks the delivery fields a task and a follow-up template
+// share, applying the defaults for the optional ones. It leaves OnSuccess to
+// validateFollowUp.
+func (h *Handler) validateSpec(spec *scheduler.TaskSpec) error {
+	if spec.URL == "" {
+		return invalidField("url", "%s is required")
+	}
+	if spec.Method == "" {
+		spec.Method = http.MethodPost
+	}
+	spec.Method = strings.ToUpper(spec.Method)
+	if !validMethods[spec.Method] {
+		return invalidField("method", "invalid %s")
+	}
+	if spec.RetryInterval == nil {
+		spec.RetryInterval = new(int)
+		*spec.RetryInterval = DEFAULT_RETRY_INTERVAL
+	}
+	if spec.RetryMode == "" {
+		spec.RetryMode = scheduler.RetryFixed
+	}
+	if !spec.RetryMode.Valid() {
+		return invalidField("retry_mode", "invalid %s")
+	}
+	if spec.TimeoutMs < 0 || spec.TimeoutMs > scheduler.MaxTimeoutMs {
+		return invalidField("timeout_ms", "invalid %s (0-%d)", scheduler.MaxTimeoutMs)
+	}
 	// The callback must be an absolute http(s) URL: a garbage value would only
 	// surface as a silently dropped callback long after the create succeeded.
-	if req.OnFailureURL != "" {
-		u, err := url.Parse(req.OnFailureURL)
+	if spec.OnFailureURL != "" {
+		u, err := url.Parse(spec.OnFailureURL)
 		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
-			http.Error(w, "invalid on_failure_url (absolute http(s) URL required)", http.StatusBadRequest)
-			return req, time.Time{}, false
+			return invalidField("on_failure_url", "invalid %s (absolute http(s) URL required)")
 		}
 	}
-	// Interval-only recurrence: a plain Go duration, never cron. ParseDuration
-	// rejects cron expressions and calendar syntax for free.
-	if req.Schedule != "" {
-		if d, err := time.ParseDuration(req.Schedule); err != nil || d <= 0 {
-			http.Error(w, `invalid schedule (positive Go duration like "15m" required)`, http.StatusBadRequest)
-			return req, time.Time{}, false
+	if len(spec.Destination) > maxDestination || strings.ContainsFunc(spec.Destination, unicode.IsSpace) {
+		return invalidField("destination", "invalid %s (up to %d characters, no spaces)", maxDestination)
+	}
+	if spec.Queue == "" {
+		spec.Queue = scheduler.DefaultQueue
+	}
+	if !scheduler.ValidQueueName(spec.Queue) {
+		return invalidField("queue", "invalid %s (lowercase letters, digits, '-' and '_')")
+	}
+	if h.KnownQueue != nil && !h.KnownQueue(spec.Queue) {
+		return invalidField("queue", "unknown %s (not declared in SCHEDY_QUEUES)")
+	}
+	if !scheduler.ValidPriority(spec.Priority) {
+		return invalidField("priority", "invalid %s (%d-%d)", scheduler.MinPriority, scheduler.MaxPriority)
+	}
+	if spec.Jitter != "" {
+		if d, err := time.ParseDuration(spec.Jitter); err != nil || d <= 0 {
+			return invalidField("jitter", `invalid %s (positive Go duration like "5m" required)`)
 		}
 	}
-	return req, t, true
+	if spec.MaxLateness != "" {
+		if d, err := time.ParseDuration(spec.MaxLateness); err != nil || d <= 0 {
+			return invalidField("max_lateness", `invalid %s (positive Go duration like "5m" required)`)
+		}
+	}
+	// Checked now, so a bad reference is a 400 rather than a body sent with
+	// the reference left in it at every attempt.
+	if spec.PayloadTemplate {
+		if err := scheduler.CheckPayloadTemplate(spec.URL, spec.Headers, spec.Payload); err != nil {
+			return invalidField("payload_template", "invalid %s (%v)", err)
+		}
+	}
+	if spec.SigningScheme != "" && !spec.SigningScheme.Valid() {
+		return invalidField("signing_scheme", "invalid %s (schedy, standard-webhooks or ed25519)")
+	}
+	if spec.SigningScheme == scheduler.SchemeEd25519 && spec.SigningKeyID != "" {
+		return invalidField("signing_key_id", "%s is for HMAC schemes, not ed25519")
+	}
+	if spec.SigningKeyID != "" {
+		key, err := h.Store.SigningKey(spec.SigningKeyID)
+		if err != nil {
+			return &fieldError{field: "signing_key_id", format: "could not check %s", unchecked: true}
+		}
+		if key == nil {
+			return invalidField("signing_key_id", "unknown %s")
+		}
+	}
+	return nil
 }
 
 // loadTask resolves the {id} path value to a stored task. It writes the error
 // response itself; the bool reports whether the caller may continue.
 func (h *Handler) loadTask(w http.ResponseWriter, r *http.Request) (*scheduler.Task, bool) {
-	id := r.PathValue("id")
-	if id == "" {
-		http.Error(w, "missing task id", http.StatusBadRequest)
+	id, ok := taskID(w, r)
+	if !ok {
 		return nil, false
 	}
 
@@ -203,84 +387,50 @@ func (h *Handler) loadTask(w http.ResponseWriter, r *http.Request) (*scheduler.T
 	return task, true
 }
 
-// findDuplicate returns the pending task a create request would duplicate, or
-// nil if there is none.
-//
-// An Idempotency-Key matches on the key alone: the key is the caller's name for
-// the task, so a repeat of a request that has already been accepted returns the
-// task it created, whatever the new body says. Without a key, an identical
-// schedule - same url, same execute_at to within a second - is what counts as a
-// repeat.
-//
-// Only pending tasks are considered. A task that has already run is history
-// rather than a live schedule, and history expires under SCHEDY_HISTORY_TTL,
-// which would otherwise make deduplication quietly depend on retention.
-//
-// ponytail: pages the whole pending partition on every create - O(pending) per
-// request. Add an idempotency-key index if create throughput makes it hot.
-func (h *Handler) findDuplicate(key, url string, executeAt time.Time) (*scheduler.Task, error) {
-	// Without an idempotency key the duplicate is same-url by definition, so let
-	// the store skip every other URL instead of paging them all back here.
-	filter := scheduler.ListFilter{Status: string(scheduler.StatusPending)}
-	if key == "" {
-		filter.URL = url
-	}
-	for cursor := ""; ; {
-		pending, next, err := h.Store.ListTasks(filter, cursor, scheduler.MaxPageSize)
-		if err != nil {
-			return nil, err
-		}
-		for i := range pending {
-			task := &pending[i]
-			if key != "" {
-				if task.IdempotencyKey == key {
-					return task, nil
-				}
-				continue
-			}
-			if task.URL == url && task.ExecuteAt.Sub(executeAt).Abs() < time.Second {
-				return task, nil
-			}
-		}
-		if next == "" {
-			return nil, nil
-		}
-		cursor = next
-	}
-}
-
 // CreateTask schedules a new task for a future time.
 func (h *Handler) CreateTask(w http.ResponseWriter, r *http.Request) {
-	req, t, ok := decodeTaskRequest(w, r)
+	req, t, ok := h.decodeTaskRequest(w, r)
 	if !ok {
 		return
 	}
 
 	idempotencyKey := r.Header.Get("Idempotency-Key")
 
+	id := uuid.NewString()
 	task := scheduler.Task{
-		ID:             uuid.NewString(),
+		ID:             id,
 		IdempotencyKey: idempotencyKey,
-		URL:            req.URL,
-		Method:         req.Method,
-		Headers:        req.Headers,
-		Payload:        req.Payload,
 		ExecuteAt:      t,
-		Retries:        req.Retries,
-		RetryInterval:  *req.RetryInterval,
-		RetryMode:      req.RetryMode,
-		TimeoutMs:      req.TimeoutMs,
-		OnFailureURL:   req.OnFailureURL,
 		Schedule:       req.Schedule,
+		ScheduleType:   req.ScheduleType,
+		Timezone:       req.Timezone,
+		CatchUp:        req.CatchUp,
+		MaxRuns:        req.MaxRuns,
+		Until:          req.until,
+		ExpireAt:       req.expireAt,
 		Status:         scheduler.StatusPending,
 	}
+	req.Apply(&task)
+	if req.Schedule != "" {
+		task.SeriesID = id
+		task.RunNumber = 1
+		task.Anchor = &t
+	}
+	// The offset is drawn from the id, so it can only be applied now. t stays
+	// the requested time: that is what a repeat of this create is matched on.
+	task.ExecuteAt = t.Add(task.JitterOffset())
 
-	// findDuplicate scans then Save writes; without serialization two same-key
-	// creates can both miss the scan and both persist, defeating idempotency.
+	// FindDuplicate reads then Save writes; without serialization two same-key
+	// creates can both miss the lookup and both persist, defeating idempotency.
 	// Unlock before the response encode so a slow client can't stall every
 	// other create.
+	//
+	// An Idempotency-Key matches on the key alone: the key is the caller's name
+	// for the task, so a repeat of an accepted request returns the task it
+	// created, whatever the new body says. Without a key, an identical schedule
+	// (same url, same execute_at) is what counts as a repeat.
 	h.createMu.Lock()
-	existing, err := h.findDuplicate(idempotencyKey, req.URL, t)
+	existing, err := h.Store.FindDuplicate(idempotencyKey, req.URL, t)
 	if err == nil && existing == nil {
 		err = h.Store.Save(task)
 	}
@@ -304,38 +454,52 @@ func (h *Handler) CreateTask(w http.ResponseWriter, r *http.Request) {
 // UpdateTask replaces a pending task's client-owned fields, keeping its id.
 // Only pending tasks are mutable; anything else is a conflict.
 func (h *Handler) UpdateTask(w http.ResponseWriter, r *http.Request) {
-	req, execAt, ok := decodeTaskRequest(w, r)
+	req, execAt, ok := h.decodeTaskRequest(w, r)
 	if !ok {
 		return
 	}
 
-	task, ok := h.loadTask(w, r)
+	id, ok := taskID(w, r)
 	if !ok {
 		return
 	}
-	if task.Status != scheduler.StatusPending {
-		http.Error(w, "only pending tasks can be updated", http.StatusConflict)
-		return
-	}
 
 	// Full replace, but of the client-owned fields only. Status, attempts and
 	// finished_at stay put: a task re-queued after a crash is pending with
 	// attempts already logged, and that delivery record is not the client's to
-	// overwrite.
-	task.URL = req.URL
-	task.Method = req.Method
-	task.Headers = req.Headers
-	task.Payload = req.Payload
-	task.ExecuteAt = execAt
-	task.Retries = req.Retries
-	task.RetryInterval = *req.RetryInterval
-	task.RetryMode = req.RetryMode
-	task.TimeoutMs = req.TimeoutMs
-	task.OnFailureURL = req.OnFailureURL
-	task.Schedule = req.Schedule
-
-	if err := h.Store.Update(*task); err != nil {
-		http.Error(w, "could not update task", http.StatusInternalServerError)
+	// overwrite. A pending->pending transition, so a task the runner claims
+	// (or a cancel lands on) first is a conflict rather than an edit that
+	// silently never takes effect.
+	//
+	// A task waiting to retry is rescheduled by an update, not edited in
+	// place: it fires at the new execute_at with its retry budget restored,
+	// rather than keeping a retry time computed for the old settings.
+	task, err := h.Store.Transition(id, scheduler.StatusPending, scheduler.StatusPending, func(task *scheduler.Task) error {
+		req.Apply(task)
+		task.Schedule = req.Schedule
+		task.ScheduleType = req.ScheduleType
+		task.Timezone = req.Timezone
+		task.CatchUp = req.CatchUp
+		task.MaxRuns = req.MaxRuns
+		task.Until = req.until
+		task.Anchor = nil
+		if task.Schedule != "" {
+			// The series keeps to the phase of the time it was last set to.
+			task.Anchor = &execAt
+			if task.SeriesID == "" {
+				// Made recurring by this update: the chain starts here.
+				task.SeriesID = task.ID
+				task.RunNumber = 1
+			}
+		}
+		task.ExpireAt = req.expireAt
+		task.ExecuteAt = execAt.Add(task.JitterOffset()) // execAt stays the requested time
+		task.NextAttemptAt = nil
+		task.RetryCount = 0
+		task.RunStartedAt = nil
+		return nil
+	})
+	if !transitioned(w, err, "only pending tasks can be updated", "could not update task") {
 		return
 	}
 
@@ -343,6 +507,34 @@ func (h *Handler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(task)
 }
 
+// taskID reads the {id} path value. It writes the error response itself; the
+// bool reports whether the caller may continue.
+func taskID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "missing task id", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+// transitioned maps a Store.Transition error to a response: 404 for a task
+// that is gone, 409 with conflictMsg for one whose status moved under the
+// request, 500 with failMsg otherwise. It reports whether err was nil.
+func transitioned(w http.ResponseWriter, err error, conflictMsg, failMsg string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, scheduler.ErrNotFound):
+		http.Error(w, "task not found", http.StatusNotFound)
+	case errors.Is(err, scheduler.ErrConflict):
+		http.Error(w, conflictMsg, http.StatusConflict)
+	default:
+		http.Error(w, failMsg, http.StatusInternalServerError)
+	}
+	return false
+}
+
 // taskPage is one page of a task listing. The listing is an envelope rather than
 // a bare array so a client can tell a full store from an exhausted one.
 type taskPage struct {
@@ -372,12 +564,19 @@ func (h *Handler) ReplayTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	task.Status = scheduler.StatusPending
-	task.ExecuteAt = time.Now().UTC()
-	task.FinishedAt = nil
-
-	if err := h.Store.Update(*task); err != nil {
-		http.Error(w, "could not replay task", http.StatusInternalServerError)
+	// Transition from the status just read, so two concurrent replays (or a
+	// replay racing a bulk delete) can't both re-arm the task.
+	task, err := h.Store.Transition(task.ID, task.Status, scheduler.StatusPending, func(task *scheduler.Task) error {
+		task.ExecuteAt = time.Now().UTC()
+		task.FinishedAt = nil
+		task.NextAttemptAt = nil
+		task.RetryCount = 0
+		task.RunStartedAt = nil
+		task.Replays++
+		dropPassedExpiry(task)
+		return nil
+	})
+	if !transitioned(w, err, "only finished tasks can be replayed", "could not replay task") {
 		return
 	}
 	metrics.ObserveReplay()
@@ -386,8 +585,18 @@ func (h *Handler) ReplayTask(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(task)
 }
 
+// dropPassedExpiry clears an expire_at a re-armed task is already past. A
+// replay is an explicit ask to deliver now; keeping the deadline would only
+// retire the task again unfired. max_lateness needs nothing: it runs from the
+// new execute_at.
+func dropPassedExpiry(task *scheduler.Task) {
+	if task.ExpireAt != nil && !task.ExpireAt.After(task.ExecuteAt) {
+		task.ExpireAt = nil
+	}
+}
+
 // ListTasks returns one page of scheduled tasks, optionally filtered by
-// ?status=, exact ?url=, and the ?due_before=/?due_after= time window
+// ?status=, ?queue=, ?priority=, exact ?url=, and the ?due_before=/?due_after= time window
 // (RFC3339, strict bounds on execute_at). Paging is by ?cursor= (opaque, from
 // next_cursor) and ?limit=.
 func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
@@ -399,17 +608,26 @@ func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 0 // store applies the default
-	if raw := q.Get("limit"); raw != "" {
-		n, err := strconv.Atoi(raw)
-		if err != nil || n < 1 || n > scheduler.MaxPageSize {
-			http.Error(w, fmt.Sprintf("invalid limit (1-%d)", scheduler.MaxPageSize), http.StatusBadRequest)
+	queue := q.Get("queue")
+	if queue != "" && !scheduler.ValidQueueName(queue) {
+		http.Error(w, "invalid queue", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := pageLimit(w, q)
+	if !ok {
+		return
+	}
+
+	filter := scheduler.ListFilter{Status: status, Queue: queue, URL: q.Get("url")}
+	if v := q.Get("priority"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || !scheduler.ValidPriority(p) {
+			http.Error(w, fmt.Sprintf("invalid priority (%d-%d)", scheduler.MinPriority, scheduler.MaxPriority), http.StatusBadRequest)
 			return
 		}
-		limit = n
+		filter.Priority = &p
 	}
-
-	filter := scheduler.ListFilter{Status: status, URL: q.Get("url")}
 	if v := q.Get("due_before"); v != "" {
 		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
@@ -427,7 +645,28 @@ func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
 		filter.DueAfter = &t
 	}
 
-	tasks, next, err := h.Store.ListTasks(filter, q.Get("cursor"), limit)
+	h.writePage(w, filter, q.Get("cursor"), limit)
+}
+
+// pageLimit reads ?limit=, 0 when absent so the store applies its default. It
+// writes the error response itself; the bool reports whether the caller may
+// continue.
+func pageLimit(w http.ResponseWriter, q url.Values) (int, bool) {
+	raw := q.Get("limit")
+	if raw == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > scheduler.MaxPageSize {
+		http.Error(w, fmt.Sprintf("invalid limit (1-%d)", scheduler.MaxPageSize), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// writePage lists one page of tasks matching filter as a taskPage response.
+func (h *Handler) writePage(w http.ResponseWriter, filter scheduler.ListFilter, cursor string, limit int) {
+	tasks, next, err := h.Store.ListTasks(filter, cursor, limit)
 	if errors.Is(err, scheduler.ErrInvalidCursor) {
 		http.Error(w, "invalid cursor", http.StatusBadRequest)
 		return
@@ -444,20 +683,50 @@ func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(taskPage{Tasks: tasks, NextCursor: next, HasMore: next != ""})
 }
 
-// GetTask returns a single task by ID
+// Bounds for GET /tasks/{id}?next=, how many upcoming runs of a recurring
+// task to project.
+const (
+	defaultNextRuns = 5
+	maxNextRuns     = 100
+)
+
+// taskView is a task as GET /tasks/{id} shows it: the stored record, plus the
+// projected fire times of a recurring one.
+type taskView struct {
+	scheduler.Task
+	NextRuns []time.Time `json:"next_runs,omitempty"`
+}
+
+// GetTask returns a single task by ID. For an unfinished recurring task it
+// adds the next ?next= fire times (default 5, up to 100, 0 for none).
 func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
+	n := defaultNextRuns
+	if v := r.URL.Query().Get("next"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxNextRuns {
+			http.Error(w, fmt.Sprintf("invalid next (0-%d)", maxNextRuns), http.StatusBadRequest)
+			return
+		}
+	}
+
 	task, ok := h.loadTask(w, r)
 	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(taskView{Task: *task, NextRuns: task.NextRuns(n)})
 }
 
 // DeleteTask cancels a single task by ID. Non-terminal tasks are soft-cancelled
 // (marked cancelled and retained in history); already-terminal tasks are a no-op
 // and expire on their own via TTL.
+//
+// The cancel is a transition from the status just read, so it either wins
+// cleanly - the runner's own transition then fails and the task neither
+// finishes nor reschedules - or the task moved first (say, it finished while
+// the request was in flight) and the caller gets a 409 to re-check.
 func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	task, ok := h.loadTask(w, r)
 	if !ok {
@@ -466,10 +735,11 @@ func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	if !task.Status.IsTerminal() {
 		now := time.Now().UTC()
-		task.Status = scheduler.StatusCancelled
-		task.FinishedAt = &now
-		if err := h.Store.Update(*task); err != nil {
-			http.Error(w, "could not cancel task", http.StatusInternalServerError)
+		_, err := h.Store.Transition(task.ID, task.Status, scheduler.StatusCancelled, func(task *scheduler.Task) error {
+			task.FinishedAt = &now
+			return nil
+		})
+		if !transitioned(w, err, "task changed status during cancel", "could not cancel task") {
 			return
 		}
 	}
@@ -481,6 +751,11 @@ func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteTasks(w http.ResponseWriter, r *http.Request) {
 	// Parse query params
 	url := r.URL.Query().Get("url")
+	queue := r.URL.Query().Get("queue")
+	if queue != "" && !scheduler.ValidQueueName(queue) {
+		http.Error(w, "invalid queue", http.StatusBadRequest)
+		return
+	}
 	status := r.URL.Query().Get("status")
 	if status != "" && !scheduler.TaskStatus(status).Valid() {
 		http.Error(w, "invalid status", http.StatusBadRequest)
@@ -510,12 +785,18 @@ func (h *Handler) DeleteTasks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Require at least one filter
-	if url == "" && status == "" && before == nil && after == nil {
-		http.Error(w, "at least one filter required (url, status, before, or after)", http.StatusBadRequest)
+	if url == "" && queue == "" && status == "" && before == nil && after == nil {
+		http.Error(w, "at least one filter required (url, queue, status, before, or after)", http.StatusBadRequest)
 		return
 	}
 
-	deleted, err := h.Store.DeleteTasks(url, status, before, after)
+	deleted, err := h.Store.DeleteTasks(scheduler.ListFilter{
+		Status:    status,
+		Queue:     queue,
+		URL:       url,
+		DueBefore: before,
+		DueAfter:  after,
+	})
 	if err != nil {
 		http.Error(w, "could not delete tasks", http.StatusInternalServerError)
 		return
@@ -525,8 +806,8 @@ func (h *Handler) DeleteTasks(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
 }
 
-// Metrics renders Prometheus metrics. The task gauges are read from the store
-// per scrape so they can't drift from it; everything else is in-process.
+// Metrics renders Prometheus metrics. The task gauges come from the store's
+// persisted counters, so they survive restarts; everything else is in-process.
 func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
 	counts, err := h.Store.Counts(time.Now().UTC())
 	if err != nil {
@@ -534,28 +815,63 @@ func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	byStatus := make(map[string]int, len(counts.ByStatus))
-	for status, n := range counts.ByStatus {
-		byStatus[string(status)] = n
+	snap := metrics.Snapshot{
+		ByStatus: statusLabels(counts.ByStatus),
+		Overdue:  counts.Overdue,
+		Queues:   make(map[string]metrics.QueueSnapshot, len(counts.Queues)),
+	}
+	for name, qc := range counts.Queues {
+		snap.Queues[name] = metrics.QueueSnapshot{ByStatus: statusLabels(qc.ByStatus), Overdue: qc.Overdue}
 	}
 
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-	if err := metrics.Write(w, metrics.Snapshot{ByStatus: byStatus, Overdue: counts.Overdue}); err != nil {
+	if err := metrics.Write(w, snap); err != nil {
 		// Headers are already out; the scrape fails on a truncated body.
 		slog.Error("write metrics", "error", err)
 	}
 }
 
+// statusLabels keys a per-status tally by the status's label value.
+func statusLabels(byStatus map[scheduler.TaskStatus]int) map[string]int {
+	out := make(map[string]int, len(byStatus))
+	for status, n := range byStatus {
+		out[string(status)] = n
+	}
+	return out
+}
+
 // Health is a liveness probe. Always returns 200 OK.
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	body := map[string]string{"status": "ok", "version": version.String(), "deliveries": "running"}
+	if m := h.maintenance(); m != nil {
+		body["deliveries"] = "paused"
+		if m.Until != nil {
+			body["paused_until"] = m.Until.UTC().Format(time.RFC3339)
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": version.String()})
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *Handler) maintenance() *scheduler.Maintenance {
+	if h.Maintenance == nil {
+		return nil
+	}
+	return h.Maintenance()
 }
 
 // Ready is a readiness probe. Returns 200 if database is accessible, 503
 // otherwise. It reads a single row: a probe that runs every few seconds must not
 // scan the store.
+//
+// A maintenance pause leaves Schedy ready - it is still accepting tasks - so it
+// is reported in the X-Schedy-Deliveries header rather than the status code.
 func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.maintenance() != nil {
+		w.Header().Set("X-Schedy-Deliveries", "paused")
+	} else {
+		w.Header().Set("X-Schedy-Deliveries", "running")
+	}
 	_, _, err := h.Store.ListTasks(scheduler.ListFilter{}, "", 1)
 	if err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
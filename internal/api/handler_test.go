@@ -5,10 +5,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -21,11 +24,13 @@ import (
 // mockStore implements the Store interface for testing
 type mockStore struct {
 	tasks map[string]scheduler.Task
+	keys  map[string]scheduler.SigningKey
 }
 
 func newMockStore() *mockStore {
 	return &mockStore{
 		tasks: make(map[string]scheduler.Task),
+		keys:  make(map[string]scheduler.SigningKey),
 	}
 }
 
@@ -60,6 +65,44 @@ func (m *mockStore) GetDueTasks(start, end time.Time, limit int) ([]scheduler.Ta
 	return tasks, nil
 }
 
+func (m *mockStore) Transition(id string, from, to scheduler.TaskStatus, mutate func(*scheduler.Task) error) (*scheduler.Task, error) {
+	task, ok := m.tasks[id]
+	if !ok {
+		return nil, scheduler.ErrNotFound
+	}
+	if task.Status != from {
+		return nil, scheduler.ErrConflict
+	}
+	if mutate != nil {
+		if err := mutate(&task); err != nil {
+			return nil, err
+		}
+	}
+	task.Status = to
+	m.tasks[id] = task
+	return &task, nil
+}
+
+// FindDuplicate mirrors the store's contract with a scan: the mock holds a
+// handful of tasks, and has no retention window to model.
+func (m *mockStore) FindDuplicate(key, url string, executeAt time.Time) (*scheduler.Task, error) {
+	for _, task := range m.tasks {
+		if task.Status.IsTerminal() {
+			continue
+		}
+		if key != "" {
+			if task.IdempotencyKey == key {
+				return &task, nil
+			}
+			continue
+		}
+		if task.URL == url && task.ScheduledAt().Equal(executeAt) {
+			return &task, nil
+		}
+	}
+	return nil, nil
+}
+
 func (m *mockStore) Delete(id string) error {
 	delete(m.tasks, id)
 	return nil
@@ -96,9 +139,24 @@ func (m *mockStore) ListTasks(filter scheduler.ListFilter, cursor string, limit
 		if filter.Status != "" && string(task.Status) != filter.Status {
 			continue
 		}
+		if filter.Queue != "" && task.QueueName() != filter.Queue {
+			continue
+		}
+		if filter.Priority != nil && task.Priority != *filter.Priority {
+			continue
+		}
 		if filter.URL != "" && task.URL != filter.URL {
 			continue
 		}
+		if filter.Error != "" || filter.StatusCode != 0 {
+			if len(task.Attempts) == 0 {
+				continue
+			}
+			last := task.Attempts[len(task.Attempts)-1]
+			if !strings.Contains(last.Error, filter.Error) || (filter.StatusCode != 0 && last.StatusCode != filter.StatusCode) {
+				continue
+			}
+		}
 		if cursor != "" && id <= start {
 			continue
 		}
@@ -130,22 +188,110 @@ func (m *mockStore) Counts(now time.Time) (scheduler.Counts, error) {
 	return counts, nil
 }
 
-func (m *mockStore) DeleteTasks(url, status string, before, after *time.Time) (int, error) {
+func (m *mockStore) OnPending(fn func(scheduler.Task)) {}
+
+func (m *mockStore) SetQueuePaused(queue string, paused bool) error { return nil }
+
+func (m *mockStore) PausedQueues() ([]string, error) { return nil, nil }
+
+func (m *mockStore) SetMaintenance(*scheduler.Maintenance) error { return nil }
+
+func (m *mockStore) Maintenance() (*scheduler.Maintenance, error) { return nil, nil }
+
+func (m *mockStore) ListSeries(seriesID, cursor string, limit int) ([]scheduler.Task, string, error) {
+	var tasks []scheduler.Task
+	for _, task := range m.tasks {
+		if task.SeriesID == seriesID {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].RunNumber < tasks[j].RunNumber })
+	return tasks, "", nil
+}
+
+func (m *mockStore) CancelSeries(seriesID string, at time.Time) (int, error) {
+	found, cancelled := false, 0
+	for id, task := range m.tasks {
+		if task.SeriesID != seriesID {
+			continue
+		}
+		found = true
+		if !task.Status.IsTerminal() {
+			task.Status = scheduler.StatusCancelled
+			task.FinishedAt = &at
+			m.tasks[id] = task
+			cancelled++
+		}
+	}
+	if !found {
+		return 0, scheduler.ErrNotFound
+	}
+	return cancelled, nil
+}
+
+func (m *mockStore) CreateSigningKey(k scheduler.SigningKey) error {
+	if _, ok := m.keys[k.ID]; ok {
+		return scheduler.ErrSigningKeyExists
+	}
+	m.keys[k.ID] = k
+	return nil
+}
+
+func (m *mockStore) RotateSigningKey(id, secret string, at time.Time, overlap time.Duration) (*scheduler.SigningKey, error) {
+	k, ok := m.keys[id]
+	if !ok {
+		return nil, scheduler.ErrSigningKeyNotFound
+	}
+	k.Rotate(secret, at, overlap)
+	m.keys[id] = k
+	return &k, nil
+}
+
+func (m *mockStore) SigningKey(id string) (*scheduler.SigningKey, error) {
+	k, ok := m.keys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+func (m *mockStore) ListSigningKeys() ([]scheduler.SigningKey, error) {
+	var keys []scheduler.SigningKey
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m *mockStore) DeleteSigningKey(id string) error {
+	if _, ok := m.keys[id]; !ok {
+		return scheduler.ErrSigningKeyNotFound
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+func (m *mockStore) DeleteTasks(filter scheduler.ListFilter) (int, error) {
 	count := 0
 	toDelete := []string{}
 
 	for id, task := range m.tasks {
 		match := true
 
-		if url != "" && task.URL != url {
+		if filter.URL != "" && task.URL != filter.URL {
+			match = false
+		}
+
+		if filter.Queue != "" && task.QueueName() != filter.Queue {
 			match = false
 		}
 
-		if before != nil && !task.ExecuteAt.Before(*before) {
+		if filter.DueBefore != nil && !task.ExecuteAt.Before(*filter.DueBefore) {
 			match = false
 		}
 
-		if after != nil && !task.ExecuteAt.After(*after) {
+		if filter.DueAfter != nil && !task.ExecuteAt.After(*filter.DueAfter) {
 			match = false
 		}
 
@@ -345,6 +491,177 @@ func TestCreateTaskHandler(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, post("/relative/path").Code)
 	})
 
+	t.Run("destination", func(t *testing.T) {
+		post := func(destination string) *httptest.ResponseRecorder {
+			reqBody := map[string]any{
+				"url":         "http://example.com/destination",
+				"execute_in":  "1h",
+				"destination": destination,
+			}
+			body, _ := json.Marshal(reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", "test-api-key")
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		w := post("partner-billing")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var resp scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "partner-billing", resp.Destination)
+
+		assert.Equal(t, http.StatusBadRequest, post("two words").Code)
+		assert.Equal(t, http.StatusBadRequest, post(strings.Repeat("x", 256)).Code)
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		post := func(queue string) *httptest.ResponseRecorder {
+			reqBody := map[string]any{
+				"url":        "http://example.com/queue-" + queue,
+				"execute_in": "1h",
+			}
+			if queue != "" {
+				reqBody["queue"] = queue
+			}
+			body, _ := json.Marshal(reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", "test-api-key")
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		w := post("")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, scheduler.DefaultQueue, resp.Queue)
+
+		w = post("billing")
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "billing", resp.Queue)
+
+		assert.Equal(t, http.StatusBadRequest, post("Billing").Code)
+		assert.Equal(t, http.StatusBadRequest, post("a:b").Code)
+		assert.Equal(t, http.StatusBadRequest, post(strings.Repeat("q", 65)).Code)
+
+		handler.KnownQueue = func(name string) bool { return name == scheduler.DefaultQueue || name == "billing" }
+		defer func() { handler.KnownQueue = nil }()
+		assert.Equal(t, http.StatusBadRequest, post("marketing").Code, "an undeclared queue is rejected")
+		assert.Equal(t, http.StatusCreated, post("billing").Code)
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		post := func(priority int) *httptest.ResponseRecorder {
+			reqBody := map[string]any{
+				"url":        "http://example.com/priority-" + strconv.Itoa(priority),
+				"execute_in": "1h",
+				"priority":   priority,
+			}
+			body, _ := json.Marshal(reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", "test-api-key")
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		w := post(9)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 9, resp.Priority)
+
+		assert.Equal(t, http.StatusBadRequest, post(10).Code)
+		assert.Equal(t, http.StatusBadRequest, post(-1).Code)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		n := 0
+		post := func(fields map[string]any) *httptest.ResponseRecorder {
+			n++
+			reqBody := map[string]any{
+				"url":        "http://example.com/expiry-" + strconv.Itoa(n),
+				"execute_in": "1h",
+			}
+			maps.Copy(reqBody, fields)
+			body, _ := json.Marshal(reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", "test-api-key")
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		expire := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+		w := post(map[string]any{"expire_at": expire.Format(time.RFC3339), "max_lateness": "5m"})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotNil(t, resp.ExpireAt)
+		assert.True(t, expire.Equal(*resp.ExpireAt))
+		assert.Equal(t, "5m", resp.MaxLateness)
+
+		assert.Equal(t, http.StatusCreated, post(map[string]any{"max_lateness": "10m", "schedule": "1h"}).Code,
+			"max_lateness carries over to each run")
+
+		for _, bad := range []map[string]any{
+			{"expire_at": "tomorrow"},
+			{"expire_at": time.Now().Add(30 * time.Minute).Format(time.RFC3339)},
+			{"expire_at": expire.Format(time.RFC3339), "schedule": "1h"},
+			{"max_lateness": "5"},
+			{"max_lateness": "-5m"},
+		} {
+			assert.Equal(t, http.StatusBadRequest, post(bad).Code, "%v", bad)
+		}
+	})
+
+	t.Run("payload_template", func(t *testing.T) {
+		n := 0
+		post := func(fields map[string]any) *httptest.ResponseRecorder {
+			n++
+			reqBody := map[string]any{
+				"url":              "http://example.com/template-" + strconv.Itoa(n) + "?run={{run_number}}",
+				"execute_in":       "1h",
+				"payload_template": true,
+			}
+			maps.Copy(reqBody, fields)
+			body, _ := json.Marshal(reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(body))
+			req.Header.Set("X-API-Key", "test-api-key")
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		w := post(map[string]any{
+			"headers": map[string]string{"X-Attempt": "{{attempt}}"},
+			"payload": map[string]any{"id": "{{task_id}}", "at": "{{scheduled_at}}"},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp scheduler.Task
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.PayloadTemplate)
+		assert.Equal(t, map[string]any{"id": "{{task_id}}", "at": "{{scheduled_at}}"}, resp.Payload, "stored as written, rendered per attempt")
+
+		assert.Equal(t, http.StatusCreated, post(map[string]any{"payload_template": false, "payload": "{{not a variable"}).Code,
+			"without payload_template, braces are just text")
+
+		for _, bad := range []map[string]any{
+			{"payload": map[string]any{"id": "{{id}}"}},
+			{"payload": "{{task_id"},
+			{"headers": map[string]string{"X-Attempt": "{{ .Attempt }}"}},
+			{"url": "http://example.com/{{task_id}}"},
+		} {
+			w := post(bad)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%v", bad)
+			assert.Contains(t, w.Body.String(), "invalid payload_template")
+		}
+	})
+
 	t.Run("recurrence schedule", func(t *testing.T) {
 		post := func(schedule string) *httptest.ResponseRecorder {
 			// Distinct URL so the shared store's earlier tasks don't dedup this one.
@@ -384,6 +701,58 @@ func TestCreateTaskHandler(t *testing.T) {
 		})
 	})
 
+	t.Run("calendar schedule", func(t *testing.T) {
+		post := func(body map[string]any) *httptest.ResponseRecorder {
+			body["url"] = "http://example.com/calendar"
+			b, _ := json.Marshal(body)
+			req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(b))
+			w := httptest.NewRecorder()
+			handler.CreateTask(w, req)
+			return w
+		}
+
+		t.Run("starts at the next calendar time", func(t *testing.T) {
+			w := post(map[string]any{
+				"schedule":      "at=09:00 weekdays=mon-fri",
+				"schedule_type": "calendar",
+				"timezone":      "Europe/Berlin",
+			})
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			var task scheduler.Task
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+			assert.Equal(t, scheduler.ScheduleCalendar, task.ScheduleType)
+			assert.Equal(t, "Europe/Berlin", task.Timezone)
+			berlin, _ := time.LoadLocation("Europe/Berlin")
+			local := task.ExecuteAt.In(berlin)
+			assert.Equal(t, "09:00", local.Format("15:04"))
+			assert.NotContains(t, []time.Weekday{time.Saturday, time.Sunday}, local.Weekday())
+			assert.True(t, task.ExecuteAt.After(time.Now()))
+		})
+
+		t.Run("defaults to UTC", func(t *testing.T) {
+			w := post(map[string]any{"schedule": "at=06:15", "schedule_type": "calendar", "execute_in": "1m"})
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			var task scheduler.Task
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+			assert.Equal(t, "UTC", task.Timezone)
+		})
+
+		t.Run("rejects bad input", func(t *testing.T) {
+			for _, body := range []map[string]any{
+				{"schedule": "at=25:00", "schedule_type": "calendar"},
+				{"schedule": "at=09:00", "schedule_type": "calendar", "timezone": "Nowhere/Special"},
+				{"schedule": "15m", "timezone": "Europe/Berlin", "execute_in": "1m"},
+				{"schedule": "15m", "schedule_type": "cron", "execute_in": "1m"},
+				{"schedule_type": "calendar", "execute_in": "1m"},
+				{"schedule": "15m"},
+				{"execute_in": "1m", "jitter": "0s"},
+				{"execute_in": "1m", "jitter": "soon"},
+			} {
+				assert.Equal(t, http.StatusBadRequest, post(body).Code, "%v", body)
+			}
+		})
+	})
+
 	t.Run("idempotency - duplicate task", func(t *testing.T) {
 		executeAt := time.Now().Add(2 * time.Hour)
 		reqBody := map[string]interface{}{
@@ -574,6 +943,43 @@ func TestGetTaskHandler(t *testing.T) {
 
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
+
+	t.Run("projects a recurring task's next runs", func(t *testing.T) {
+		at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+		store.Save(scheduler.Task{
+			ID:           "daily",
+			ExecuteAt:    at,
+			URL:          "http://example.com/daily",
+			Schedule:     "at=09:00",
+			ScheduleType: scheduler.ScheduleCalendar,
+			Timezone:     "UTC",
+		})
+		get := func(query string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/tasks/daily"+query, nil)
+			req.SetPathValue("id", "daily")
+			w := httptest.NewRecorder()
+			handler.GetTask(w, req)
+			return w
+		}
+
+		var resp struct {
+			ID       string      `json:"id"`
+			NextRuns []time.Time `json:"next_runs"`
+		}
+		w := get("")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "daily", resp.ID)
+		require.Len(t, resp.NextRuns, defaultNextRuns)
+		assert.Equal(t, at.AddDate(0, 0, 4), resp.NextRuns[4])
+
+		w = get("?next=2")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.NextRuns, 2)
+
+		assert.NotContains(t, get("?next=0").Body.String(), "next_runs")
+		assert.Equal(t, http.StatusBadRequest, get("?next=101").Code)
+	})
 }
 
 func TestCreateTaskDeduplication(t *testing.T) {
@@ -603,6 +1009,21 @@ func TestCreateTaskDeduplication(t *testing.T) {
 		return handler
 	}
 
+	t.Run("a jittered task is matched at its requested time", func(t *testing.T) {
+		handler := newHandler()
+		at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		body := map[string]any{"url": "http://example.com/j", "execute_at": at.Format(time.RFC3339), "jitter": "10m"}
+
+		code, first := post(t, handler, "", body)
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, at.Add(first.JitterOffset()), first.ExecuteAt, "execute_at shows the fire time, jitter included")
+		assert.Equal(t, "10m", first.Jitter)
+
+		code, second := post(t, handler, "", body)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, first.ID, second.ID)
+	})
+
 	t.Run("an idempotency key matches on the key alone", func(t *testing.T) {
 		handler := newHandler()
 
@@ -638,41 +1059,35 @@ func TestCreateTaskDeduplication(t *testing.T) {
 		assert.NotEqual(t, first.ID, second.ID)
 	})
 
-	t.Run("without a key, near-identical schedules deduplicate", func(t *testing.T) {
+	t.Run("without a key, identical schedules deduplicate", func(t *testing.T) {
 		handler := newHandler()
-		base := time.Now().Add(1 * time.Hour).UTC().Truncate(time.Second)
+		executeAt := time.Now().Add(1 * time.Hour).UTC().Format(time.RFC3339Nano)
 
-		// 100ms apart, but either side of a second boundary.
-		code, first := post(t, handler, "", map[string]any{
-			"url":        "http://example.com/a",
-			"execute_at": base.Add(900 * time.Millisecond).Format(time.RFC3339Nano),
-		})
+		code, first := post(t, handler, "", map[string]any{"url": "http://example.com/a", "execute_at": executeAt})
 		require.Equal(t, http.StatusCreated, code)
 
-		code, second := post(t, handler, "", map[string]any{
-			"url":        "http://example.com/a",
-			"execute_at": base.Add(1 * time.Second).Format(time.RFC3339Nano),
-		})
+		code, second := post(t, handler, "", map[string]any{"url": "http://example.com/a", "execute_at": executeAt})
 		assert.Equal(t, http.StatusOK, code)
 		assert.Equal(t, first.ID, second.ID)
 	})
 
-	t.Run("without a key, schedules a second or more apart are distinct", func(t *testing.T) {
+	t.Run("without a key, sub-second-apart schedules are distinct", func(t *testing.T) {
 		handler := newHandler()
 		base := time.Now().Add(1 * time.Hour).UTC().Truncate(time.Second)
 
 		code, first := post(t, handler, "", map[string]any{
 			"url":        "http://example.com/a",
-			"execute_at": base.Format(time.RFC3339),
+			"execute_at": base.Format(time.RFC3339Nano),
 		})
 		require.Equal(t, http.StatusCreated, code)
 
 		code, second := post(t, handler, "", map[string]any{
 			"url":        "http://example.com/a",
-			"execute_at": base.Add(2 * time.Second).Format(time.RFC3339),
+			"execute_at": base.Add(250 * time.Millisecond).Format(time.RFC3339Nano),
 		})
 		assert.Equal(t, http.StatusCreated, code)
 		assert.NotEqual(t, first.ID, second.ID)
+		assert.True(t, second.ExecuteAt.Equal(base.Add(250*time.Millisecond)), "fractional seconds are kept")
 	})
 
 	t.Run("without a key, a different url is not a duplicate", func(t *testing.T) {
@@ -1007,6 +1422,17 @@ func TestDeleteTaskHandler(t *testing.T) {
 		assert.Equal(t, scheduler.StatusCancelled, retrieved.Status)
 	})
 
+	t.Run("a task that moves first is a conflict, not a silent overwrite", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/tasks/racing", nil)
+		req.Header.Set("X-API-Key", "test-api-key")
+		req.SetPathValue("id", "racing")
+		w := httptest.NewRecorder()
+
+		New(&racingStore{}).DeleteTask(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
 	t.Run("task not found", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodDelete, "/tasks/nonexistent", nil)
 		req.Header.Set("X-API-Key", "test-api-key")
@@ -1240,6 +1666,27 @@ func TestHealthHandler(t *testing.T) {
 		assert.NotEmpty(t, body["version"])
 	})
 
+	t.Run("reports maintenance", func(t *testing.T) {
+		handler := New(store)
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		w := httptest.NewRecorder()
+		handler.Health(w, req)
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "running", body["deliveries"])
+
+		until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		handler.Maintenance = func() *scheduler.Maintenance {
+			return &scheduler.Maintenance{Since: until.Add(-time.Hour), Until: &until}
+		}
+		w = httptest.NewRecorder()
+		handler.Health(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, "a pause is not a liveness failure")
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "paused", body["deliveries"])
+		assert.Equal(t, "2030-01-02T03:04:05Z", body["paused_until"])
+	})
+
 	t.Run("no auth required", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
 		// Intentionally not setting API key header
@@ -1269,6 +1716,8 @@ func (f *failingStore) RecoverRunning() error {
 	return nil
 }
 
+func (f *failingStore) OnPending(fn func(scheduler.Task)) {}
+
 func (f *failingStore) GetDueTasks(start, end time.Time, limit int) ([]scheduler.Task, error) {
 	return nil, nil
 }
@@ -1281,14 +1730,66 @@ func (f *failingStore) GetTask(id string) (*scheduler.Task, error) {
 	return nil, nil
 }
 
+func (f *failingStore) Transition(id string, from, to scheduler.TaskStatus, mutate func(*scheduler.Task) error) (*scheduler.Task, error) {
+	return nil, scheduler.ErrNotFound
+}
+
+func (f *failingStore) FindDuplicate(key, url string, executeAt time.Time) (*scheduler.Task, error) {
+	return nil, nil
+}
+
 func (f *failingStore) ListTasks(filter scheduler.ListFilter, cursor string, limit int) ([]scheduler.Task, string, error) {
 	return nil, "", errors.New("database connection failed")
 }
 
-func (f *failingStore) DeleteTasks(url, status string, before, after *time.Time) (int, error) {
+func (f *failingStore) DeleteTasks(filter scheduler.ListFilter) (int, error) {
 	return 0, nil
 }
 
+func (f *failingStore) SetQueuePaused(queue string, paused bool) error {
+	return nil
+}
+
+func (f *failingStore) PausedQueues() ([]string, error) {
+	return nil, nil
+}
+
+func (f *failingStore) SetMaintenance(*scheduler.Maintenance) error {
+	return errors.New("database connection failed")
+}
+
+func (f *failingStore) Maintenance() (*scheduler.Maintenance, error) {
+	return nil, errors.New("database connection failed")
+}
+
+func (f *failingStore) ListSeries(seriesID, cursor string, limit int) ([]scheduler.Task, string, error) {
+	return nil, "", errors.New("database connection failed")
+}
+
+func (f *failingStore) CancelSeries(seriesID string, at time.Time) (int, error) {
+	return 0, errors.New("database connection failed")
+}
+
+func (f *failingStore) CreateSigningKey(k scheduler.SigningKey) error {
+	return errors.New("database connection failed")
+}
+
+func (f *failingStore) RotateSigningKey(id, secret string, at time.Time, overlap time.Duration) (*scheduler.SigningKey, error) {
+	return nil, errors.New("database connection failed")
+}
+
+func (f *failingStore) SigningKey(id string) (*scheduler.SigningKey, error) {
+	return nil, errors.New("database connection failed")
+}
+
+func (f *failingStore) ListSigningKeys() ([]scheduler.SigningKey, error) {
+	return nil, errors.New("database connection failed")
+}
+
+func (f *failingStore) DeleteSigningKey(id string) error {
+	return errors.New("database connection failed")
+}
+
 // updateFailingStore hands back a pending task but fails to persist the update.
 type updateFailingStore struct{ failingStore }
 
@@ -1300,6 +1801,22 @@ func (s *updateFailingStore) Update(task scheduler.Task) error {
 	return errors.New("database connection failed")
 }
 
+func (s *updateFailingStore) Transition(id string, from, to scheduler.TaskStatus, mutate func(*scheduler.Task) error) (*scheduler.Task, error) {
+	return nil, errors.New("database connection failed")
+}
+
+// racingStore hands back a pending task whose status has already moved by the
+// time the handler transitions it - the runner claimed it in between.
+type racingStore struct{ failingStore }
+
+func (s *racingStore) GetTask(id string) (*scheduler.Task, error) {
+	return &scheduler.Task{ID: id, Status: scheduler.StatusPending}, nil
+}
+
+func (s *racingStore) Transition(id string, from, to scheduler.TaskStatus, mutate func(*scheduler.Task) error) (*scheduler.Task, error) {
+	return nil, scheduler.ErrConflict
+}
+
 func TestReadyHandler(t *testing.T) {
 	t.Run("returns 200 when database accessible", func(t *testing.T) {
 		store := newMockStore()
@@ -1314,6 +1831,19 @@ func TestReadyHandler(t *testing.T) {
 		assert.Empty(t, w.Body.String())
 	})
 
+	t.Run("stays ready during maintenance", func(t *testing.T) {
+		handler := New(newMockStore())
+		handler.Maintenance = func() *scheduler.Maintenance { return &scheduler.Maintenance{Since: time.Now()} }
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		w := httptest.NewRecorder()
+
+		handler.Ready(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, "tasks are still accepted")
+		assert.Equal(t, "paused", w.Header().Get("X-Schedy-Deliveries"))
+	})
+
 	t.Run("returns 503 when database fails", func(t *testing.T) {
 		handler := New(&failingStore{})
 
@@ -1433,6 +1963,8 @@ func TestReplayTaskHandler(t *testing.T) {
 		assert.WithinDuration(t, time.Now(), got.ExecuteAt, 5*time.Second, "a replayed task is due now")
 		require.Len(t, got.Attempts, 1, "the failure that prompted the replay must survive it")
 		assert.Equal(t, "boom", got.Attempts[0].Error)
+		assert.Equal(t, 1, got.Replays)
+		assert.Equal(t, "broke_1", got.MessageID(), "a replay is a new message to the receiver")
 
 		// Persisted, not just echoed.
 		stored, err := store.GetTask("broke")
@@ -1472,6 +2004,27 @@ func TestReplayTaskHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("drops an expire_at it is already past", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		finished := time.Now()
+		require.NoError(t, store.Update(scheduler.Task{
+			ID:          "expired",
+			URL:         "http://example.com/otp",
+			ExecuteAt:   time.Now().Add(-2 * time.Hour),
+			ExpireAt:    &expired,
+			MaxLateness: "5m",
+			Status:      scheduler.StatusFailed,
+			FinishedAt:  &finished,
+		}))
+
+		w := replay(t, "expired")
+		require.Equal(t, http.StatusOK, w.Code)
+		stored, err := store.GetTask("expired")
+		require.NoError(t, err)
+		assert.Nil(t, stored.ExpireAt, "a deadline already past would retire the replay unfired")
+		assert.Equal(t, "5m", stored.MaxLateness, "relative to the new execute_at, so kept")
+	})
+
 	t.Run("404s an unknown task", func(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, replay(t, "nope").Code)
 	})
@@ -1556,3 +2109,69 @@ func TestDeleteTasksStatusFilter(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
 }
+
+func TestQueueFilters(t *testing.T) {
+	store := newMockStore()
+	handler := New(store)
+
+	now := time.Now()
+	store.Save(scheduler.Task{ID: "a", ExecuteAt: now.Add(time.Minute), Queue: "billing"})
+	store.Save(scheduler.Task{ID: "b", ExecuteAt: now.Add(time.Minute)})
+
+	req := httptest.NewRequest(http.MethodGet, "/tasks?queue=default", nil)
+	w := httptest.NewRecorder()
+	handler.ListTasks(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page taskPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, "b", page.Tasks[0].ID, "a task without a queue is in the default one")
+
+	req = httptest.NewRequest(http.MethodGet, "/tasks?queue=Not%20Valid", nil)
+	w = httptest.NewRecorder()
+	handler.ListTasks(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A queue alone is enough of a filter for a bulk delete.
+	req = httptest.NewRequest(http.MethodDelete, "/tasks?queue=billing", nil)
+	w = httptest.NewRecorder()
+	handler.DeleteTasks(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted": 1}`, w.Body.String())
+	_, ok := store.tasks["b"]
+	assert.True(t, ok, "other queues are untouched")
+}
+
+func TestListTasksPriorityFilter(t *testing.T) {
+	store := newMockStore()
+	handler := New(store)
+
+	now := time.Now()
+	store.Save(scheduler.Task{ID: "urgent", ExecuteAt: now.Add(time.Minute), Priority: 9})
+	store.Save(scheduler.Task{ID: "digest", ExecuteAt: now.Add(time.Minute)})
+
+	list := func(query string) (int, taskPage) {
+		req := httptest.NewRequest(http.MethodGet, "/tasks?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.ListTasks(w, req)
+		var page taskPage
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		}
+		return w.Code, page
+	}
+
+	code, page := list("priority=9")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, "urgent", page.Tasks[0].ID)
+
+	_, page = list("priority=0")
+	require.Len(t, page.Tasks, 1)
+	assert.Equal(t, "digest", page.Tasks[0].ID)
+
+	for _, bad := range []string{"priority=10", "priority=-1", "priority=high"} {
+		code, _ := list(bad)
+		assert.Equal(t, http.StatusBadRequest, code, bad)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// PauseDeliveries handles POST /admin/pause: stop delivering everything, e.g.
+// while receivers redeploy, without taking task creation down with it.
+// In-flight deliveries finish. Stored like a queue pause; an optional until
+// ends it on its own.
+func (h *Handler) PauseDeliveries(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Until *time.Time `json:"until"`
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.Until != nil && !body.Until.After(time.Now()) {
+		http.Error(w, "until must be in the future", http.StatusBadRequest)
+		return
+	}
+	m, err := h.Deliveries.Pause(body.Until)
+	if err != nil {
+		slog.Error("pause", "error", err)
+		http.Error(w, "could not pause deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"maintenance": m})
+}
+
+// ResumeDeliveries handles POST /admin/resume.
+func (h *Handler) ResumeDeliveries(w http.ResponseWriter, r *http.Request) {
+	if err := h.Deliveries.Resume(); err != nil {
+		slog.Error("resume", "error", err)
+		http.Error(w, "could not resume deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
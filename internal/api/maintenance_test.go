@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceHandlers(t *testing.T) {
+	d := &fakeDeliveries{}
+	h := withDeliveries(d)
+	h.APIKey = "secret"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", h.Ready)
+	mux.HandleFunc("GET /healthz", h.Health)
+	mux.HandleFunc("POST /admin/pause", h.WithAuth(h.PauseDeliveries))
+	mux.HandleFunc("POST /admin/resume", h.WithAuth(h.ResumeDeliveries))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-API-Key", "secret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := do(http.MethodGet, "/readyz", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "running", resp.Header.Get("X-Schedy-Deliveries"))
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	resp = do(http.MethodPost, "/admin/pause", `{"until": "`+until.Format(time.RFC3339)+`"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Maintenance scheduler.Maintenance `json:"maintenance"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotNil(t, body.Maintenance.Until)
+	assert.True(t, body.Maintenance.Until.Equal(until))
+	assert.False(t, body.Maintenance.Since.IsZero())
+
+	resp = do(http.MethodGet, "/readyz", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "tasks are still accepted")
+	assert.Equal(t, "paused", resp.Header.Get("X-Schedy-Deliveries"))
+	resp = do(http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a pause is not a liveness failure")
+
+	// No body is a pause with no end.
+	resp = do(http.MethodPost, "/admin/pause", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var again struct {
+		Maintenance scheduler.Maintenance `json:"maintenance"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&again))
+	assert.Nil(t, again.Maintenance.Until)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, "/admin/resume", "").StatusCode)
+	resp = do(http.MethodGet, "/readyz", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "running", resp.Header.Get("X-Schedy-Deliveries"))
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, "/admin/resume", "").StatusCode, "resuming while running is a no-op")
+
+	for body, want := range map[string]int{
+		`{"until": "2000-01-01T00:00:00Z"}`: http.StatusBadRequest,
+		`{"until": "soon"}`:                 http.StatusBadRequest,
+		`{"until": `:                        http.StatusBadRequest,
+	} {
+		assert.Equal(t, want, do(http.MethodPost, "/admin/pause", body).StatusCode, body)
+	}
+	assert.Equal(t, "running", do(http.MethodGet, "/readyz", "").Header.Get("X-Schedy-Deliveries"), "a rejected pause doesn't pause")
+
+	d.mu.Lock()
+	d.err = errors.New("disk full")
+	d.mu.Unlock()
+	resp = do(http.MethodPost, "/admin/pause", "")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodPost, "/admin/resume", "").StatusCode)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// Deliveries is the delivery side the admin endpoints steer: queue pauses,
+// maintenance and the per-host circuit breakers. The runner implements it.
+type Deliveries interface {
+	Queues() []scheduler.QueueStatus
+	PauseQueue(name string) error
+	ResumeQueue(name string) error
+	Pause(until *time.Time) (scheduler.Maintenance, error)
+	Resume() error
+	Breakers() []scheduler.BreakerStatus
+	ResetBreaker(host string) bool
+}
+
+// ListQueues handles GET /queues: the queues declared in SCHEDY_QUEUES and
+// whether each is paused.
+func (h *Handler) ListQueues(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"queues": h.Deliveries.Queues()})
+}
+
+// PauseQueue handles POST /queues/{name}/pause. A pause is stored, so it holds
+// across restarts until resumed; the queue's tasks are left as they are.
+func (h *Handler) PauseQueue(w http.ResponseWriter, r *http.Request) {
+	h.queueAction(w, r, h.Deliveries.PauseQueue)
+}
+
+// ResumeQueue handles POST /queues/{name}/resume.
+func (h *Handler) ResumeQueue(w http.ResponseWriter, r *http.Request) {
+	h.queueAction(w, r, h.Deliveries.ResumeQueue)
+}
+
+func (h *Handler) queueAction(w http.ResponseWriter, r *http.Request, action func(string) error) {
+	name := r.PathValue("name")
+	err := action(name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownQueue):
+		http.Error(w, "unknown queue", http.StatusNotFound)
+	case err != nil:
+		slog.Error("queue", "queue", name, "error", err)
+		http.Error(w, "could not update queue", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
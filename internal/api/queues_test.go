@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDeliveries stands in for the runner: declared queues that pause and
+// resume, a maintenance pause, and breakers set by hand - a tripped one can
+// only be had from real failed deliveries otherwise.
+type fakeDeliveries struct {
+	mu          sync.Mutex
+	queues      []scheduler.QueueStatus
+	maintenance *scheduler.Maintenance
+	breakers    []scheduler.BreakerStatus
+	err         error // what storing a pause or resume fails with, if anything
+}
+
+// withDeliveries returns a handler whose deliveries are d.
+func withDeliveries(d *fakeDeliveries) *Handler {
+	h := New(newMockStore())
+	h.Deliveries = d
+	h.Maintenance = d.current
+	return h
+}
+
+func (d *fakeDeliveries) Queues() []scheduler.QueueStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]scheduler.QueueStatus{}, d.queues...)
+}
+
+func (d *fakeDeliveries) PauseQueue(name string) error  { return d.setPaused(name, true) }
+func (d *fakeDeliveries) ResumeQueue(name string) error { return d.setPaused(name, false) }
+
+func (d *fakeDeliveries) setPaused(name string, paused bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.queues {
+		if d.queues[i].Name == name {
+			if d.err != nil {
+				return d.err
+			}
+			d.queues[i].Paused = paused
+			return nil
+		}
+	}
+	return scheduler.ErrUnknownQueue
+}
+
+func (d *fakeDeliveries) current() *scheduler.Maintenance {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.maintenance
+}
+
+func (d *fakeDeliveries) Pause(until *time.Time) (scheduler.Maintenance, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return scheduler.Maintenance{}, d.err
+	}
+	m := scheduler.Maintenance{Since: time.Now().UTC(), Until: until}
+	d.maintenance = &m
+	return m, nil
+}
+
+func (d *fakeDeliveries) Resume() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.maintenance = nil
+	return nil
+}
+
+func (d *fakeDeliveries) Breakers() []scheduler.BreakerStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]scheduler.BreakerStatus{}, d.breakers...)
+}
+
+func (d *fakeDeliveries) ResetBreaker(host string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	host = strings.ToLower(host)
+	for i, b := range d.breakers {
+		if b.Host == host {
+			d.breakers = append(d.breakers[:i], d.breakers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestQueueHandlers(t *testing.T) {
+	call := func(handler http.HandlerFunc, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/queues/"+name+"/pause", nil)
+		req.SetPathValue("name", name)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	list := func(h *Handler) []scheduler.QueueStatus {
+		w := httptest.NewRecorder()
+		h.ListQueues(w, httptest.NewRequest(http.MethodGet, "/queues", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var body struct {
+			Queues []scheduler.QueueStatus `json:"queues"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Queues
+	}
+	declared := func() []scheduler.QueueStatus {
+		return []scheduler.QueueStatus{
+			{Name: "billing", Concurrency: 20},
+			{Name: "default"},
+			{Name: "reports"},
+		}
+	}
+
+	t.Run("pause and resume", func(t *testing.T) {
+		h := withDeliveries(&fakeDeliveries{queues: declared()})
+
+		assert.Equal(t, declared(), list(h))
+
+		require.Equal(t, http.StatusNoContent, call(h.PauseQueue, "billing").Code)
+		assert.True(t, list(h)[0].Paused)
+		require.Equal(t, http.StatusNoContent, call(h.ResumeQueue, "billing").Code)
+		assert.False(t, list(h)[0].Paused)
+	})
+
+	t.Run("unknown queue", func(t *testing.T) {
+		h := withDeliveries(&fakeDeliveries{queues: declared()})
+		w := call(h.PauseQueue, "marketing")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "unknown queue")
+		assert.Equal(t, http.StatusNotFound, call(h.ResumeQueue, "marketing").Code)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		h := withDeliveries(&fakeDeliveries{queues: declared(), err: errors.New("disk full")})
+		w := call(h.PauseQueue, "billing")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "could not update queue")
+		assert.False(t, list(h)[0].Paused, "a pause that wasn't stored doesn't take effect")
+	})
+}
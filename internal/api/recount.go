@@ -0,0 +1,21 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// RecountTasks handles POST /admin/recount: recompute the task counters from a
+// full scan and correct any drift. The reconcile loop does this on its own;
+// this is for checking on demand.
+func (h *Handler) RecountTasks(w http.ResponseWriter, r *http.Request) {
+	drift, err := h.Recount()
+	if err != nil {
+		slog.Error("recount", "error", err)
+		http.Error(w, "could not recount tasks", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"drift": drift})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecountTasks(t *testing.T) {
+	recount := func(h *Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.RecountTasks(w, httptest.NewRequest(http.MethodPost, "/admin/recount", nil))
+		return w
+	}
+
+	t.Run("corrects a skewed counter", func(t *testing.T) {
+		// A one-second history TTL: the succeeded row expires without a
+		// transaction, leaving its counter one high, as in production.
+		store, err := scheduler.NewBadgerStore(t.TempDir(), time.Second)
+		require.NoError(t, err)
+		defer store.Close()
+		h := New(store)
+		h.Recount = store.Recount
+
+		now := time.Now()
+		require.NoError(t, store.Save(scheduler.Task{ID: "kept", URL: "http://example.com", ExecuteAt: now.Add(time.Hour)}))
+		require.NoError(t, store.Save(scheduler.Task{ID: "done", URL: "http://example.com", ExecuteAt: now.Add(time.Hour)}))
+		_, err = store.Transition("done", scheduler.StatusPending, scheduler.StatusSucceeded, nil)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			task, err := store.GetTask("done")
+			return err == nil && task == nil
+		}, 5*time.Second, 100*time.Millisecond)
+
+		counts, err := store.Counts(time.Now())
+		require.NoError(t, err)
+		require.Equal(t, 1, counts.ByStatus[scheduler.StatusSucceeded], "the counter can't see expiry")
+
+		w := recount(h)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"drift": {"succeeded": -1}}`, w.Body.String())
+
+		counts, err = store.Counts(time.Now())
+		require.NoError(t, err)
+		assert.Zero(t, counts.ByStatus[scheduler.StatusSucceeded])
+		assert.Equal(t, 1, counts.ByStatus[scheduler.StatusPending])
+
+		w = recount(h)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"drift": {}}`, w.Body.String(), "a corrected counter stays corrected")
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		h := New(newMockStore())
+		h.Recount = func() (map[scheduler.TaskStatus]int, error) { return nil, errors.New("disk gone") }
+		w := recount(h)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "could not recount tasks")
+	})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// A recurring task's runs form a series: each run the runner enqueues after
+// the last carries the first run's id as its series_id and the next
+// run_number. The series is how the chain is seen, and stopped, as a whole.
+
+// GetSeries returns one page of a series' runs, in run order, paged like
+// ListTasks. Runs purged by the history TTL have left it; a series with none
+// left is not found.
+func (h *Handler) GetSeries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+
+	limit, ok := pageLimit(w, q)
+	if !ok {
+		return
+	}
+
+	cursor := q.Get("cursor")
+	tasks, next, err := h.Store.ListSeries(id, cursor, limit)
+	if errors.Is(err, scheduler.ErrInvalidCursor) {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not list series", http.StatusInternalServerError)
+		return
+	}
+	if len(tasks) == 0 && cursor == "" {
+		http.Error(w, "series not found", http.StatusNotFound)
+		return
+	}
+	if tasks == nil {
+		tasks = []scheduler.Task{} // encode as [], never null
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taskPage{Tasks: tasks, NextCursor: next, HasMore: next != ""})
+}
+
+// CancelSeries cancels a series in one call, whichever run is pending or
+// running at the time, and refuses any run enqueued into it afterwards - so
+// a run finishing concurrently doesn't carry the chain on past the cancel.
+// Finished runs are left as they are.
+func (h *Handler) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	n, err := h.Store.CancelSeries(r.PathValue("id"), time.Now().UTC())
+	if errors.Is(err, scheduler.ErrNotFound) {
+		http.Error(w, "series not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not cancel series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"cancelled": n})
+}
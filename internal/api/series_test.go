@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRecurringTask(t *testing.T) {
+	create := func(t *testing.T, handler *Handler, body map[string]any) (int, scheduler.Task) {
+		t.Helper()
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(b))
+		w := httptest.NewRecorder()
+		handler.CreateTask(w, req)
+		var task scheduler.Task
+		if w.Code == http.StatusCreated {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+		}
+		return w.Code, task
+	}
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	t.Run("starts a series", func(t *testing.T) {
+		until := at.Add(24 * time.Hour)
+		code, task := create(t, New(newMockStore()), map[string]any{
+			"url":        "http://example.com/a",
+			"execute_at": at.Format(time.RFC3339),
+			"schedule":   "1h",
+			"max_runs":   10,
+			"until":      until.Format(time.RFC3339),
+		})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, task.ID, task.SeriesID, "a series is named after its first run")
+		assert.Equal(t, 1, task.RunNumber)
+		assert.Equal(t, 10, task.MaxRuns)
+		require.NotNil(t, task.Until)
+		assert.True(t, until.Equal(*task.Until))
+		assert.Equal(t, scheduler.CatchUpOnce, task.CatchUp, "today's behaviour by default")
+		require.NotNil(t, task.Anchor)
+		assert.True(t, at.Equal(*task.Anchor), "the series keeps the first run's phase")
+	})
+
+	t.Run("takes a catch-up policy", func(t *testing.T) {
+		code, task := create(t, New(newMockStore()), map[string]any{
+			"url":        "http://example.com/a",
+			"execute_at": at.Format(time.RFC3339),
+			"schedule":   "1h",
+			"catch_up":   "skip",
+		})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, scheduler.CatchUpSkip, task.CatchUp)
+	})
+
+	t.Run("a one-off task is no series", func(t *testing.T) {
+		code, task := create(t, New(newMockStore()), map[string]any{
+			"url":        "http://example.com/a",
+			"execute_at": at.Format(time.RFC3339),
+		})
+		require.Equal(t, http.StatusCreated, code)
+		assert.Empty(t, task.SeriesID)
+		assert.Zero(t, task.RunNumber)
+	})
+
+	t.Run("rejects bad bounds", func(t *testing.T) {
+		handler := New(newMockStore())
+		for _, body := range []map[string]any{
+			{"schedule": "1h", "max_runs": -1},
+			{"max_runs": 3},
+			{"until": at.Add(time.Hour).Format(time.RFC3339)},
+			{"schedule": "1h", "until": "tomorrow"},
+			{"schedule": "1h", "until": at.Add(-time.Minute).Format(time.RFC3339)},
+			{"schedule": "1h", "catch_up": "sometimes"},
+			{"catch_up": "skip"},
+		} {
+			body["url"] = "http://example.com/a"
+			body["execute_at"] = at.Format(time.RFC3339)
+			code, _ := create(t, handler, body)
+			assert.Equal(t, http.StatusBadRequest, code, "%v", body)
+		}
+	})
+}
+
+func TestSeriesHandlers(t *testing.T) {
+	seed := func(t *testing.T) *mockStore {
+		t.Helper()
+		store := newMockStore()
+		finished := time.Now().Add(-time.Hour)
+		for i, status := range []scheduler.TaskStatus{scheduler.StatusSucceeded, scheduler.StatusFailed, scheduler.StatusPending} {
+			task := scheduler.Task{
+				ID:        []string{"s", "s2", "s3"}[i],
+				URL:       "http://example.com/a",
+				ExecuteAt: time.Now().Add(time.Duration(i-2) * time.Hour),
+				Schedule:  "1h",
+				SeriesID:  "s",
+				RunNumber: i + 1,
+				Status:    status,
+			}
+			if status.IsTerminal() {
+				task.FinishedAt = &finished
+			}
+			require.NoError(t, store.Update(task))
+		}
+		require.NoError(t, store.Save(scheduler.Task{ID: "other", URL: "http://example.com/a", ExecuteAt: time.Now()}))
+		return store
+	}
+
+	serve := func(handler *Handler, method, target string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /series/{id}", handler.GetSeries)
+		mux.HandleFunc("DELETE /series/{id}", handler.CancelSeries)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	t.Run("lists the runs in order", func(t *testing.T) {
+		w := serve(New(seed(t)), http.MethodGet, "/series/s")
+		require.Equal(t, http.StatusOK, w.Code)
+		var page taskPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		require.Len(t, page.Tasks, 3)
+		for i, task := range page.Tasks {
+			assert.Equal(t, i+1, task.RunNumber)
+		}
+		assert.False(t, page.HasMore)
+	})
+
+	t.Run("cancels the unfinished runs", func(t *testing.T) {
+		store := seed(t)
+		w := serve(New(store), http.MethodDelete, "/series/s")
+		require.Equal(t, http.StatusOK, w.Code)
+		var res map[string]int
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, 1, res["cancelled"])
+
+		got, _ := store.GetTask("s3")
+		assert.Equal(t, scheduler.StatusCancelled, got.Status)
+		got, _ = store.GetTask("s")
+		assert.Equal(t, scheduler.StatusSucceeded, got.Status, "finished runs are left alone")
+		got, _ = store.GetTask("other")
+		assert.Equal(t, scheduler.StatusPending, got.Status)
+	})
+
+	t.Run("unknown series", func(t *testing.T) {
+		handler := New(seed(t))
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/series/nope").Code)
+		assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodDelete, "/series/nope").Code)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		handler := New(&failingStore{})
+		assert.Equal(t, http.StatusInternalServerError, serve(handler, http.MethodGet, "/series/s").Code)
+		assert.Equal(t, http.StatusInternalServerError, serve(handler, http.MethodDelete, "/series/s").Code)
+	})
+}
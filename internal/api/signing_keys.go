@@ -0,0 +1,213 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// Signing keys are named HMAC secrets a task can be signed with in place of
+// SCHEDY_SIGNING_SECRET. A key's secret is returned by the call that creates
+// or rotates it and never again: listing shows only ids and dates.
+
+// defaultKeyOverlap is how long a rotated-out secret keeps signing when the
+// rotation doesn't say.
+const defaultKeyOverlap = 24 * time.Hour
+
+// Bounds on a caller-chosen secret. A generated one is 32 random bytes.
+const (
+	minSecretLen = 16
+	maxSecretLen = 512
+)
+
+// maxKeyBody caps a signing key request: an id, a secret and a duration.
+const maxKeyBody = 4 << 10
+
+// signingKeyView is a signing key as listed: never its secrets.
+type signingKeyView struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	// PreviousUntil is when the rotated-out secret stops signing, present
+	// only while it still does.
+	PreviousUntil *time.Time `json:"previous_until,omitempty"`
+}
+
+func viewSigningKey(k scheduler.SigningKey, now time.Time) signingKeyView {
+	v := signingKeyView{ID: k.ID, CreatedAt: k.CreatedAt, RotatedAt: k.RotatedAt}
+	if len(k.Secrets(now)) > 1 {
+		v.PreviousUntil = k.PreviousUntil
+	}
+	return v
+}
+
+// signingKeySecret is the response to a create or rotate, the only ones that
+// carry the secret.
+type signingKeySecret struct {
+	signingKeyView
+	Secret string `json:"secret"`
+}
+
+// signingKeyRequest is the body of a create (ID, Secret) or a rotate (Secret,
+// Overlap). An empty Secret has one generated.
+type signingKeyRequest struct {
+	ID      string `json:"id"`
+	Secret  string `json:"secret"`
+	Overlap string `json:"overlap"` // Go duration; 0 retires the old secret at once
+}
+
+// decodeKeyRequest reads a signing key body, which may be empty. It writes the
+// error response itself; the bool reports whether the caller may continue.
+func decodeKeyRequest(w http.ResponseWriter, r *http.Request) (signingKeyRequest, bool) {
+	var req signingKeyRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxKeyBody)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		rand.Read(b)
+		req.Secret = hex.EncodeToString(b)
+	}
+	if len(req.Secret) < minSecretLen || len(req.Secret) > maxSecretLen {
+		http.Error(w, fmt.Sprintf("invalid secret (%d-%d characters)", minSecretLen, maxSecretLen), http.StatusBadRequest)
+		return req, false
+	}
+	// Checked now rather than at the first standard-webhooks delivery, which
+	// would fail on it.
+	if _, err := scheduler.StandardWebhooksKey(req.Secret); err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret (%v)", err), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// CreateSigningKey stores a new signing key and returns it, secret included,
+// this once.
+func (h *Handler) CreateSigningKey(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeyRequest(w, r)
+	if !ok {
+		return
+	}
+	if !scheduler.ValidSigningKeyID(req.ID) {
+		http.Error(w, "invalid id (lowercase letters, digits, '-' and '_')", http.StatusBadRequest)
+		return
+	}
+	if req.Overlap != "" {
+		http.Error(w, "overlap applies to a rotation only", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	key := scheduler.SigningKey{ID: req.ID, Secret: req.Secret, CreatedAt: now}
+	err := h.Store.CreateSigningKey(key)
+	switch {
+	case errors.Is(err, scheduler.ErrSigningKeyExists):
+		http.Error(w, "signing key already exists", http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("create signing key", "key_id", req.ID, "error", err)
+		http.Error(w, "could not create signing key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(signingKeySecret{viewSigningKey(key, now), key.Secret})
+}
+
+// ListSigningKeys returns every signing key, without secrets.
+func (h *Handler) ListSigningKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.Store.ListSigningKeys()
+	if err != nil {
+		http.Error(w, "could not list signing keys", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	views := make([]signingKeyView, 0, len(keys))
+	for _, k := range keys {
+		views = append(views, viewSigningKey(k, now))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"signing_keys": views})
+}
+
+// RotateSigningKey gives a key a new secret and returns it this once. The old
+// secret keeps signing alongside it for the overlap, default 24h, so receivers
+// can switch without a moment when neither verifies.
+func (h *Handler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeKeyRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.ID != "" {
+		http.Error(w, "id is taken from the path", http.StatusBadRequest)
+		return
+	}
+	overlap := defaultKeyOverlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			http.Error(w, `invalid overlap (Go duration like "24h", or "0s")`, http.StatusBadRequest)
+			return
+		}
+		overlap = d
+	}
+
+	id := r.PathValue("id")
+	now := time.Now().UTC()
+	key, err := h.Store.RotateSigningKey(id, req.Secret, now, overlap)
+	switch {
+	case errors.Is(err, scheduler.ErrSigningKeyNotFound):
+		http.Error(w, "signing key not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("rotate signing key", "key_id", id, "error", err)
+		http.Error(w, "could not rotate signing key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signingKeySecret{viewSigningKey(*key, now), key.Secret})
+}
+
+// RetireSigningKey deletes a signing key. Tasks that still name it fail their
+// deliveries rather than go out unsigned.
+func (h *Handler) RetireSigningKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Store.DeleteSigningKey(id)
+	switch {
+	case errors.Is(err, scheduler.ErrSigningKeyNotFound):
+		http.Error(w, "signing key not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.Error("retire signing key", "key_id", id, "error", err)
+		http.Error(w, "could not retire signing key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PublishedKeys serves the public keys ed25519 signatures verify against, as a
+// JSON Web Key Set. It is unauthenticated: receivers fetch it, and a public
+// key is of no use to anyone but a verifier.
+func (h *Handler) PublishedKeys(w http.ResponseWriter, r *http.Request) {
+	keys := []scheduler.JWK{}
+	if h.PublicKeys != nil {
+		keys = h.PublicKeys()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// Receivers may cache the set, but not for long: a new key has to reach
+	// them before the first delivery it signs.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
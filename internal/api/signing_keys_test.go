@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningKeyHandlers(t *testing.T) {
+	call := func(t *testing.T, handler http.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/admin/signing-keys", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("create returns the secret once", func(t *testing.T) {
+		store := newMockStore()
+		h := New(store)
+
+		w := call(t, h.CreateSigningKey, http.MethodPost, "", `{"id": "tenant-a"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "tenant-a", created["id"])
+		assert.Len(t, created["secret"], 64, "a generated secret is 32 random bytes, hex")
+		assert.Equal(t, created["secret"], store.keys["tenant-a"].Secret)
+
+		w = call(t, h.CreateSigningKey, http.MethodPost, "", `{"id": "tenant-b", "secret": "a-secret-of-our-own"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "a-secret-of-our-own", store.keys["tenant-b"].Secret)
+
+		w = call(t, h.ListSigningKeys, http.MethodGet, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "secret", "listing never shows a secret")
+		var list struct {
+			SigningKeys []signingKeyView `json:"signing_keys"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.SigningKeys, 2)
+		assert.Equal(t, "tenant-a", list.SigningKeys[0].ID)
+	})
+
+	t.Run("create rejects bad input", func(t *testing.T) {
+		store := newMockStore()
+		h := New(store)
+		require.NoError(t, store.CreateSigningKey(scheduler.SigningKey{ID: "taken", Secret: "0123456789abcdef"}))
+
+		for body, want := range map[string]int{
+			`{"id": "Tenant A"}`:                    http.StatusBadRequest,
+			`{}`:                                    http.StatusBadRequest,
+			`{"id": "tenant-a", "secret": "short"}`: http.StatusBadRequest,
+			`{"id": "tenant-a", "overlap": "1h"}`:   http.StatusBadRequest,
+			`{"id": `:                               http.StatusBadRequest,
+			`{"id": "tenant-a", "secret": "whsec_not base64!"}`: http.StatusBadRequest,
+			`{"id": "taken"}`: http.StatusConflict,
+		} {
+			w := call(t, h.CreateSigningKey, http.MethodPost, "", body)
+			assert.Equal(t, want, w.Code, body)
+		}
+	})
+
+	t.Run("rotate keeps the old secret signing for the overlap", func(t *testing.T) {
+		store := newMockStore()
+		h := New(store)
+		require.NoError(t, store.CreateSigningKey(scheduler.SigningKey{ID: "tenant-a", Secret: "the-first-secret"}))
+
+		w := call(t, h.RotateSigningKey, http.MethodPost, "tenant-a", `{"overlap": "2h"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var rotated map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+		assert.NotEqual(t, "the-first-secret", rotated["secret"])
+		assert.NotEmpty(t, rotated["previous_until"])
+
+		k := store.keys["tenant-a"]
+		assert.Equal(t, rotated["secret"], k.Secret)
+		assert.Equal(t, "the-first-secret", k.Previous)
+
+		w = call(t, h.RotateSigningKey, http.MethodPost, "tenant-a", "")
+		require.Equal(t, http.StatusOK, w.Code, "an empty body rotates with the defaults")
+
+		assert.Equal(t, http.StatusNotFound, call(t, h.RotateSigningKey, http.MethodPost, "missing", "").Code)
+		assert.Equal(t, http.StatusBadRequest, call(t, h.RotateSigningKey, http.MethodPost, "tenant-a", `{"overlap": "-1h"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, call(t, h.RotateSigningKey, http.MethodPost, "tenant-a", `{"id": "other"}`).Code)
+	})
+
+	t.Run("retire", func(t *testing.T) {
+		store := newMockStore()
+		h := New(store)
+		require.NoError(t, store.CreateSigningKey(scheduler.SigningKey{ID: "tenant-a", Secret: "the-first-secret"}))
+
+		assert.Equal(t, http.StatusNoContent, call(t, h.RetireSigningKey, http.MethodDelete, "tenant-a", "").Code)
+		assert.Empty(t, store.keys)
+		assert.Equal(t, http.StatusNotFound, call(t, h.RetireSigningKey, http.MethodDelete, "tenant-a", "").Code)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		h := New(&failingStore{})
+		assert.Equal(t, http.StatusInternalServerError, call(t, h.CreateSigningKey, http.MethodPost, "", `{"id": "tenant-a"}`).Code)
+		assert.Equal(t, http.StatusInternalServerError, call(t, h.ListSigningKeys, http.MethodGet, "", "").Code)
+		assert.Equal(t, http.StatusInternalServerError, call(t, h.RotateSigningKey, http.MethodPost, "tenant-a", "").Code)
+		assert.Equal(t, http.StatusInternalServerError, call(t, h.RetireSigningKey, http.MethodDelete, "tenant-a", "").Code)
+	})
+}
+
+func TestCreateTaskWithSigningKey(t *testing.T) {
+	store := newMockStore()
+	require.NoError(t, store.CreateSigningKey(scheduler.SigningKey{ID: "tenant-a", Secret: "the-first-secret"}))
+	h := New(store)
+
+	create := func(body map[string]any) *httptest.ResponseRecorder {
+		body["execute_in"] = "1h"
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		h.CreateTask(w, httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewReader(b)))
+		return w
+	}
+
+	w := create(map[string]any{"url": "http://example.com/a", "signing_key_id": "tenant-a"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var task scheduler.Task
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+	assert.Equal(t, "tenant-a", task.SigningKeyID)
+
+	w = create(map[string]any{"url": "http://example.com/b", "signing_key_id": "tenant-z"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown signing_key_id")
+
+	w = create(map[string]any{"url": "http://example.com/b", "signing_scheme": "standard-webhooks"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &task))
+	assert.Equal(t, scheduler.SchemeStandardWebhooks, task.SigningScheme)
+
+	w = create(map[string]any{"url": "http://example.com/b", "signing_scheme": "jwt"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid signing_scheme")
+
+	w = create(map[string]any{"url": "http://example.com/b", "signing_scheme": "ed25519", "signing_key_id": "tenant-a"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "ed25519 has no use for an HMAC key")
+
+	w = create(map[string]any{"url": "http://example.com/c", "on_success": map[string]any{"url": "http://example.com/d", "signing_key_id": "tenant-z"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown on_success.signing_key_id")
+}
+
+func TestPublishedKeys(t *testing.T) {
+	h := New(newMockStore())
+	w := httptest.NewRecorder()
+	h.PublishedKeys(w, httptest.NewRequest(http.MethodGet, "/.well-known/schedy-keys", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys": []}`, w.Body.String())
+
+	key, err := scheduler.NewEd25519Key()
+	require.NoError(t, err)
+	h.PublicKeys = func() []scheduler.JWK { return []scheduler.JWK{key.JWK()} }
+	w = httptest.NewRecorder()
+	h.PublishedKeys(w, httptest.NewRequest(http.MethodGet, "/.well-known/schedy-keys", nil))
+	var set struct {
+		Keys []scheduler.JWK `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, key.ID, set.Keys[0].Kid)
+	assert.NotContains(t, w.Body.String(), `"d"`, "never the private half")
+}
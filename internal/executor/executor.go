@@ -3,19 +3,29 @@ package executor
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/ksamirdev/schedy/internal/scheduler"
 )
 
@@ -36,6 +46,49 @@ type Result struct {
 	// 429 or 503 response, 0 when absent/unparseable. The runner treats it as a
 	// floor for the next retry delay (capped - see runner's maxBackoff).
 	RetryAfter time.Duration
+	// Sent reports whether the attempt went out to the host. It is false when
+	// the request couldn't be built or signed, or was refused before a
+	// connection was tried - by the transport, or the private-target guard -
+	// and then the attempt says nothing about the host.
+	Sent bool
+}
+
+// Unavailable reports whether the attempt failed because the host itself
+// looks down or overloaded: the connection to it failing (dial, TLS, a dropped
+// connection, a timeout), or a 5xx or 429 response. It is what the runner's
+// circuit breaker counts. An attempt that never reached the host - a request
+// that couldn't be built or signed, or a dial refused by the private-target
+// guard - is not the host's fault and doesn't count; see Sent.
+func (r Result) Unavailable() bool {
+	if r.Err == nil || !r.Sent {
+		return false
+	}
+	if r.StatusCode != 0 {
+		return r.StatusCode >= 500 || r.StatusCode == http.StatusTooManyRequests
+	}
+	return transportError(r.Err)
+}
+
+// transportError reports whether err, from sending a request, is the
+// connection to the host failing rather than, say, the delivery being cut
+// short on shutdown.
+func transportError(err error) bool {
+	// Client.Do wraps everything in a *url.Error, which is a net.Error
+	// whatever it carries, so look inside it.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error // dial, DNS, read and write errors, and timeouts
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alert tls.AlertError
+	return errors.As(err, &netErr) ||
+		errors.As(err, &certErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alert) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
 }
 
 // retryAfterHint extracts the Retry-After wait from a throttling response.
@@ -66,9 +119,20 @@ func retryAfterHint(res *http.Response) time.Duration {
 
 type Executor struct {
 	client *http.Client
+	// tls routes deliveries through per-host TLS settings (SCHEDY_TLS), nil
+	// without any.
+	tls *tlsRoutes
 	// signingSecret, if set (SCHEDY_SIGNING_SECRET), makes Execute attach an
 	// HMAC-SHA256 signature header so receivers can authenticate the request.
 	signingSecret string
+	// signingScheme is the scheme a task that names none is signed in
+	// (SCHEDY_SIGNING_SCHEME, default schedy).
+	signingScheme scheduler.SigningScheme
+	// Keys resolves a task's signing_key_id to its key, nil if there is no
+	// such key. Nil leaves every task to signingSecret.
+	Keys func(id string) (*scheduler.SigningKey, error)
+	// Ed25519 signs deliveries in the ed25519 scheme. Nil fails them.
+	Ed25519 *scheduler.Ed25519Key
 }
 
 // NewExecutor builds the delivery client. Dials to private, loopback,
@@ -92,10 +156,36 @@ func newExecutor(guardPrivate bool) *Executor {
 	}
 	// No client.Timeout: the per-attempt context deadline in Execute is the
 	// timeout, so a task's timeout_ms can exceed the 10s default.
-	return &Executor{
+	e := &Executor{
 		client:        &http.Client{Transport: transport},
 		signingSecret: os.Getenv("SCHEDY_SIGNING_SECRET"),
+		signingScheme: scheduler.SchemeSchedy,
 	}
+	if v := os.Getenv("SCHEDY_TLS"); v != "" {
+		rules, err := parseTLSRules(v)
+		if err == nil {
+			e.tls, err = newTLSRoutes(transport, rules)
+		}
+		if err != nil {
+			slog.Error("invalid SCHEDY_TLS", "error", err)
+			os.Exit(1)
+		}
+		e.client.Transport = e.tls
+	}
+	if v := os.Getenv("SCHEDY_SIGNING_SCHEME"); v != "" {
+		e.signingScheme = scheduler.SigningScheme(v)
+		if !e.signingScheme.Valid() {
+			slog.Error("invalid SCHEDY_SIGNING_SCHEME (schedy, standard-webhooks or ed25519)", "value", v)
+			os.Exit(1)
+		}
+	}
+	if e.signingScheme == scheduler.SchemeStandardWebhooks && e.signingSecret != "" {
+		if _, err := scheduler.StandardWebhooksKey(e.signingSecret); err != nil {
+			slog.Error("invalid SCHEDY_SIGNING_SECRET", "error", err)
+			os.Exit(1)
+		}
+	}
+	return e
 }
 
 // defaultTimeout bounds a delivery attempt when the task sets no timeout_ms.
@@ -109,6 +199,10 @@ func timeout(task scheduler.Task) time.Duration {
 	return defaultTimeout
 }
 
+// errBlockedTarget is the dial error for an address the private-target guard
+// refuses.
+var errBlockedTarget = errors.New("blocked dial to non-public address")
+
 // blockPrivateDial rejects any dial to a non-public address.
 func blockPrivateDial(network, address string, _ syscall.RawConn) error {
 	host, _, err := net.SplitHostPort(address)
@@ -121,65 +215,201 @@ func blockPrivateDial(network, address string, _ syscall.RawConn) error {
 	}
 	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
 		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
-		return fmt.Errorf("blocked dial to non-public address %s", ip)
+		return fmt.Errorf("%w %s", errBlockedTarget, ip)
 	}
 	return nil
 }
 
-// sign attaches an HMAC-SHA256 signature so receivers can authenticate that the
-// request genuinely came from schedy. No-op unless SCHEDY_SIGNING_SECRET is set.
+// errSigningKey is the error for a delivery whose signing key can't be had. The
+// request is not sent: unsigned, it would be refused, or worse, accepted.
+var errSigningKey = errors.New("signing key")
+
+// signingSecrets returns the secrets task's deliveries are signed with as of
+// now: its signing key's, or else SCHEDY_SIGNING_SECRET. None leaves the
+// request unsigned.
+func (e *Executor) signingSecrets(task scheduler.Task, now time.Time) ([]string, error) {
+	if e.scheme(task) == scheduler.SchemeEd25519 {
+		return nil, nil
+	}
+	if task.SigningKeyID == "" {
+		if e.signingSecret == "" {
+			return nil, nil
+		}
+		return []string{e.signingSecret}, nil
+	}
+	var key *scheduler.SigningKey
+	if e.Keys != nil {
+		var err error
+		if key, err = e.Keys(task.SigningKeyID); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", errSigningKey, task.SigningKeyID, err)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w %q not found", errSigningKey, task.SigningKeyID)
+	}
+	return key.Secrets(now), nil
+}
+
+// scheme returns the scheme task's deliveries are signed in: its own, or else
+// the server's. A task with a signing key is HMAC-signed whatever the server
+// default, as ed25519 would have no use for the key it names.
+func (e *Executor) scheme(task scheduler.Task) scheduler.SigningScheme {
+	if task.SigningScheme != "" {
+		return task.SigningScheme
+	}
+	if e.signingScheme == scheduler.SchemeEd25519 && task.SigningKeyID != "" {
+		return scheduler.SchemeSchedy
+	}
+	return e.signingScheme
+}
+
+// sign attaches an HMAC-SHA256 signature per secret so receivers can
+// authenticate that the request genuinely came from schedy. No-op without
+// secrets. The task's scheme says which headers carry it; the ed25519 scheme
+// signs with the Ed25519 key instead, secrets or not.
+//
+// In the schedy scheme the signature is computed over "<unix-ts>.<body>" and
+// sent alongside the timestamp, so a receiver that verifies both the MAC and a
+// bounded clock skew gets replay protection, not just authenticity. Receiver
+// verification ships as a docs snippet rather than an SDK.
 //
-// The signature is computed over "<unix-ts>.<body>" and sent alongside the
-// timestamp, so a receiver that verifies both the MAC and a bounded clock skew
-// gets replay protection, not just authenticity. Receiver verification ships as
-// a docs snippet rather than an SDK.
-func (e *Executor) sign(req *http.Request, body []byte) {
-	if e.signingSecret == "" {
-		return
-	}
-	ts := strconv.FormatInt(time.Now().Unix(), 10)
-	mac := hmac.New(sha256.New, []byte(e.signingSecret))
-	mac.Write([]byte(ts))
-	mac.Write([]byte("."))
-	mac.Write(body)
+// A key mid-rotation has two secrets, and the signature header carries both
+// signatures, newest first: a receiver accepts the request if any of them
+// verifies, so it can hold either secret while it rolls over.
+func (e *Executor) sign(req *http.Request, body []byte, task scheduler.Task, secrets []string, now time.Time) error {
+	scheme := e.scheme(task)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	if scheme == scheduler.SchemeEd25519 {
+		return e.signEd25519(req, body, ts)
+	}
+	if task.SigningKeyID != "" {
+		req.Header.Set("X-Schedy-Key-Id", task.SigningKeyID)
+	} else {
+		req.Header.Del("X-Schedy-Key-Id")
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	if scheme == scheduler.SchemeStandardWebhooks {
+		return signStandardWebhooks(req, body, task.MessageID(), ts, secrets)
+	}
+	sigs := make([]string, len(secrets))
+	for i, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts))
+		mac.Write([]byte("."))
+		mac.Write(body)
+		sigs[i] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
 	req.Header.Set("X-Schedy-Timestamp", ts)
-	req.Header.Set("X-Schedy-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Schedy-Signature", strings.Join(sigs, ","))
+	return nil
+}
+
+// signEd25519 signs "<ts>.<body>" with the Ed25519 key, in the schedy
+// scheme's headers: X-Schedy-Signature "ed25519=<base64>", and the key's id in
+// X-Schedy-Key-Id for a receiver to look up at /.well-known/schedy-keys.
+func (e *Executor) signEd25519(req *http.Request, body []byte, ts string) error {
+	if e.Ed25519 == nil {
+		return fmt.Errorf("%w: no ed25519 key", errSigningKey)
+	}
+	msg := make([]byte, 0, len(ts)+1+len(body))
+	msg = append(append(append(msg, ts...), '.'), body...)
+	sig := ed25519.Sign(e.Ed25519.PrivateKey, msg)
+	req.Header.Set("X-Schedy-Key-Id", e.Ed25519.ID)
+	req.Header.Set("X-Schedy-Timestamp", ts)
+	req.Header.Set("X-Schedy-Signature", "ed25519="+base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// signStandardWebhooks signs req the Standard Webhooks way: "v1,<base64>"
+// over "<msg-id>.<ts>.<body>", space-separated per secret. The message id is
+// the task's MessageID, the same on every retry of a run, so a receiver can
+// use it to drop a delivery it has already handled. A request with no task,
+// like the failure callback, is sent once and gets an id of its own.
+func signStandardWebhooks(req *http.Request, body []byte, msgID, ts string, secrets []string) error {
+	if msgID == "" {
+		msgID = uuid.NewString()
+	}
+	sigs := make([]string, len(secrets))
+	for i, secret := range secrets {
+		key, err := scheduler.StandardWebhooksKey(secret)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errSigningKey, err)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(msgID))
+		mac.Write([]byte("."))
+		mac.Write([]byte(ts))
+		mac.Write([]byte("."))
+		mac.Write(body)
+		sigs[i] = "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	req.Header.Set("webhook-id", msgID)
+	req.Header.Set("webhook-timestamp", ts)
+	req.Header.Set("webhook-signature", strings.Join(sigs, " "))
+	return nil
 }
 
 // Execute delivers one HTTP request for the task (task.Method, default POST) and reports the attempt outcome
 // (status code, error, duration). A 2xx yields a nil Err.
 func (e *Executor) Execute(task scheduler.Task) Result {
+	return e.ExecuteContext(context.Background(), task)
+}
+
+// ExecuteContext is Execute cut short if ctx ends first, in which case Err
+// wraps ctx's error.
+func (e *Executor) ExecuteContext(parent context.Context, task scheduler.Task) Result {
 	method := task.Method
 	if method == "" {
 		method = http.MethodPost
 	}
 
+	now := time.Now()
+	secrets, err := e.signingSecrets(task, now)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	// A payload template is filled in here, at each attempt, so a retry
+	// reports its own attempt number and fire time.
+	target, headers, payload := task.URL, task.Headers, task.Payload
+	if task.PayloadTemplate {
+		vars := task.DeliveryVars(now.UTC())
+		target = scheduler.RenderURL(target, vars)
+		payload = scheduler.RenderPayload(payload, vars)
+		headers = make(map[string]string, len(task.Headers))
+		for k, v := range task.Headers {
+			headers[k] = scheduler.RenderTemplate(v, vars, nil)
+		}
+	}
+
 	var bodyBytes []byte
 	var body io.Reader
 	// GET/HEAD carry no request body.
 	if method != http.MethodGet && method != http.MethodHead {
-		switch v := task.Payload.(type) {
+		switch v := payload.(type) {
 		case string:
 			bodyBytes = []byte(v)
 		case []byte:
 			bodyBytes = v
 		default:
 			// fallback to JSON
-			bodyBytes, _ = json.Marshal(task.Payload)
+			bodyBytes, _ = json.Marshal(payload)
 		}
 		body = bytes.NewBuffer(bodyBytes)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout(task))
+	ctx, cancel := context.WithTimeout(parent, timeout(task))
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, method, task.URL, body)
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
 	if err != nil {
 		return Result{Err: err}
 	}
 
 	// Set custom headers
-	for k, v := range task.Headers {
+	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 	// If no Content-Type header is set, default to application/json (only when
@@ -204,14 +434,23 @@ func (e *Executor) Execute(task scheduler.Task) Result {
 	// Sign after custom headers so a task's own headers can't spoof or clear the
 	// signature. Signing over "timestamp.body" (not the body alone) lets the
 	// receiver reject replays outside a freshness window.
-	e.sign(req, bodyBytes)
+	if err := e.sign(req, bodyBytes, task, secrets, now); err != nil {
+		return Result{Err: err}
+	}
+
+	// The transport asks for a connection only once it has accepted the
+	// request, so that is the point the attempt becomes the host's business.
+	var sent atomic.Bool
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { sent.Store(true) },
+	}))
 
 	start := time.Now()
 	res, err := e.client.Do(req)
 	dur := time.Since(start)
 	if err != nil {
 		// transport failure (DNS, timeout, connection refused): res is nil.
-		return Result{Err: err, Duration: dur}
+		return Result{Err: err, Duration: dur, Sent: sent.Load() && !errors.Is(err, errBlockedTarget)}
 	}
 	defer res.Body.Close()
 
@@ -230,8 +469,9 @@ func (e *Executor) Execute(task scheduler.Task) Result {
 			ResponseBody:          string(buf),
 			ResponseBodyTruncated: truncated,
 			RetryAfter:            retryAfterHint(res),
+			Sent:                  true,
 		}
 	}
 
-	return Result{StatusCode: res.StatusCode, Duration: dur}
+	return Result{StatusCode: res.StatusCode, Duration: dur, Sent: true}
 }
@@ -1,14 +1,19 @@
 package executor
 
 import (
+	"context"
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -35,6 +40,74 @@ func TestExecuteBlocksPrivateTargets(t *testing.T) {
 	if !strings.Contains(res.Err.Error(), "blocked dial to non-public address") {
 		t.Errorf("unexpected error: %v", res.Err)
 	}
+	if res.Unavailable() {
+		t.Error("a guarded dial is the target's address, not the host being down")
+	}
+}
+
+// Verifies which failures count as the host being down: no connection, or a
+// 5xx or 429 - not an error about the request itself.
+func TestResultUnavailable(t *testing.T) {
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	addr := srv.URL
+	e := NewExecutor()
+
+	for code, want := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusNotFound:            false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	} {
+		status.Store(int32(code))
+		if got := e.Execute(scheduler.Task{URL: addr}).Unavailable(); got != want {
+			t.Errorf("status %d: Unavailable() = %v, want %v", code, got, want)
+		}
+	}
+
+	status.Store(http.StatusOK)
+	if res := e.Execute(scheduler.Task{URL: addr + "/slow", TimeoutMs: 50}); res.Err == nil || !res.Unavailable() {
+		t.Errorf("a timeout should count as unavailable, got %v", res.Err)
+	}
+
+	// Requests that never reach the host.
+	for name, task := range map[string]scheduler.Task{
+		"unparseable url":  {URL: addr + "/%zz"},
+		"bad header value": {URL: addr, Headers: map[string]string{"X-Run": "1\r\nX-Injected: yes"}},
+		"invalid method":   {URL: addr, Method: "NOT A METHOD"},
+		"unknown scheme":   {URL: "ftp://example.com/"},
+		"unknown key":      {URL: addr, SigningKeyID: "gone"},
+	} {
+		res := e.Execute(task)
+		if res.Err == nil {
+			t.Errorf("%s: want an error", name)
+		} else if res.Unavailable() {
+			t.Errorf("%s: %v counted as the host being down", name, res.Err)
+		}
+		if res.Sent {
+			t.Errorf("%s: reported as sent", name)
+		}
+	}
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	if res := e.Execute(scheduler.Task{URL: tlsSrv.URL}); res.Err == nil || !res.Unavailable() {
+		t.Errorf("a failed TLS handshake should count as unavailable, got %v", res.Err)
+	}
+
+	srv.Close()
+	if !e.Execute(scheduler.Task{URL: addr}).Unavailable() {
+		t.Error("a refused connection should count as unavailable")
+	}
 }
 
 // Verifies the response body is captured (and truncation flagged) on non-2xx
@@ -121,6 +194,173 @@ func TestExecuteSignsRequest(t *testing.T) {
 		}
 	})
 
+	t.Run("a task's signing key signs in place of the global secret", func(t *testing.T) {
+		srv, hdr, gotBody := capture()
+		defer srv.Close()
+
+		rotated := time.Now().Add(-time.Minute)
+		key := scheduler.SigningKey{ID: "tenant-a", Secret: "old-secret"}
+		key.Rotate("new-secret", rotated, time.Hour)
+		e := NewExecutor()
+		e.signingSecret = secret
+		e.Keys = func(id string) (*scheduler.SigningKey, error) {
+			if id != key.ID {
+				return nil, nil
+			}
+			return &key, nil
+		}
+		res := e.Execute(scheduler.Task{ID: "t1", URL: srv.URL, Payload: "hi", SigningKeyID: "tenant-a"})
+		if res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+
+		ts := hdr.Get("X-Schedy-Timestamp")
+		sig := func(secret string) string {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(ts + "." + string(*gotBody)))
+			return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		if got, want := hdr.Get("X-Schedy-Signature"), sig("new-secret")+","+sig("old-secret"); got != want {
+			t.Errorf("mid-rotation signature=%q want %q", got, want)
+		}
+		if got := hdr.Get("X-Schedy-Key-Id"); got != "tenant-a" {
+			t.Errorf("X-Schedy-Key-Id=%q", got)
+		}
+
+		res = e.Execute(scheduler.Task{ID: "t2", URL: srv.URL, Payload: "hi", SigningKeyID: "retired"})
+		if res.Err == nil || !strings.Contains(res.Err.Error(), `signing key "retired" not found`) {
+			t.Fatalf("a missing key must fail the attempt, got %v", res.Err)
+		}
+		if res.Unavailable() {
+			t.Error("a missing key is not the host being down")
+		}
+	})
+
+	t.Run("a task can't claim a signing key through its headers", func(t *testing.T) {
+		srv, hdr, _ := capture()
+		defer srv.Close()
+
+		e := NewExecutor()
+		e.signingSecret = secret
+		res := e.Execute(scheduler.Task{URL: srv.URL, Headers: map[string]string{"X-Schedy-Key-Id": "tenant-a"}})
+		if res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+		if got := hdr.Get("X-Schedy-Key-Id"); got != "" {
+			t.Errorf("X-Schedy-Key-Id=%q, want none", got)
+		}
+	})
+
+	t.Run("standard webhooks scheme", func(t *testing.T) {
+		srv, hdr, gotBody := capture()
+		defer srv.Close()
+
+		e := NewExecutor()
+		e.signingSecret = secret
+		task := scheduler.Task{ID: "t1", URL: srv.URL, Payload: "hi", SigningScheme: scheduler.SchemeStandardWebhooks}
+		if res := e.Execute(task); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+
+		id, ts := hdr.Get("webhook-id"), hdr.Get("webhook-timestamp")
+		if id != "t1" || ts == "" {
+			t.Fatalf("webhook-id=%q webhook-timestamp=%q", id, ts)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(id + "." + ts + "." + string(*gotBody)))
+		if got, want := hdr.Get("webhook-signature"), "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("webhook-signature=%q want %q", got, want)
+		}
+		if got := hdr.Get("X-Schedy-Signature"); got != "" {
+			t.Errorf("X-Schedy-Signature=%q, want none in this scheme", got)
+		}
+
+		// The server default applies to a task that names no scheme, and a
+		// retry keeps the message id.
+		e.signingScheme = scheduler.SchemeStandardWebhooks
+		task.SigningScheme = ""
+		if res := e.Execute(task); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+		if got := hdr.Get("webhook-id"); got != id {
+			t.Errorf("webhook-id=%q on retry, want %q", got, id)
+		}
+
+		// A replay is a new message, and its retries share its id.
+		task.Replays = 1
+		for range 2 {
+			if res := e.Execute(task); res.Err != nil {
+				t.Fatalf("unexpected err: %v", res.Err)
+			}
+			if got := hdr.Get("webhook-id"); got != "t1_1" {
+				t.Errorf("webhook-id=%q after a replay, want %q", got, "t1_1")
+			}
+		}
+	})
+
+	t.Run("standard webhooks test vector", func(t *testing.T) {
+		// From the Standard Webhooks spec's reference implementations.
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		err := signStandardWebhooks(req, []byte(`{"test": 2432232314}`), "msg_p5jXN8AQM9LWM0D4loKWxJek", "1614265330",
+			[]string{"whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw", "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		const sig = "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+		if got := req.Header.Get("webhook-signature"); got != sig+" "+sig {
+			t.Errorf("webhook-signature=%q", got)
+		}
+
+		err = signStandardWebhooks(req, nil, "m", "1", []string{"whsec_not base64!"})
+		if !errors.Is(err, errSigningKey) {
+			t.Errorf("bad whsec_ secret: err=%v", err)
+		}
+	})
+
+	t.Run("ed25519 scheme", func(t *testing.T) {
+		srv, hdr, gotBody := capture()
+		defer srv.Close()
+
+		key, err := scheduler.NewEd25519Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewExecutor()
+		e.signingScheme = scheduler.SchemeEd25519
+		res := e.Execute(scheduler.Task{ID: "t1", URL: srv.URL, Payload: "hi"})
+		if !errors.Is(res.Err, errSigningKey) {
+			t.Fatalf("without a key, err=%v", res.Err)
+		}
+
+		e.Ed25519 = key
+		if res := e.Execute(scheduler.Task{ID: "t1", URL: srv.URL, Payload: "hi"}); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+		if got := hdr.Get("X-Schedy-Key-Id"); got != key.ID {
+			t.Errorf("X-Schedy-Key-Id=%q want %q", got, key.ID)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hdr.Get("X-Schedy-Signature"), "ed25519="))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := hdr.Get("X-Schedy-Timestamp") + "." + string(*gotBody)
+		if !ed25519.Verify(key.PrivateKey.Public().(ed25519.PublicKey), []byte(msg), sig) {
+			t.Error("signature does not verify against the public key")
+		}
+
+		// A task naming an HMAC key is signed with it, not the server's
+		// default ed25519.
+		e.Keys = func(id string) (*scheduler.SigningKey, error) {
+			return &scheduler.SigningKey{ID: id, Secret: secret}, nil
+		}
+		if res := e.Execute(scheduler.Task{ID: "t2", URL: srv.URL, Payload: "hi", SigningKeyID: "tenant-a"}); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+		if got := hdr.Get("X-Schedy-Signature"); !strings.HasPrefix(got, "sha256=") {
+			t.Errorf("X-Schedy-Signature=%q, want the HMAC key's", got)
+		}
+	})
+
 	t.Run("no signature headers without a secret", func(t *testing.T) {
 		srv, hdr, _ := capture()
 		defer srv.Close()
@@ -175,6 +415,58 @@ func TestExecuteMethodAndBody(t *testing.T) {
 	}
 }
 
+// Verifies a payload template is filled in per attempt - body strings, header
+// values and the url's query - and that an untemplated task is sent verbatim.
+func TestExecutePayloadTemplate(t *testing.T) {
+	var got struct {
+		query, header string
+		body          []byte
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.query = r.URL.Query().Get("at")
+		got.header = r.Header.Get("X-Run")
+		got.body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	scheduled := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	task := scheduler.Task{
+		ID:              "t1",
+		URL:             srv.URL + "/hook?at={{scheduled_at}}",
+		Headers:         map[string]string{"X-Run": "run {{run_number}}"},
+		Payload:         map[string]any{"id": "{{task_id}}", "n": "{{ attempt }}", "keep": 7},
+		ExecuteAt:       scheduled,
+		SeriesID:        "s1",
+		RunNumber:       3,
+		Attempts:        []scheduler.Attempt{{N: 1}},
+		PayloadTemplate: true,
+	}
+	if res := NewExecutor().Execute(task); res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if got.query != "2030-01-01T09:00:00Z" {
+		t.Errorf("query at = %q", got.query)
+	}
+	if got.header != "run 3" {
+		t.Errorf("X-Run = %q", got.header)
+	}
+	if want := `{"id":"t1","keep":7,"n":"2"}`; string(got.body) != want {
+		t.Errorf("body = %s, want %s", got.body, want)
+	}
+	if task.Payload.(map[string]any)["id"] != "{{task_id}}" {
+		t.Error("rendering changed the stored payload")
+	}
+
+	task.PayloadTemplate = false
+	task.URL = srv.URL + "/hook"
+	if res := NewExecutor().Execute(task); res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if want := `{"id":"{{task_id}}","keep":7,"n":"{{ attempt }}"}`; string(got.body) != want {
+		t.Errorf("untemplated body = %s, want %s", got.body, want)
+	}
+}
+
 func TestRetryAfterHint(t *testing.T) {
 	mk := func(code int, h string) *http.Response {
 		res := &http.Response{StatusCode: code, Header: http.Header{}}
@@ -221,6 +513,24 @@ func TestExecuteTimeout(t *testing.T) {
 	}
 }
 
+// A cancelled context cuts the request short, and the error says so, which is
+// how the runner tells a shutdown from a failed delivery.
+func TestExecuteContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	res := NewExecutor().ExecuteContext(ctx, scheduler.Task{URL: srv.URL, TimeoutMs: 5000})
+	if !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected a context.Canceled error, got %v", res.Err)
+	}
+}
+
 // Verifies deliveries identify themselves: default User-Agent (task-overridable)
 // and a spoof-proof X-Schedy-Task-Id, absent on id-less internal requests.
 func TestExecuteIdentificationHeaders(t *testing.T) {
@@ -0,0 +1,256 @@
+package executor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// tlsRule is the TLS a delivery to a host matching pattern is made with
+// (SCHEDY_TLS): a client certificate to present, a CA bundle to trust on top
+// of the system roots, a minimum version and an SNI name. The "*" rule is the
+// server-level default, and a host rule takes whatever it leaves unset from it
+// but the SNI name, which only a host rule can set.
+type tlsRule struct {
+	pattern    string
+	certFile   string
+	keyFile    string
+	caFile     string
+	minVersion uint16
+	serverName string
+}
+
+// matches reports whether the rule applies to host. "*" matches everything,
+// "*.example.com" any subdomain of example.com, and anything else only itself.
+func (r tlsRule) matches(host string) bool {
+	switch {
+	case r.pattern == "*":
+		return true
+	case strings.HasPrefix(r.pattern, "*."):
+		return strings.HasSuffix(host, r.pattern[1:])
+	default:
+		return host == r.pattern
+	}
+}
+
+// over returns r with every setting it leaves unset taken from def, except
+// server_name: one name is one host's, so no other rule inherits it.
+func (r tlsRule) over(def tlsRule) tlsRule {
+	if r.certFile == "" {
+		r.certFile, r.keyFile = def.certFile, def.keyFile
+	}
+	if r.caFile == "" {
+		r.caFile = def.caFile
+	}
+	if r.minVersion == 0 {
+		r.minVersion = def.minVersion
+	}
+	return r
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSRules reads SCHEDY_TLS: rules separated by ";", each a host pattern
+// followed by space-separated settings, e.g.
+//
+//	api.partner.com cert=/etc/schedy/partner.crt key=/etc/schedy/partner.key min_version=1.3; * ca=/etc/schedy/ca.pem
+//
+// A delivery uses the first host rule its url's host matches, over the "*"
+// rule if there is one.
+func parseTLSRules(s string) ([]tlsRule, error) {
+	var rules []tlsRule
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(s, ";") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		rule := tlsRule{pattern: strings.ToLower(fields[0])}
+		rest, _ := strings.CutPrefix(rule.pattern, "*.")
+		if strings.Contains(rule.pattern, "=") || (rule.pattern != "*" && (rest == "" || strings.Contains(rest, "*"))) {
+			return nil, fmt.Errorf("%q: invalid host pattern", fields[0])
+		}
+		if seen[rule.pattern] {
+			return nil, fmt.Errorf("%q: more than one rule", rule.pattern)
+		}
+		seen[rule.pattern] = true
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("%q: no settings", rule.pattern)
+		}
+		for _, f := range fields[1:] {
+			name, val, ok := strings.Cut(f, "=")
+			if !ok || val == "" {
+				return nil, fmt.Errorf("%q: %q is not name=value", rule.pattern, f)
+			}
+			switch name {
+			case "cert":
+				rule.certFile = val
+			case "key":
+				rule.keyFile = val
+			case "ca":
+				rule.caFile = val
+			case "min_version":
+				if rule.minVersion = tlsVersions[val]; rule.minVersion == 0 {
+					return nil, fmt.Errorf("%q: min_version: %q is not 1.0, 1.1, 1.2 or 1.3", rule.pattern, val)
+				}
+			case "server_name":
+				rule.serverName = val
+			default:
+				return nil, fmt.Errorf("%q: unknown setting %q", rule.pattern, name)
+			}
+		}
+		// On "*" a server_name would go out to, and be checked against, every
+		// host no rule names.
+		if rule.pattern == "*" && rule.serverName != "" {
+			return nil, fmt.Errorf("%q: server_name applies to a host rule only", rule.pattern)
+		}
+		if (rule.certFile == "") != (rule.keyFile == "") {
+			return nil, fmt.Errorf("%q: cert and key go together", rule.pattern)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// config reads the files r names into a tls.Config.
+func (r tlsRule) config() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: r.minVersion, ServerName: r.serverName}
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", r.pattern, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if r.caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", r.pattern, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%q: %s: no PEM certificates", r.pattern, r.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// tlsRoutes is the delivery client's transport when SCHEDY_TLS is set: it
+// sends each request through the transport for its host's rule. Each rule has
+// a transport, and so a connection pool, of its own, so a connection made
+// with one rule's certificate is never reused for another's host.
+type tlsRoutes struct {
+	base  *http.Transport
+	rules []tlsRule
+	cur   atomic.Pointer[tlsSet]
+}
+
+// tlsSet is the transports built from the rules' files at one load.
+type tlsSet struct {
+	def   *http.Transport // the "*" rule's, or base without one
+	hosts []tlsHost
+}
+
+type tlsHost struct {
+	rule      tlsRule
+	transport *http.Transport
+}
+
+func newTLSRoutes(base *http.Transport, rules []tlsRule) (*tlsRoutes, error) {
+	rt := &tlsRoutes{base: base, rules: rules}
+	if err := rt.load(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// load reads every rule's files afresh and swaps the new transports in. On an
+// error nothing changes.
+func (rt *tlsRoutes) load() error {
+	var def tlsRule
+	for _, r := range rt.rules {
+		if r.pattern == "*" {
+			def = r
+		}
+	}
+	transport := func(r tlsRule) (*http.Transport, error) {
+		cfg, err := r.config()
+		if err != nil {
+			return nil, err
+		}
+		t := rt.base.Clone()
+		t.TLSClientConfig = cfg
+		return t, nil
+	}
+
+	set := &tlsSet{def: rt.base}
+	if def.pattern != "" {
+		t, err := transport(def)
+		if err != nil {
+			return err
+		}
+		set.def = t
+	}
+	for _, r := range rt.rules {
+		if r.pattern == "*" {
+			continue
+		}
+		t, err := transport(r.over(def))
+		if err != nil {
+			return err
+		}
+		set.hosts = append(set.hosts, tlsHost{r, t})
+	}
+
+	// Requests in flight finish on the old transports; their idle connections
+	// are dropped so the next request to each host handshakes with the new
+	// settings.
+	if old := rt.cur.Swap(set); old != nil {
+		old.def.CloseIdleConnections()
+		for _, h := range old.hosts {
+			h.transport.CloseIdleConnections()
+		}
+	}
+	return nil
+}
+
+// RoundTrip sends req through the transport for its host.
+func (rt *tlsRoutes) RoundTrip(req *http.Request) (*http.Response, error) {
+	set := rt.cur.Load()
+	host := strings.ToLower(req.URL.Hostname())
+	for _, h := range set.hosts {
+		if h.rule.matches(host) {
+			return h.transport.RoundTrip(req)
+		}
+	}
+	return set.def.RoundTrip(req)
+}
+
+// HasTLS reports whether SCHEDY_TLS configured any rules, and so whether
+// ReloadTLS has anything to re-read.
+func (e *Executor) HasTLS() bool {
+	return e.tls != nil
+}
+
+// ReloadTLS re-reads the certificates, keys and CA bundles SCHEDY_TLS names,
+// so rotated files take effect without a restart. On an error the settings
+// already loaded stay in use. Without SCHEDY_TLS it does nothing.
+func (e *Executor) ReloadTLS() error {
+	if e.tls == nil {
+		return nil
+	}
+	return e.tls.load()
+}
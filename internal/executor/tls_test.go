@@ -0,0 +1,216 @@
+package executor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+func TestParseTLSRules(t *testing.T) {
+	rules, err := parseTLSRules("* ca=/ca.pem min_version=1.2; API.partner.com cert=/c.pem key=/k.pem min_version=1.3 server_name=partner.internal; ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("got %d rules", len(rules))
+	}
+	host := rules[1].over(rules[0])
+	want := tlsRule{pattern: "api.partner.com", certFile: "/c.pem", keyFile: "/k.pem", caFile: "/ca.pem", minVersion: tls.VersionTLS13, serverName: "partner.internal"}
+	if host != want {
+		t.Errorf("merged rule=%+v want %+v", host, want)
+	}
+	if !host.matches("api.partner.com") || host.matches("other.partner.com") {
+		t.Error("a plain pattern matches only its host")
+	}
+
+	// Each host keeps its own SNI name, and one without takes none from "*".
+	rules, err = parseTLSRules("a.example.com server_name=a.internal; b.example.com min_version=1.3; * ca=/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := rules[0].over(rules[2]); a.serverName != "a.internal" || a.caFile != "/ca.pem" {
+		t.Errorf("a.example.com: %+v", a)
+	}
+	if b := rules[1].over(rules[2]); b.serverName != "" || b.caFile != "/ca.pem" {
+		t.Errorf("b.example.com: %+v", b)
+	}
+	if b := rules[1].over(tlsRule{pattern: "*", serverName: "a.internal"}); b.serverName != "" {
+		t.Errorf("b.example.com inherited server_name %q", b.serverName)
+	}
+
+	for _, bad := range []string{
+		"api.partner.com",                 // no settings
+		"api.partner.com cert=/c.pem",     // cert without key
+		"api.partner.com ca",              // not name=value
+		"api.partner.com pin=abc",         // unknown setting
+		"api.partner.com min_version=1.4", // no such version
+		"*.*.com ca=/ca.pem",              // misplaced wildcard
+		"* ca=/a.pem; * ca=/b.pem",        // twice
+		"* server_name=partner.internal",  // one host's name for every host
+	} {
+		if _, err := parseTLSRules(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
+
+// pki writes a CA, and certificates it issued, to PEM files in dir.
+type pki struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newPKI(t *testing.T) *pki {
+	t.Helper()
+	p := &pki{dir: t.TempDir()}
+	p.ca, p.caKey = p.issue(t, "ca", &x509.Certificate{IsCA: true, KeyUsage: x509.KeyUsageCertSign, BasicConstraintsValid: true})
+	return p
+}
+
+// issue signs tpl with the CA (or itself, for the CA) and writes name.crt and
+// name.key.
+func (p *pki) issue(t *testing.T, name string, tpl *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	tpl.SerialNumber = big.NewInt(p.serial)
+	tpl.Subject = pkix.Name{CommonName: name}
+	tpl.NotBefore, tpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	parent, parentKey := p.ca, p.caKey
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.write(t, name+".crt", "CERTIFICATE", der)
+	p.write(t, name+".key", "PRIVATE KEY", keyDER)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func (p *pki) write(t *testing.T, name, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(p.dir, name), pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *pki) path(name string) string { return filepath.Join(p.dir, name) }
+
+// withTLS returns an executor whose deliveries go through the SCHEDY_TLS
+// rules in spec.
+func withTLS(t *testing.T, spec string) *Executor {
+	t.Helper()
+	rules, err := parseTLSRules(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewExecutor()
+	if e.tls, err = newTLSRoutes(e.client.Transport.(*http.Transport), rules); err != nil {
+		t.Fatal(err)
+	}
+	e.client.Transport = e.tls
+	return e
+}
+
+func TestExecuteMutualTLS(t *testing.T) {
+	p := newPKI(t)
+	// The server's certificate names partner.internal and not the address it
+	// is reached at, so it only verifies with the SNI override.
+	server, serverKey := p.issue(t, "server", &x509.Certificate{DNSNames: []string{"partner.internal"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	p.issue(t, "client", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(p.ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS13,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	task := scheduler.Task{URL: srv.URL, Method: http.MethodGet}
+
+	full := "127.0.0.1 cert=" + p.path("client.crt") + " key=" + p.path("client.key") + " server_name=partner.internal; * ca=" + p.path("ca.crt")
+
+	t.Run("client certificate, private CA and SNI", func(t *testing.T) {
+		if NewExecutor().HasTLS() || !withTLS(t, full).HasTLS() {
+			t.Error("HasTLS should report whether SCHEDY_TLS set rules")
+		}
+		if res := withTLS(t, full).Execute(task); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+	})
+
+	t.Run("missing pieces fail the handshake", func(t *testing.T) {
+		for name, spec := range map[string]string{
+			"no client cert":  "127.0.0.1 server_name=partner.internal; * ca=" + p.path("ca.crt"),
+			"no private CA":   "127.0.0.1 cert=" + p.path("client.crt") + " key=" + p.path("client.key") + " server_name=partner.internal",
+			"no SNI override": "127.0.0.1 cert=" + p.path("client.crt") + " key=" + p.path("client.key") + "; * ca=" + p.path("ca.crt"),
+			"other host only": "other.example.com cert=" + p.path("client.crt") + " key=" + p.path("client.key") + " server_name=partner.internal",
+		} {
+			if res := withTLS(t, spec).Execute(task); res.Err == nil {
+				t.Errorf("%s: want a TLS error", name)
+			}
+		}
+	})
+
+	t.Run("reload picks up rotated files", func(t *testing.T) {
+		e := withTLS(t, full)
+		if res := e.Execute(task); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+
+		// A client certificate from a CA the server doesn't trust, written
+		// over the old one.
+		other := newPKI(t)
+		other.issue(t, "client", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+		for _, f := range []string{"client.crt", "client.key"} {
+			data, _ := os.ReadFile(other.path(f))
+			os.WriteFile(p.path(f), data, 0o600)
+		}
+		if err := e.ReloadTLS(); err != nil {
+			t.Fatal(err)
+		}
+		if res := e.Execute(task); res.Err == nil {
+			t.Error("the reloaded certificate should be the one presented")
+		}
+
+		// A reload that can't read its files keeps what it had.
+		loaded := e.tls.cur.Load()
+		os.WriteFile(p.path("client.key"), []byte("garbage"), 0o600)
+		if err := e.ReloadTLS(); err == nil || !strings.Contains(err.Error(), "127.0.0.1") {
+			t.Errorf("reload err=%v, want one naming the rule", err)
+		}
+		if e.tls.cur.Load() != loaded {
+			t.Error("a failed reload replaced the loaded settings")
+		}
+	})
+}
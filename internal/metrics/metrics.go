@@ -14,6 +14,7 @@ import (
 	"io"
 	"math"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -31,9 +32,18 @@ var (
 	tasksFailed    atomic.Uint64
 )
 
-// tasksSkipped counts tasks retired without delivery for exceeding the staleness
-// limit - the visible cost of an outage, separate from delivery failures.
-var tasksSkipped atomic.Uint64
+// Reasons a task is retired without delivery.
+const (
+	SkipStale   = "stale"   // past SCHEDY_MAX_STALENESS
+	SkipExpired = "expired" // past its own expire_at or max_lateness
+)
+
+// Tasks retired without delivery, by reason - the visible cost of an outage,
+// separate from delivery failures.
+var (
+	tasksSkippedStale   atomic.Uint64
+	tasksSkippedExpired atomic.Uint64
+)
 
 // tasksReplayed counts finished tasks manually re-armed via the API.
 var tasksReplayed atomic.Uint64
@@ -42,17 +52,66 @@ var tasksReplayed atomic.Uint64
 // configured concurrency limit, it says whether the runner is saturated.
 var inflight atomic.Int64
 
+// paused is set while every delivery is paused for maintenance
+// (POST /admin/pause).
+var paused atomic.Bool
+
+// Circuit breakers (SCHEDY_BREAKER_THRESHOLD). Hosts are task input, so these
+// are totals across hosts; GET /admin/breakers says which hosts.
+var (
+	breakersOpen     atomic.Int64  // breakers not closed: open or probing
+	breakerTrips     atomic.Uint64 // closed or half-open -> open
+	deliveryDeferred atomic.Uint64 // deliveries put off by an open breaker
+)
+
+// destinations holds the per-rule limiter state, keyed by the rule's pattern
+// from SCHEDY_DESTINATION_LIMITS. Patterns are operator configuration, not task
+// input, so the label set is fixed at startup and small.
+var (
+	destMu       sync.Mutex
+	destinations = map[string]*destination{}
+)
+
+type destination struct {
+	waiting              atomic.Int64
+	throttledConcurrency atomic.Uint64
+	throttledRate        atomic.Uint64
+}
+
+// queues holds the per-queue runner state, keyed by the queue names declared
+// in SCHEDY_QUEUES. Like destination rules these are operator configuration, so
+// a client naming a fresh queue can't grow the label set.
+var (
+	queueMu sync.Mutex
+	queues  = map[string]*queueState{}
+)
+
+type queueState struct {
+	paused   atomic.Bool
+	inflight atomic.Int64
+}
+
 // deliveryDuration is the round-trip time of a delivery request.
 var deliveryDuration = newHistogram([]float64{
 	0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30,
 })
 
-// lateness is how far past its scheduled time a task actually fired. This is
-// the service level indicator: a healthy Schedy fires within a tick, and a
-// backlog shows up here long before it shows up as a failure.
-var lateness = newHistogram([]float64{
-	0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600,
-})
+// lateness is how far past its scheduled time a task actually fired, per task
+// priority. This is the service level indicator: a healthy Schedy fires within
+// a tick, and a backlog shows up here long before it shows up as a failure.
+// Split by priority, it also shows whether urgent work is jumping the backlog
+// as it should. Priorities are validated to a small fixed range, so the label
+// set stays small although the value comes from the task.
+var (
+	latenessMu sync.Mutex
+	lateness   = map[int]*histogram{0: newLateness()}
+)
+
+func newLateness() *histogram {
+	return newHistogram([]float64{
+		0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600,
+	})
+}
 
 // ObserveDelivery records one delivery attempt and its round-trip time.
 func ObserveDelivery(d time.Duration, ok bool) {
@@ -74,9 +133,14 @@ func ObserveTaskFinished(ok bool) {
 	}
 }
 
-// ObserveSkipped records a task retired without delivery for being too stale.
-func ObserveSkipped() {
-	tasksSkipped.Add(1)
+// ObserveSkipped records a task retired without delivery, for SkipStale or
+// SkipExpired.
+func ObserveSkipped(reason string) {
+	if reason == SkipExpired {
+		tasksSkippedExpired.Add(1)
+	} else {
+		tasksSkippedStale.Add(1)
+	}
 }
 
 // ObserveReplay records a finished task re-armed through the API.
@@ -89,10 +153,98 @@ func InflightAdd(delta int64) {
 	inflight.Add(delta)
 }
 
-// ObserveLateness records how late a task fired relative to its scheduled time.
-// Negative values (a timer firing a hair early) are clamped to zero.
-func ObserveLateness(d time.Duration) {
-	lateness.observe(max(d, 0))
+// RegisterDestination exports zeroed series for a destination limit rule, so a
+// rule that has never throttled anything is still visible.
+func RegisterDestination(rule string) {
+	dest(rule)
+}
+
+func dest(rule string) *destination {
+	destMu.Lock()
+	defer destMu.Unlock()
+	d, ok := destinations[rule]
+	if !ok {
+		d = &destination{}
+		destinations[rule] = d
+	}
+	return d
+}
+
+// DestinationWaitingAdd moves the gauge of deliveries held back by rule.
+func DestinationWaitingAdd(rule string, delta int64) {
+	dest(rule).waiting.Add(delta)
+}
+
+// ObserveThrottled records a delivery that had to wait on rule, for reason
+// "concurrency" or "rate".
+func ObserveThrottled(rule, reason string) {
+	d := dest(rule)
+	if reason == "rate" {
+		d.throttledRate.Add(1)
+	} else {
+		d.throttledConcurrency.Add(1)
+	}
+}
+
+// RegisterQueue exports series for a declared queue.
+func RegisterQueue(name string) {
+	queue(name)
+}
+
+func queue(name string) *queueState {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	q, ok := queues[name]
+	if !ok {
+		q = &queueState{}
+		queues[name] = q
+	}
+	return q
+}
+
+// QueueInflightAdd moves the gauge of name's deliveries in flight by delta.
+func QueueInflightAdd(name string, delta int64) {
+	queue(name).inflight.Add(delta)
+}
+
+// SetQueuePaused records whether name is paused.
+func SetQueuePaused(name string, paused bool) {
+	queue(name).paused.Store(paused)
+}
+
+// SetPaused records whether deliveries are paused for maintenance.
+func SetPaused(p bool) {
+	paused.Store(p)
+}
+
+// SetBreakersOpen sets the number of hosts whose breaker is not closed.
+func SetBreakersOpen(n int) {
+	breakersOpen.Store(int64(n))
+}
+
+// ObserveBreakerTrip records a breaker opening.
+func ObserveBreakerTrip() {
+	breakerTrips.Add(1)
+}
+
+// ObserveDeferred records a delivery put off because its host's breaker was
+// open.
+func ObserveDeferred() {
+	deliveryDeferred.Add(1)
+}
+
+// ObserveLateness records how late a task of the given priority fired relative
+// to its scheduled time. Negative values (a timer firing a hair early) are
+// clamped to zero.
+func ObserveLateness(priority int, d time.Duration) {
+	latenessMu.Lock()
+	h, ok := lateness[priority]
+	if !ok {
+		h = newLateness()
+		lateness[priority] = h
+	}
+	latenessMu.Unlock()
+	h.observe(max(d, 0))
 }
 
 // Snapshot is the store-derived state a scrape needs. It is read per scrape
@@ -104,6 +256,16 @@ type Snapshot struct {
 	ByStatus map[string]int
 	// Overdue counts pending tasks already past their execute_at.
 	Overdue int
+	// Queues breaks the same counts down by queue. Only queues registered
+	// with RegisterQueue are exported; tasks in any other queue are in the
+	// totals alone.
+	Queues map[string]QueueSnapshot
+}
+
+// QueueSnapshot is one queue's share of a Snapshot.
+type QueueSnapshot struct {
+	ByStatus map[string]int
+	Overdue  int
 }
 
 // Statuses fixes the label set and the output order of the task gauge. Exporting
@@ -113,9 +275,11 @@ var Statuses = []string{"pending", "running", "succeeded", "failed", "cancelled"
 
 // Write renders the current metrics in the Prometheus text exposition format.
 //
-// Label values here are all fixed literals from Statuses, so no escaping is
-// needed; that stops being true the moment a metric is labelled by anything
-// user-supplied (a task url, say), which is also why none is.
+// Label values here are fixed literals from Statuses, destination rule
+// patterns, declared queue names or task priorities - strings parsing restricts
+// to quote-free ones, and integers from a small validated range - so no escaping
+// is needed; that stops being true the moment a metric is labelled by anything
+// free-form (a task url, say), which is also why none is.
 func Write(w io.Writer, s Snapshot) error {
 	b := &writer{w: w}
 
@@ -135,8 +299,9 @@ func Write(w io.Writer, s Snapshot) error {
 	b.line("schedy_tasks_finished_total", `status="succeeded"`, float64(tasksSucceeded.Load()))
 	b.line("schedy_tasks_finished_total", `status="failed"`, float64(tasksFailed.Load()))
 
-	b.header("schedy_tasks_skipped_total", "counter", "Tasks retired without delivery for exceeding SCHEDY_MAX_STALENESS.")
-	b.line("schedy_tasks_skipped_total", `reason="stale"`, float64(tasksSkipped.Load()))
+	b.header("schedy_tasks_skipped_total", "counter", "Tasks retired without delivery: past SCHEDY_MAX_STALENESS (stale) or their own expire_at or max_lateness (expired).")
+	b.line("schedy_tasks_skipped_total", `reason="stale"`, float64(tasksSkippedStale.Load()))
+	b.line("schedy_tasks_skipped_total", `reason="expired"`, float64(tasksSkippedExpired.Load()))
 
 	b.header("schedy_tasks_replayed_total", "counter", "Finished tasks manually re-armed through the API.")
 	b.line("schedy_tasks_replayed_total", "", float64(tasksReplayed.Load()))
@@ -144,8 +309,96 @@ func Write(w io.Writer, s Snapshot) error {
 	b.header("schedy_deliveries_inflight", "gauge", "Deliveries currently executing. Compare against SCHEDY_MAX_CONCURRENT_DELIVERIES to spot saturation.")
 	b.line("schedy_deliveries_inflight", "", float64(inflight.Load()))
 
-	b.histogram("schedy_delivery_duration_seconds", "Round-trip time of delivery requests.", deliveryDuration)
-	b.histogram("schedy_task_lateness_seconds", "Delay between a task's execute_at and the moment it fired.", lateness)
+	b.header("schedy_paused", "gauge", "1 while every delivery is paused for maintenance through POST /admin/pause.")
+	pausedValue := 0.0
+	if paused.Load() {
+		pausedValue = 1
+	}
+	b.line("schedy_paused", "", pausedValue)
+
+	b.header("schedy_breakers_open", "gauge", "Hosts whose circuit breaker is open or half-open. GET /admin/breakers lists them.")
+	b.line("schedy_breakers_open", "", float64(breakersOpen.Load()))
+
+	b.header("schedy_breaker_trips_total", "counter", "Times a host's circuit breaker opened.")
+	b.line("schedy_breaker_trips_total", "", float64(breakerTrips.Load()))
+
+	b.header("schedy_deliveries_deferred_total", "counter", "Deliveries put off, without using a retry, because their host's circuit breaker was open.")
+	b.line("schedy_deliveries_deferred_total", "", float64(deliveryDeferred.Load()))
+
+	destMu.Lock()
+	rules := make([]string, 0, len(destinations))
+	for rule := range destinations {
+		rules = append(rules, rule)
+	}
+	destMu.Unlock()
+	sort.Strings(rules)
+
+	b.header("schedy_destination_waiting", "gauge", "Deliveries held back by a SCHEDY_DESTINATION_LIMITS rule, waiting for a slot or a rate token.")
+	for _, rule := range rules {
+		b.line("schedy_destination_waiting", fmt.Sprintf(`rule=%q`, rule), float64(dest(rule).waiting.Load()))
+	}
+
+	b.header("schedy_destination_throttled_total", "counter", "Deliveries that had to wait on a SCHEDY_DESTINATION_LIMITS rule, by the limit that held them.")
+	for _, rule := range rules {
+		d := dest(rule)
+		b.line("schedy_destination_throttled_total", fmt.Sprintf(`rule=%q,reason="concurrency"`, rule), float64(d.throttledConcurrency.Load()))
+		b.line("schedy_destination_throttled_total", fmt.Sprintf(`rule=%q,reason="rate"`, rule), float64(d.throttledRate.Load()))
+	}
+
+	queueMu.Lock()
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	queueMu.Unlock()
+	sort.Strings(names)
+
+	b.header("schedy_queue_tasks", "gauge", "Tasks currently in each lifecycle status, per queue declared in SCHEDY_QUEUES.")
+	for _, name := range names {
+		for _, status := range Statuses {
+			b.line("schedy_queue_tasks", fmt.Sprintf(`queue=%q,status=%q`, name, status), float64(s.Queues[name].ByStatus[status]))
+		}
+	}
+
+	b.header("schedy_queue_overdue", "gauge", "Pending tasks whose execute_at has already passed, per queue.")
+	for _, name := range names {
+		b.line("schedy_queue_overdue", fmt.Sprintf(`queue=%q`, name), float64(s.Queues[name].Overdue))
+	}
+
+	b.header("schedy_queue_paused", "gauge", "1 while a queue is paused through POST /queues/{name}/pause.")
+	for _, name := range names {
+		v := 0.0
+		if queue(name).paused.Load() {
+			v = 1
+		}
+		b.line("schedy_queue_paused", fmt.Sprintf(`queue=%q`, name), v)
+	}
+
+	b.header("schedy_queue_inflight", "gauge", "Deliveries currently executing, per queue.")
+	for _, name := range names {
+		b.line("schedy_queue_inflight", fmt.Sprintf(`queue=%q`, name), float64(queue(name).inflight.Load()))
+	}
+
+	b.header("schedy_delivery_duration_seconds", "histogram", "Round-trip time of delivery requests.")
+	b.histogram("schedy_delivery_duration_seconds", "", deliveryDuration)
+
+	// Priority 0, the default, is always exported; any other from its first
+	// observation on.
+	latenessMu.Lock()
+	priorities := make([]int, 0, len(lateness))
+	for p := range lateness {
+		priorities = append(priorities, p)
+	}
+	latenessMu.Unlock()
+	sort.Ints(priorities)
+
+	b.header("schedy_task_lateness_seconds", "histogram", "Delay between a task's execute_at and the moment it fired, by task priority.")
+	for _, p := range priorities {
+		latenessMu.Lock()
+		h := lateness[p]
+		latenessMu.Unlock()
+		b.histogram("schedy_task_lateness_seconds", fmt.Sprintf(`priority="%d"`, p), h)
+	}
 
 	return b.err
 }
@@ -156,11 +409,24 @@ func Reset() {
 	deliveriesFail.Store(0)
 	tasksSucceeded.Store(0)
 	tasksFailed.Store(0)
-	tasksSkipped.Store(0)
+	tasksSkippedStale.Store(0)
+	tasksSkippedExpired.Store(0)
 	tasksReplayed.Store(0)
 	inflight.Store(0)
+	paused.Store(false)
+	breakersOpen.Store(0)
+	breakerTrips.Store(0)
+	deliveryDeferred.Store(0)
+	destMu.Lock()
+	clear(destinations)
+	destMu.Unlock()
+	queueMu.Lock()
+	clear(queues)
+	queueMu.Unlock()
 	deliveryDuration.reset()
-	lateness.reset()
+	latenessMu.Lock()
+	lateness = map[int]*histogram{0: newLateness()}
+	latenessMu.Unlock()
 }
 
 // histogram is a fixed-bucket cumulative histogram.
@@ -222,19 +488,24 @@ func (b *writer) line(name, labels string, v float64) {
 	b.printf("%s%s %s\n", name, labels, format(v))
 }
 
-func (b *writer) histogram(name, help string, h *histogram) {
-	b.header(name, "histogram", help)
+// histogram writes one histogram's series, each carrying labels ("" for
+// none). The header is the caller's, so several label sets can share one.
+func (b *writer) histogram(name, labels string, h *histogram) {
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
 
 	var cumulative uint64
 	for i, bound := range h.upper {
 		cumulative += h.buckets[i].Load()
-		b.line(name+"_bucket", fmt.Sprintf(`le="%s"`, format(bound)), float64(cumulative))
+		b.line(name+"_bucket", fmt.Sprintf(`%sle="%s"`, prefix, format(bound)), float64(cumulative))
 	}
 	cumulative += h.buckets[len(h.upper)].Load()
-	b.line(name+"_bucket", `le="+Inf"`, float64(cumulative))
+	b.line(name+"_bucket", prefix+`le="+Inf"`, float64(cumulative))
 
-	b.line(name+"_sum", "", float64(h.sumNs.Load())/float64(time.Second))
-	b.line(name+"_count", "", float64(h.count.Load()))
+	b.line(name+"_sum", labels, float64(h.sumNs.Load())/float64(time.Second))
+	b.line(name+"_count", labels, float64(h.count.Load()))
 }
 
 // format renders a value the way Prometheus expects: integers plain, fractions
@@ -93,11 +93,11 @@ func TestLatenessClampsNegative(t *testing.T) {
 	Reset()
 	t.Cleanup(Reset)
 
-	ObserveLateness(-5 * time.Second)
+	ObserveLateness(0, -5*time.Second)
 	out := render(t, Snapshot{})
 
-	assert.Equal(t, "0", out["schedy_task_lateness_seconds_sum"])
-	assert.Equal(t, "1", out[`schedy_task_lateness_seconds_bucket{le="0.1"}`])
+	assert.Equal(t, "0", out[`schedy_task_lateness_seconds_sum{priority="0"}`])
+	assert.Equal(t, "1", out[`schedy_task_lateness_seconds_bucket{priority="0",le="0.1"}`])
 }
 
 // The runner observes from one goroutine per task, so the counters are written
@@ -112,22 +112,23 @@ func TestConcurrentObserve(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			ObserveDelivery(time.Millisecond, true)
-			ObserveLateness(time.Second)
+			ObserveLateness(0, time.Second)
 		}()
 	}
 	wg.Wait()
 
 	out := render(t, Snapshot{})
 	assert.Equal(t, "100", out[`schedy_deliveries_total{result="success"}`])
-	assert.Equal(t, "100", out["schedy_task_lateness_seconds_count"])
+	assert.Equal(t, "100", out[`schedy_task_lateness_seconds_count{priority="0"}`])
 }
 
 func TestSkippedAndInflight(t *testing.T) {
 	Reset()
 	t.Cleanup(Reset)
 
-	ObserveSkipped()
-	ObserveSkipped()
+	ObserveSkipped(SkipStale)
+	ObserveSkipped(SkipStale)
+	ObserveSkipped(SkipExpired)
 	ObserveReplay()
 	InflightAdd(3)
 	InflightAdd(-1)
@@ -135,6 +136,95 @@ func TestSkippedAndInflight(t *testing.T) {
 	out := render(t, Snapshot{})
 
 	assert.Equal(t, "2", out[`schedy_tasks_skipped_total{reason="stale"}`])
+	assert.Equal(t, "1", out[`schedy_tasks_skipped_total{reason="expired"}`])
 	assert.Equal(t, "1", out["schedy_tasks_replayed_total"])
 	assert.Equal(t, "2", out["schedy_deliveries_inflight"], "the gauge tracks deltas both ways")
 }
+
+func TestPausedGauge(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	assert.Equal(t, "0", render(t, Snapshot{})["schedy_paused"])
+	SetPaused(true)
+	assert.Equal(t, "1", render(t, Snapshot{})["schedy_paused"])
+	SetPaused(false)
+	assert.Equal(t, "0", render(t, Snapshot{})["schedy_paused"])
+}
+
+func TestDestinationSeries(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	RegisterDestination("idle.example.com")
+	ObserveThrottled("api.partner.com", "concurrency")
+	ObserveThrottled("api.partner.com", "rate")
+	ObserveThrottled("api.partner.com", "rate")
+	DestinationWaitingAdd("api.partner.com", 2)
+	DestinationWaitingAdd("api.partner.com", -1)
+
+	out := render(t, Snapshot{})
+
+	assert.Equal(t, "1", out[`schedy_destination_waiting{rule="api.partner.com"}`])
+	assert.Equal(t, "1", out[`schedy_destination_throttled_total{rule="api.partner.com",reason="concurrency"}`])
+	assert.Equal(t, "2", out[`schedy_destination_throttled_total{rule="api.partner.com",reason="rate"}`])
+	assert.Equal(t, "0", out[`schedy_destination_waiting{rule="idle.example.com"}`], "a registered rule is exported before it throttles anything")
+}
+
+func TestBreakerSeries(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	SetBreakersOpen(2)
+	ObserveBreakerTrip()
+	ObserveDeferred()
+	ObserveDeferred()
+
+	out := render(t, Snapshot{})
+
+	assert.Equal(t, "2", out["schedy_breakers_open"])
+	assert.Equal(t, "1", out["schedy_breaker_trips_total"])
+	assert.Equal(t, "2", out["schedy_deliveries_deferred_total"])
+}
+
+func TestQueueSeries(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	RegisterQueue("default")
+	RegisterQueue("billing")
+	SetQueuePaused("billing", true)
+	QueueInflightAdd("default", 2)
+	QueueInflightAdd("default", -1)
+
+	out := render(t, Snapshot{Queues: map[string]QueueSnapshot{
+		"billing":  {ByStatus: map[string]int{"pending": 5}, Overdue: 2},
+		"adhoc-42": {ByStatus: map[string]int{"pending": 1}},
+	}})
+
+	assert.Equal(t, "5", out[`schedy_queue_tasks{queue="billing",status="pending"}`])
+	assert.Equal(t, "0", out[`schedy_queue_tasks{queue="default",status="pending"}`])
+	assert.Equal(t, "2", out[`schedy_queue_overdue{queue="billing"}`])
+	assert.Equal(t, "1", out[`schedy_queue_paused{queue="billing"}`])
+	assert.Equal(t, "0", out[`schedy_queue_paused{queue="default"}`])
+	assert.Equal(t, "1", out[`schedy_queue_inflight{queue="default"}`])
+	assert.NotContains(t, out, `schedy_queue_tasks{queue="adhoc-42",status="pending"}`, "only declared queues get series")
+}
+
+func TestLatenessByPriority(t *testing.T) {
+	Reset()
+	t.Cleanup(Reset)
+
+	out := render(t, Snapshot{})
+	assert.Equal(t, "0", out[`schedy_task_lateness_seconds_count{priority="0"}`], "the default priority is exported before anything fires")
+	assert.NotContains(t, out, `schedy_task_lateness_seconds_count{priority="9"}`)
+
+	ObserveLateness(9, 200*time.Millisecond)
+	ObserveLateness(0, time.Hour)
+
+	out = render(t, Snapshot{})
+	assert.Equal(t, "1", out[`schedy_task_lateness_seconds_count{priority="9"}`])
+	assert.Equal(t, "1", out[`schedy_task_lateness_seconds_bucket{priority="9",le="0.25"}`])
+	assert.Equal(t, "0", out[`schedy_task_lateness_seconds_bucket{priority="0",le="0.25"}`])
+	assert.Equal(t, "3600", out[`schedy_task_lateness_seconds_sum{priority="0"}`])
+}
@@ -7,11 +7,6 @@ import (
 	"github.com/ksamirdev/schedy/internal/scheduler"
 )
 
-var (
-	timeFunc  = time.Now
-	sleepFunc = time.Sleep
-)
-
 // maxBackoff caps the exponential delay so a large retry count can't wait for
 // hours. It is not user-facing (see issue #28's lean cut).
 // ponytail: fixed cap, expose as a knob only if someone needs a longer horizon.
@@ -25,7 +20,6 @@ type attemptStrategy struct {
 
 type attempt struct {
 	strategy attemptStrategy
-	lastTime time.Time
 	count    int // number of attempted retries
 	// hint is the server-requested wait (Retry-After) for the next retry only.
 	// It acts as a floor under the computed delay: backing off harder than the
@@ -35,8 +29,8 @@ type attempt struct {
 }
 
 // serverHint records the wait the server asked for before the next retry.
-// Capped at maxBackoff so a hostile or misconfigured endpoint can't park a
-// worker slot for hours.
+// Capped at maxBackoff so a hostile or misconfigured endpoint can't push a
+// retry out for hours.
 func (a *attempt) serverHint(d time.Duration) {
 	if d > maxBackoff {
 		d = maxBackoff
@@ -44,31 +38,31 @@ func (a *attempt) serverHint(d time.Duration) {
 	a.hint = d
 }
 
-func newAttempt(rcount, interval int, mode scheduler.RetryMode) *attempt {
+// newAttempt picks up a task's retry strategy with used retries already spent,
+// so a run resumed from the store continues its backoff rather than restarting
+// it.
+func newAttempt(rcount, interval int, mode scheduler.RetryMode, used int) *attempt {
 	return &attempt{
 		strategy: attemptStrategy{
 			retries:  rcount,
 			interval: time.Duration(interval) * time.Millisecond,
 			mode:     mode,
 		},
+		count: used,
 	}
 }
 
-func (a *attempt) next() bool {
-	if a.shouldRetry() {
-		d := a.delay()
-		if !a.lastTime.IsZero() {
-			timeSince := timeFunc().Sub(a.lastTime)
-			if timeSince < d {
-				sleepFunc(d - timeSince)
-			}
-		}
-		a.lastTime = timeFunc()
-		a.count++
-		a.hint = 0
-		return true
+// next spends one retry and returns how long to wait before firing it, or
+// false once the retries are exhausted. The caller does the waiting - by
+// writing the retry back to the store, not by sleeping on a delivery slot.
+func (a *attempt) next() (time.Duration, bool) {
+	if !a.shouldRetry() {
+		return 0, false
 	}
-	return false
+	d := a.delay()
+	a.count++
+	a.hint = 0
+	return d, true
 }
 
 // delay returns how long to wait before the next retry. Fixed mode returns the
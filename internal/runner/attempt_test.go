@@ -7,73 +7,80 @@ import (
 	"github.com/ksamirdev/schedy/internal/scheduler"
 )
 
-// captureSleeps swaps sleepFunc/timeFunc so next() runs instantly and records
-// every requested delay. lastTime spacing is neutralised by advancing the clock
-// past each delay before the following attempt.
-func captureSleeps(t *testing.T) *[]time.Duration {
-	t.Helper()
-	var slept []time.Duration
-	now := time.Unix(0, 0)
-	origSleep, origTime := sleepFunc, timeFunc
-	sleepFunc = func(d time.Duration) { slept = append(slept, d); now = now.Add(d) }
-	timeFunc = func() time.Time { return now }
-	t.Cleanup(func() { sleepFunc, timeFunc = origSleep, origTime })
-	return &slept
+// delays spends every retry a has and returns the waits it handed out.
+func delays(a *attempt) []time.Duration {
+	var out []time.Duration
+	for {
+		d, ok := a.next()
+		if !ok {
+			return out
+		}
+		out = append(out, d)
+	}
 }
 
 func TestFixedDelay(t *testing.T) {
-	slept := captureSleeps(t)
-	a := newAttempt(3, 100, scheduler.RetryFixed)
-	for a.next() {
+	got := delays(newAttempt(3, 100, scheduler.RetryFixed, 0))
+	if len(got) != 3 {
+		t.Fatalf("got %d retries, want 3", len(got))
 	}
-	// First next() sets lastTime with no sleep; the rest wait the fixed interval.
-	for i, d := range *slept {
+	for i, d := range got {
 		if d != 100*time.Millisecond {
-			t.Fatalf("sleep %d = %v, want 100ms", i, d)
+			t.Fatalf("delay %d = %v, want 100ms", i, d)
 		}
 	}
 }
 
 func TestExponentialFullJitterBounds(t *testing.T) {
-	slept := captureSleeps(t)
-	a := newAttempt(20, 100, scheduler.RetryExponential)
-	for a.next() {
-	}
-	// The first delay() (count=0) fires with lastTime zero, so no sleep is
-	// recorded for it; recorded sleep i therefore has count=i+1 and is jittered
-	// in [0, min(100ms<<(i+1), cap)].
+	got := delays(newAttempt(20, 100, scheduler.RetryExponential, 0))
+	// Retry i is jittered in [0, min(100ms<<i, cap)].
 	base := 100 * time.Millisecond
-	for i, d := range *slept {
-		ceil := base << (i + 1)
+	for i, d := range got {
+		ceil := base << i
 		if ceil <= 0 || ceil > maxBackoff {
 			ceil = maxBackoff
 		}
 		if d < 0 || d > ceil {
 			t.Fatalf("delay %d = %v, want within [0,%v]", i, d, ceil)
 		}
-		if d > maxBackoff {
-			t.Fatalf("delay %d = %v exceeds cap %v", i, d, maxBackoff)
+	}
+}
+
+// A run resumed from the store carries on from the retries it already spent:
+// the budget is not refilled, and the backoff keeps growing from where it was.
+func TestResumedAttemptContinues(t *testing.T) {
+	a := newAttempt(5, 100, scheduler.RetryExponential, 3)
+	got := delays(a)
+	if len(got) != 2 {
+		t.Fatalf("got %d retries, want the 2 left of 5", len(got))
+	}
+	for i, d := range got {
+		if ceil := 100 * time.Millisecond << (3 + i); d > ceil {
+			t.Fatalf("delay %d = %v, want within [0,%v]", i, d, ceil)
 		}
 	}
+
+	if _, ok := newAttempt(2, 100, scheduler.RetryFixed, 2).next(); ok {
+		t.Fatal("an exhausted budget must not retry")
+	}
 }
 
 func TestServerHintFloorsDelay(t *testing.T) {
-	slept := captureSleeps(t)
-	a := newAttempt(2, 100, scheduler.RetryFixed)
-	a.next() // first retry: lastTime zero, no sleep recorded
-
+	a := newAttempt(2, 100, scheduler.RetryFixed, 0)
 	a.serverHint(3 * time.Second)
-	a.next()
-	if got := (*slept)[len(*slept)-1]; got != 3*time.Second {
-		t.Fatalf("hinted delay = %v, want 3s", got)
+	if d, _ := a.next(); d != 3*time.Second {
+		t.Fatalf("hinted delay = %v, want 3s", d)
 	}
 	if a.hint != 0 {
 		t.Fatalf("hint not consumed after next()")
 	}
+	if d, _ := a.next(); d != 100*time.Millisecond {
+		t.Fatalf("delay after the hint = %v, want 100ms", d)
+	}
 }
 
 func TestServerHintCappedAtMaxBackoff(t *testing.T) {
-	a := newAttempt(1, 100, scheduler.RetryFixed)
+	a := newAttempt(1, 100, scheduler.RetryFixed, 0)
 	a.serverHint(2 * time.Hour)
 	if a.hint != maxBackoff {
 		t.Fatalf("hint = %v, want cap %v", a.hint, maxBackoff)
@@ -81,13 +88,9 @@ func TestServerHintCappedAtMaxBackoff(t *testing.T) {
 }
 
 func TestServerHintBelowComputedDelayIgnored(t *testing.T) {
-	slept := captureSleeps(t)
-	a := newAttempt(2, 100, scheduler.RetryFixed)
-	a.next()
-
+	a := newAttempt(2, 100, scheduler.RetryFixed, 0)
 	a.serverHint(10 * time.Millisecond) // below the 100ms interval: floor, not override
-	a.next()
-	if got := (*slept)[len(*slept)-1]; got != 100*time.Millisecond {
-		t.Fatalf("delay = %v, want 100ms", got)
+	if d, _ := a.next(); d != 100*time.Millisecond {
+		t.Fatalf("delay = %v, want 100ms", d)
 	}
 }
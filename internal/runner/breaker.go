@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/metrics"
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// probeWait bounds how long a delivery turned away by a half-open breaker
+// waits before asking again, so a quick probe doesn't leave the backlog
+// parked for a whole cool-down.
+const probeWait = 5 * time.Second
+
+type breaker struct {
+	state    scheduler.BreakerState
+	failures int
+	until    time.Time // open: when the cool-down ends
+}
+
+// breakers keeps a circuit breaker per host (SCHEDY_BREAKER_THRESHOLD): after
+// threshold consecutive failures a host is opened, and its deliveries are
+// deferred in the store rather than spent against an endpoint that is down.
+//
+// Only hosts with failures have an entry - a success deletes it - so the map
+// is as large as the set of hosts currently misbehaving, not every host ever
+// seen. A zero threshold disables the lot.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	byHost map[string]*breaker
+}
+
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{threshold: threshold, cooldown: cooldown, byHost: make(map[string]*breaker)}
+}
+
+// breakerHost is what breakers are keyed by: the host and port a task's url
+// points at. Unlike destination limits this ignores a task's declared
+// destination - what fails is an endpoint, not a budget.
+func breakerHost(t scheduler.Task) string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// allow reports whether a delivery to host may go out now. When it may not, it
+// returns when to try again. An open breaker whose cool-down has ended turns
+// half-open and lets this caller through as the probe.
+func (b *breakers) allow(host string, now time.Time) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.byHost[host]
+	if !ok {
+		return true, time.Time{}
+	}
+	switch br.state {
+	case scheduler.BreakerOpen:
+		if now.Before(br.until) {
+			return false, br.until
+		}
+		br.state = scheduler.BreakerHalfOpen
+		b.publish()
+		return true, time.Time{}
+	case scheduler.BreakerHalfOpen:
+		return false, now.Add(min(b.cooldown, probeWait))
+	}
+	return true, time.Time{}
+}
+
+// record feeds a delivery outcome to host's breaker. A delivery that reached
+// the host closes it, whatever state it was in; one that found it down counts
+// toward opening it, and a failed probe opens it again straight away.
+func (b *breakers) record(host string, now time.Time, down bool) {
+	if b.threshold == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.byHost[host]
+	if !down {
+		if ok {
+			delete(b.byHost, host)
+			b.publish()
+		}
+		return
+	}
+	if !ok {
+		br = &breaker{state: scheduler.BreakerClosed}
+		b.byHost[host] = br
+	}
+	br.failures++
+	if br.state == scheduler.BreakerHalfOpen || (br.state == scheduler.BreakerClosed && br.failures >= b.threshold) {
+		br.state = scheduler.BreakerOpen
+		br.until = now.Add(b.cooldown)
+		metrics.ObserveBreakerTrip()
+		b.publish()
+	}
+}
+
+// unsent is record for a delivery that never went out to host - it couldn't
+// be built or signed - and so says nothing about it: the breaker neither
+// counts it nor closes. A half-open breaker gets its probe back, so the next
+// delivery to the host probes in its place.
+func (b *breakers) unsent(host string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br, ok := b.byHost[host]; ok && br.state == scheduler.BreakerHalfOpen {
+		br.state = scheduler.BreakerOpen
+		br.until = now
+	}
+}
+
+// reset closes host's breaker by hand, reporting whether it had one.
+func (b *breakers) reset(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.byHost[host]; !ok {
+		return false
+	}
+	delete(b.byHost, host)
+	b.publish()
+	return true
+}
+
+// list reports every host with a breaker entry, sorted by host.
+func (b *breakers) list() []scheduler.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]scheduler.BreakerStatus, 0, len(b.byHost))
+	for host, br := range b.byHost {
+		s := scheduler.BreakerStatus{Host: host, State: br.state, Failures: br.failures}
+		if br.state == scheduler.BreakerOpen {
+			until := br.until
+			s.RetryAt = &until
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// publish updates the not-closed gauge. b.mu must be held.
+func (b *breakers) publish() {
+	n := 0
+	for _, br := range b.byHost {
+		if br.state != scheduler.BreakerClosed {
+			n++
+		}
+	}
+	metrics.SetBreakersOpen(n)
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerLifecycle(t *testing.T) {
+	b := newBreakers(3, time.Minute)
+	now := time.Now()
+	const host = "api.example.com"
+
+	// Failures below the threshold let deliveries through.
+	b.record(host, now, true)
+	b.record(host, now, true)
+	ok, _ := b.allow(host, now)
+	assert.True(t, ok)
+
+	// The threshold opens it: deliveries are turned away until the cool-down
+	// ends.
+	b.record(host, now, true)
+	ok, retryAt := b.allow(host, now.Add(time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, now.Add(time.Minute), retryAt)
+
+	// After the cool-down, exactly one caller gets through as the probe.
+	later := now.Add(time.Minute)
+	ok, _ = b.allow(host, later)
+	assert.True(t, ok, "the probe goes through")
+	ok, retryAt = b.allow(host, later)
+	assert.False(t, ok, "everyone else waits on the probe")
+	assert.Equal(t, later.Add(probeWait), retryAt)
+
+	// A failed probe opens it straight away, for another cool-down.
+	b.record(host, later, true)
+	ok, retryAt = b.allow(host, later)
+	assert.False(t, ok)
+	assert.Equal(t, later.Add(time.Minute), retryAt)
+
+	// A successful probe closes it and forgets the host.
+	ok, _ = b.allow(host, later.Add(time.Minute))
+	require.True(t, ok)
+	b.record(host, later.Add(time.Minute), false)
+	assert.Empty(t, b.list())
+	ok, _ = b.allow(host, later.Add(time.Minute))
+	assert.True(t, ok)
+}
+
+func TestBreakerSuccessResetsTheRun(t *testing.T) {
+	b := newBreakers(2, time.Minute)
+	now := time.Now()
+	b.record("h", now, true)
+	b.record("h", now, false)
+	b.record("h", now, true)
+	ok, _ := b.allow("h", now)
+	assert.True(t, ok, "failures only count while consecutive")
+}
+
+func TestBreakerListAndReset(t *testing.T) {
+	b := newBreakers(1, time.Minute)
+	now := time.Now()
+	b.record("b.example.com", now, true)
+	b.record("a.example.com:8443", now, true)
+
+	list := b.list()
+	require.Len(t, list, 2)
+	assert.Equal(t, "a.example.com:8443", list[0].Host)
+	assert.Equal(t, scheduler.BreakerOpen, list[0].State)
+	assert.Equal(t, 1, list[0].Failures)
+	require.NotNil(t, list[0].RetryAt)
+	assert.Equal(t, now.Add(time.Minute), *list[0].RetryAt)
+
+	assert.True(t, b.reset("b.example.com"))
+	assert.False(t, b.reset("b.example.com"), "already closed")
+	ok, _ := b.allow("b.example.com", now)
+	assert.True(t, ok)
+	assert.Len(t, b.list(), 1)
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreakers(0, time.Minute)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		b.record("h", now, true)
+	}
+	ok, _ := b.allow("h", now)
+	assert.True(t, ok)
+	assert.Empty(t, b.list())
+}
+
+func TestBreakerHost(t *testing.T) {
+	assert.Equal(t, "api.example.com:8443", breakerHost(scheduler.Task{URL: "https://API.example.com:8443/hook"}))
+	assert.Equal(t, "api.example.com", breakerHost(scheduler.Task{URL: "https://api.example.com/hook", Destination: "billing"}),
+		"a declared destination doesn't change the host")
+}
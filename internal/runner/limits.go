@@ -0,0 +1,260 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/metrics"
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// limitRule caps the deliveries to every destination matching pattern
+// (SCHEDY_DESTINATION_LIMITS). Each destination gets its own cap and bucket:
+// a rule describes a limit, not a shared pool.
+type limitRule struct {
+	pattern    string
+	concurrent int     // deliveries in flight at once; 0 is uncapped
+	rate       float64 // deliveries per second; 0 is unlimited
+	burst      int     // deliveries the bucket can hold when idle
+}
+
+// matches reports whether the rule applies to destination key. "*" matches
+// everything, "*.example.com" any subdomain of example.com, and anything else
+// only itself.
+func (r limitRule) matches(key string) bool {
+	switch {
+	case r.pattern == "*":
+		return true
+	case strings.HasPrefix(r.pattern, "*."):
+		return strings.HasSuffix(key, r.pattern[1:])
+	default:
+		return key == r.pattern
+	}
+}
+
+// parseLimits reads SCHEDY_DESTINATION_LIMITS: rules separated by ";", each a
+// destination pattern followed by space-separated settings, e.g.
+//
+//	api.partner.com concurrency=5 rate=10/s; *.example.com rate=100/m burst=20
+//
+// A task is held to the first rule its destination matches.
+func parseLimits(s string) ([]limitRule, error) {
+	var rules []limitRule
+	for _, raw := range strings.Split(s, ";") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		rule := limitRule{pattern: strings.ToLower(fields[0]), burst: 1}
+		if !validPattern(rule.pattern) {
+			return nil, fmt.Errorf("%q: invalid destination pattern", fields[0])
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("%q: no concurrency or rate set", rule.pattern)
+		}
+		for _, f := range fields[1:] {
+			name, val, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("%q: %q is not name=value", rule.pattern, f)
+			}
+			var err error
+			switch name {
+			case "concurrency":
+				rule.concurrent, err = positiveInt(val)
+			case "burst":
+				rule.burst, err = positiveInt(val)
+			case "rate":
+				rule.rate, err = parseRate(val)
+			default:
+				err = fmt.Errorf("unknown setting %q", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%q: %s: %w", rule.pattern, name, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// validPattern accepts "*", "*.<suffix>" and plain keys. Patterns become metric
+// labels, so quotes and backslashes are refused along with misplaced wildcards.
+func validPattern(p string) bool {
+	if strings.ContainsAny(p, `"\=`) {
+		return false
+	}
+	rest, _ := strings.CutPrefix(p, "*.")
+	return p == "*" || (rest != "" && !strings.Contains(rest, "*"))
+}
+
+func positiveInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive integer", s)
+	}
+	return n, nil
+}
+
+// parseRate reads "<n>/s", "<n>/m" or "<n>/h" as deliveries per second.
+func parseRate(s string) (float64, error) {
+	num, unit, _ := strings.Cut(s, "/")
+	per := map[string]float64{"s": 1, "m": 60, "h": 3600}[unit]
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || per == 0 || n <= 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf(`%q is not a rate like "10/s", "100/m" or "500/h"`, s)
+	}
+	return n / per, nil
+}
+
+// destinationKey is what limits group a task's deliveries by: its declared
+// destination, or else the host its url points at.
+func destinationKey(t scheduler.Task) string {
+	if t.Destination != "" {
+		return strings.ToLower(t.Destination)
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// limits hands out the limiter for each destination a rule covers, creating it
+// on first use.
+//
+// ponytail: limiters are never evicted, so a "*" rule keeps one per host ever
+// delivered to. Fine for the hosts a scheduler talks to; sweep idle ones if a
+// deployment ever fans out to an unbounded set.
+type limits struct {
+	rules []limitRule
+
+	mu    sync.Mutex
+	byKey map[string]*limiter
+}
+
+func newLimits(rules []limitRule) *limits {
+	for _, rule := range rules {
+		metrics.RegisterDestination(rule.pattern)
+	}
+	return &limits{rules: rules, byKey: make(map[string]*limiter)}
+}
+
+// forTask returns the limiter t's deliveries go through, or nil if no rule
+// covers its destination.
+func (l *limits) forTask(t scheduler.Task) *limiter {
+	key := destinationKey(t)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lim, ok := l.byKey[key]; ok {
+		return lim
+	}
+	for _, rule := range l.rules {
+		if rule.matches(key) {
+			lim := newLimiter(rule)
+			l.byKey[key] = lim
+			return lim
+		}
+	}
+	return nil
+}
+
+// limiter enforces one rule for one destination: a semaphore for the
+// concurrency cap and a token bucket for the rate.
+type limiter struct {
+	rule  limitRule
+	slots chan struct{} // nil when uncapped
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rule limitRule) *limiter {
+	lim := &limiter{rule: rule, tokens: float64(rule.burst), last: time.Now()}
+	if rule.concurrent > 0 {
+		lim.slots = make(chan struct{}, rule.concurrent)
+	}
+	return lim
+}
+
+// acquire waits for a concurrency slot and then a rate token, in that order, so
+// a token is only spent by a delivery that is free to go. It reports false if
+// ctx ended first, having given back anything it took. A true return must be
+// paired with release.
+func (l *limiter) acquire(ctx context.Context) bool {
+	pattern := l.rule.pattern
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			metrics.ObserveThrottled(pattern, "concurrency")
+			metrics.DestinationWaitingAdd(pattern, 1)
+			select {
+			case l.slots <- struct{}{}:
+				metrics.DestinationWaitingAdd(pattern, -1)
+			case <-ctx.Done():
+				metrics.DestinationWaitingAdd(pattern, -1)
+				return false
+			}
+		}
+	}
+
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return true
+	}
+	metrics.ObserveThrottled(pattern, "rate")
+	metrics.DestinationWaitingAdd(pattern, 1)
+	defer metrics.DestinationWaitingAdd(pattern, -1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		l.refund()
+		l.release()
+		return false
+	}
+}
+
+// release frees the concurrency slot taken by acquire.
+func (l *limiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// reserve takes a token, returning how long until it is actually available.
+// Tokens may go negative: each waiter books the next one in line, so waiters
+// are spaced out at the rate instead of all retrying when one frees up.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	if l.rule.rate == 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rule.rate, float64(l.rule.burst))
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rule.rate * float64(time.Second))
+}
+
+// refund returns a token reserved for a delivery that never went out.
+func (l *limiter) refund() {
+	if l.rule.rate == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.tokens+1, float64(l.rule.burst))
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimits(t *testing.T) {
+	rules, err := parseLimits("api.partner.com concurrency=5 rate=10/s; *.Example.com rate=120/m burst=20 ;")
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, limitRule{pattern: "api.partner.com", concurrent: 5, rate: 10, burst: 1}, rules[0])
+	assert.Equal(t, limitRule{pattern: "*.example.com", rate: 2, burst: 20}, rules[1])
+
+	rules, err = parseLimits("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, bad := range []string{
+		"api.partner.com",               // no settings
+		"api.partner.com concurrency=0", // not positive
+		"api.partner.com rate=10",       // no unit
+		"api.partner.com rate=10/d",     // unknown unit
+		"api.partner.com speed=fast",    // unknown setting
+		"api.partner.com concurrency",   // not name=value
+		"api.*.com concurrency=1",       // wildcard mid-pattern
+		"*example.com concurrency=1",    // wildcard without a dot
+		`"quoted" concurrency=1`,        // would break the metric label
+	} {
+		_, err := parseLimits(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLimitRuleMatches(t *testing.T) {
+	sub := limitRule{pattern: "*.example.com"}
+	assert.True(t, sub.matches("api.example.com"))
+	assert.True(t, sub.matches("a.b.example.com"))
+	assert.False(t, sub.matches("example.com"), "a subdomain wildcard doesn't cover the apex")
+	assert.False(t, sub.matches("badexample.com"))
+
+	assert.True(t, limitRule{pattern: "*"}.matches("anything"))
+	assert.True(t, limitRule{pattern: "api.example.com"}.matches("api.example.com"))
+	assert.False(t, limitRule{pattern: "api.example.com"}.matches("www.example.com"))
+}
+
+// A task is limited by its declared destination if it has one, otherwise by its
+// url's host; each destination a rule covers gets a limiter of its own.
+func TestLimitsForTask(t *testing.T) {
+	l := newLimits([]limitRule{
+		{pattern: "billing", concurrent: 1, burst: 1},
+		{pattern: "*.example.com", concurrent: 2, burst: 1},
+	})
+
+	a := l.forTask(scheduler.Task{URL: "https://A.example.com/hook"})
+	b := l.forTask(scheduler.Task{URL: "https://b.example.com:8443/hook"})
+	require.NotNil(t, a)
+	require.NotNil(t, b)
+	assert.NotSame(t, a, b, "each host gets its own cap")
+	assert.Same(t, a, l.forTask(scheduler.Task{URL: "https://a.example.com/other"}))
+
+	billing := l.forTask(scheduler.Task{URL: "https://a.example.com/hook", Destination: "billing"})
+	require.NotNil(t, billing)
+	assert.Equal(t, "billing", billing.rule.pattern, "the declared destination wins over the host")
+
+	assert.Nil(t, l.forTask(scheduler.Task{URL: "https://elsewhere.org/hook"}), "no rule, no limiter")
+}
+
+// The bucket hands out its burst at once, then spaces the rest at the rate,
+// each waiter booking the next token in line.
+func TestLimiterRate(t *testing.T) {
+	lim := newLimiter(limitRule{pattern: "x", rate: 10, burst: 2})
+	now := lim.last
+
+	assert.Zero(t, lim.reserve(now))
+	assert.Zero(t, lim.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, lim.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, lim.reserve(now))
+
+	// A refunded token goes to the next one in line.
+	lim.refund()
+	assert.Equal(t, 200*time.Millisecond, lim.reserve(now))
+
+	// Time refills the bucket, up to the burst and no further.
+	assert.Zero(t, lim.reserve(now.Add(time.Hour)))
+	assert.Zero(t, lim.reserve(now.Add(time.Hour)))
+	assert.Equal(t, 100*time.Millisecond, lim.reserve(now.Add(time.Hour)))
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	lim := newLimiter(limitRule{pattern: "x", concurrent: 1, burst: 1})
+	require.True(t, lim.acquire(context.Background()))
+
+	// The cap is full, so a second acquire waits until its context ends and
+	// leaves nothing behind.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, lim.acquire(ctx))
+
+	lim.release()
+	assert.True(t, lim.acquire(context.Background()), "a released slot is free again")
+	lim.release()
+}
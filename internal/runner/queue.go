@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// queue is a min-heap of upcoming tasks ordered by due time, so the runner can
+// sleep until exactly the next one instead of parking a timer per task.
+//
+// An entry is a snapshot, and snapshots go stale: a task rescheduled while
+// queued is simply pushed again. latest remembers the newest due time per id,
+// and pop discards any entry that no longer matches it. Cancels and edits that
+// keep the due time are not tracked at all - the pre-fire transition re-reads
+// the task and is what actually decides whether it fires.
+type queue struct {
+	h      dueHeap
+	latest map[string]time.Time
+}
+
+func newQueue() *queue {
+	return &queue{latest: make(map[string]time.Time)}
+}
+
+// push queues t, reporting whether it is now the earliest entry. Pushing a task
+// already queued for the same due time is a no-op.
+func (q *queue) push(t scheduler.Task) bool {
+	due := t.DueAt()
+	if at, ok := q.latest[t.ID]; ok && at.Equal(due) {
+		return false
+	}
+	q.latest[t.ID] = due
+	heap.Push(&q.h, t)
+	return q.h[0].ID == t.ID
+}
+
+// popDue removes and returns every live entry due at or before now, earliest
+// first.
+func (q *queue) popDue(now time.Time) []scheduler.Task {
+	var due []scheduler.Task
+	for len(q.h) > 0 && !q.h[0].DueAt().After(now) {
+		t := heap.Pop(&q.h).(scheduler.Task)
+		if at, ok := q.latest[t.ID]; !ok || !at.Equal(t.DueAt()) {
+			continue // superseded by a later push
+		}
+		delete(q.latest, t.ID)
+		due = append(due, t)
+	}
+	return due
+}
+
+// next returns the due time of the earliest entry, stale or not; waking for a
+// stale one costs a spurious pass, nothing more.
+func (q *queue) next() (time.Time, bool) {
+	if len(q.h) == 0 {
+		return time.Time{}, false
+	}
+	return q.h[0].DueAt(), true
+}
+
+// dueHeap implements heap.Interface over tasks by DueAt.
+type dueHeap []scheduler.Task
+
+func (h dueHeap) Len() int           { return len(h) }
+func (h dueHeap) Less(i, j int) bool { return h[i].DueAt().Before(h[j].DueAt()) }
+func (h dueHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *dueHeap) Push(x any)        { *h = append(*h, x.(scheduler.Task)) }
+func (h *dueHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = scheduler.Task{} // drop the reference to its payload
+	*h = old[:len(old)-1]
+	return t
+}
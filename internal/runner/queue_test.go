@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOrdersByDueTime(t *testing.T) {
+	now := time.Now()
+	q := newQueue()
+	assert.True(t, q.push(scheduler.Task{ID: "b", ExecuteAt: now.Add(2 * time.Second)}))
+	assert.True(t, q.push(scheduler.Task{ID: "a", ExecuteAt: now.Add(time.Second)}), "an earlier task becomes the head")
+	assert.False(t, q.push(scheduler.Task{ID: "c", ExecuteAt: now.Add(3 * time.Second)}))
+
+	next, ok := q.next()
+	require.True(t, ok)
+	assert.True(t, next.Equal(now.Add(time.Second)))
+
+	assert.Empty(t, q.popDue(now), "nothing is due yet")
+	due := q.popDue(now.Add(2 * time.Second))
+	require.Len(t, due, 2)
+	assert.Equal(t, "a", due[0].ID)
+	assert.Equal(t, "b", due[1].ID)
+}
+
+// A task rescheduled while queued is pushed again; only its newest entry fires,
+// and pushing the same due time twice queues it once.
+func TestQueueDropsSupersededEntries(t *testing.T) {
+	now := time.Now()
+	retry := now.Add(5 * time.Second)
+	q := newQueue()
+	q.push(scheduler.Task{ID: "x", ExecuteAt: now})
+	assert.False(t, q.push(scheduler.Task{ID: "x", ExecuteAt: now}), "a duplicate push is a no-op")
+	q.push(scheduler.Task{ID: "x", ExecuteAt: now, NextAttemptAt: &retry})
+
+	assert.Empty(t, q.popDue(now), "the superseded entry is discarded, not fired")
+	due := q.popDue(retry)
+	require.Len(t, due, 1)
+	assert.True(t, due[0].DueAt().Equal(retry))
+
+	_, ok := q.next()
+	assert.False(t, ok)
+}
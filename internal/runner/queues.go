@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ksamirdev/schedy/internal/metrics"
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// queueConfig is one queue declared in SCHEDY_QUEUES.
+type queueConfig struct {
+	name       string
+	concurrent int // deliveries in flight at once; 0 is uncapped
+}
+
+// parseQueues reads SCHEDY_QUEUES: queues separated by ";", each a name
+// optionally followed by settings, e.g.
+//
+//	billing concurrency=20; marketing concurrency=5; reports
+//
+// The default queue is always declared; naming it here only sets its cap.
+func parseQueues(s string) ([]queueConfig, error) {
+	configs := []queueConfig{{name: scheduler.DefaultQueue}}
+	seen := map[string]int{scheduler.DefaultQueue: 0}
+	for _, raw := range strings.Split(s, ";") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		q := queueConfig{name: fields[0]}
+		if !scheduler.ValidQueueName(q.name) {
+			return nil, fmt.Errorf("%q: invalid queue name (lowercase letters, digits, '-' and '_')", q.name)
+		}
+		for _, f := range fields[1:] {
+			name, val, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("%q: %q is not name=value", q.name, f)
+			}
+			var err error
+			switch name {
+			case "concurrency":
+				q.concurrent, err = positiveInt(val)
+			default:
+				err = fmt.Errorf("unknown setting %q", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%q: %s: %w", q.name, name, err)
+			}
+		}
+		if i, dup := seen[q.name]; dup {
+			if q.name != scheduler.DefaultQueue {
+				return nil, fmt.Errorf("%q: declared twice", q.name)
+			}
+			configs[i] = q
+			continue
+		}
+		seen[q.name] = len(configs)
+		configs = append(configs, q)
+	}
+	return configs, nil
+}
+
+// lane is one declared queue's delivery cap.
+type lane struct {
+	config   queueConfig
+	slots    chan struct{} // nil when uncapped
+	inflight atomic.Int64
+}
+
+// acquire waits for a slot in the queue's cap. It reports false, holding
+// nothing, if ctx ends first.
+func (l *lane) acquire(ctx context.Context) bool {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	l.inflight.Add(1)
+	metrics.QueueInflightAdd(l.config.name, 1)
+	return true
+}
+
+func (l *lane) release() {
+	l.inflight.Add(-1)
+	metrics.QueueInflightAdd(l.config.name, -1)
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// queues holds the declared queues and the paused set. The declared set is
+// fixed at startup, which is also what keeps the per-queue metric labels an
+// operator's choice rather than a client's.
+//
+// A task in a queue no longer declared - left over from an older config - is
+// still delivered, uncapped, so removing a queue from SCHEDY_QUEUES can't
+// strand its tasks; and one still paused from then can be resumed.
+type queues struct {
+	byName map[string]*lane
+
+	mu     sync.Mutex
+	paused map[string]bool
+}
+
+func newQueues(configs []queueConfig, paused []string) *queues {
+	q := &queues{byName: make(map[string]*lane, len(configs)), paused: make(map[string]bool)}
+	for _, c := range configs {
+		l := &lane{config: c}
+		if c.concurrent > 0 {
+			l.slots = make(chan struct{}, c.concurrent)
+		}
+		q.byName[c.name] = l
+		metrics.RegisterQueue(c.name)
+	}
+	for _, name := range paused {
+		q.setPaused(name, true)
+	}
+	return q
+}
+
+// forTask returns the lane for t's queue, or nil if it isn't declared.
+func (q *queues) forTask(t scheduler.Task) *lane {
+	return q.byName[t.QueueName()]
+}
+
+func (q *queues) isPaused(name string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused[name]
+}
+
+func (q *queues) setPaused(name string, paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if paused {
+		q.paused[name] = true
+	} else {
+		delete(q.paused, name)
+	}
+	if _, declared := q.byName[name]; declared {
+		metrics.SetQueuePaused(name, paused)
+	}
+}
+
+// list reports every declared queue, sorted by name.
+func (q *queues) list() []scheduler.QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]scheduler.QueueStatus, 0, len(q.byName))
+	for name, l := range q.byName {
+		out = append(out, scheduler.QueueStatus{
+			Name:        name,
+			Paused:      q.paused[name],
+			Concurrency: l.config.concurrent,
+			Inflight:    int(l.inflight.Load()),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
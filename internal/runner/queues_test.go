@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueues(t *testing.T) {
+	configs, err := parseQueues("billing concurrency=20; marketing concurrency=5 ; reports;")
+	require.NoError(t, err)
+	assert.Equal(t, []queueConfig{
+		{name: scheduler.DefaultQueue},
+		{name: "billing", concurrent: 20},
+		{name: "marketing", concurrent: 5},
+		{name: "reports"},
+	}, configs)
+
+	configs, err = parseQueues("")
+	require.NoError(t, err)
+	assert.Equal(t, []queueConfig{{name: scheduler.DefaultQueue}}, configs, "the default queue is always declared")
+
+	configs, err = parseQueues("default concurrency=3")
+	require.NoError(t, err)
+	assert.Equal(t, []queueConfig{{name: scheduler.DefaultQueue, concurrent: 3}}, configs, "naming default sets its cap")
+
+	for _, bad := range []string{
+		"billing; billing",       // declared twice
+		"Billing",                // uppercase
+		`"billing"`,              // would break the metric label
+		"billing concurrency=0",  // not positive
+		"billing concurrency",    // not name=value
+		"billing priority=high",  // unknown setting
+		"-billing concurrency=1", // must start alphanumeric
+	} {
+		_, err := parseQueues(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestQueuesPauseState(t *testing.T) {
+	q := newQueues([]queueConfig{{name: scheduler.DefaultQueue}, {name: "billing", concurrent: 2}}, []string{"billing", "retired"})
+
+	assert.True(t, q.isPaused("billing"))
+	assert.True(t, q.isPaused("retired"), "a pause outlives the queue's declaration")
+	assert.Nil(t, q.forTask(scheduler.Task{Queue: "retired"}), "an undeclared queue is uncapped")
+	assert.NotNil(t, q.forTask(scheduler.Task{}), "a task without a queue is in the default one")
+
+	q.setPaused("billing", false)
+	list := q.list()
+	require.Len(t, list, 2, "only declared queues are listed")
+	assert.Equal(t, scheduler.QueueStatus{Name: "billing", Concurrency: 2}, list[0])
+	assert.Equal(t, scheduler.QueueStatus{Name: scheduler.DefaultQueue}, list[1])
+}
@@ -2,12 +2,15 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,31 +25,70 @@ import (
 // own API, turning Schedy's recovery into their incident.
 const DefaultMaxConcurrent = 50
 
+// DefaultBreakerCooldown is how long an open circuit breaker defers deliveries
+// before letting a probe through.
+const DefaultBreakerCooldown = 30 * time.Second
+
 type Runner struct {
-	ticker   Ticker
 	store    scheduler.Store
 	executor *executor.Executor
+	// interval is the safety poll: how often the runner re-reads the store
+	// for due tasks it wasn't told about, and how far ahead each read looks.
 	interval time.Duration
 	// onFailureURL, if set (SCHEDY_ON_FAILURE_URL), receives a best-effort POST
 	// whenever a task exhausts its retries and reaches the failed state.
 	onFailureURL string
-	// sem bounds concurrent deliveries (SCHEDY_MAX_CONCURRENT_DELIVERIES).
-	sem chan struct{}
+	// sem bounds concurrent deliveries (SCHEDY_MAX_CONCURRENT_DELIVERIES),
+	// admitting higher priorities first.
+	sem *slots
+	// queues caps deliveries per queue and holds which queues are paused
+	// (SCHEDY_QUEUES, POST /queues/{name}/pause).
+	queues *queues
+	// limits caps deliveries per destination (SCHEDY_DESTINATION_LIMITS), so
+	// a backlog for one slow host can't take every slot in sem.
+	limits *limits
+	// breakers defers deliveries to hosts that keep failing
+	// (SCHEDY_BREAKER_THRESHOLD, SCHEDY_BREAKER_COOLDOWN).
+	breakers *breakers
 	// maxStaleness, if set (SCHEDY_MAX_STALENESS), is how far past its
 	// execute_at a task may fire. Zero means no limit: catch up everything.
 	maxStaleness time.Duration
 
-	// inflight holds the ids currently claimed by a delivery goroutine. A task
-	// stays pending in the store until it actually fires, so without this a
-	// tick could pick up a task that an earlier tick is already waiting to
-	// deliver - a real risk now that a task can sit on the semaphore for a
-	// while. Schedy is single-process, so an in-memory claim is enough.
+	// inflight maps each task claimed by a delivery goroutine to the due
+	// time it was claimed for. A task stays pending in the store until it
+	// actually fires, so without this a poll could queue a task that is
+	// already waiting on the semaphore to be delivered. Schedy is
+	// single-process, so an in-memory claim is enough.
 	mu       sync.Mutex
-	inflight map[string]struct{}
+	inflight map[string]time.Time
+
+	// queued holds the tasks due before horizon, the end of the last poll's
+	// window; anything later is the next poll's to find. wake is poked when
+	// a store notification queues a new earliest task. Both guarded by qmu.
+	qmu     sync.Mutex
+	queued  *queue
+	horizon time.Time
+	wake    chan struct{}
+	// repoll asks the loop to poll on its next pass rather than at the next
+	// interval: a resumed queue's backlog is in no notification.
+	repoll atomic.Bool
+
+	// maintenance is the pause of every delivery (POST /admin/pause), nil
+	// while delivering. pmu also serialises the store writes that set and
+	// clear it, so an auto-resume can't clear a pause made a moment later.
+	pmu         sync.Mutex
+	maintenance *scheduler.Maintenance
 
 	// wg tracks in-flight delivery goroutines so shutdown can drain them
 	// instead of closing the store underneath a finalize Update.
 	wg sync.WaitGroup
+	// deliveries is the context requests go out under. The drain cancels it
+	// (abort) once drainTimeout is up, so a delivery still waiting on its
+	// receiver is cut off and written back to the store rather than
+	// abandoned as running.
+	deliveries   context.Context
+	abort        context.CancelFunc
+	drainTimeout time.Duration
 }
 
 func New(store scheduler.Store, executor *executor.Executor, interval time.Duration) *Runner {
@@ -60,6 +102,48 @@ func New(store scheduler.Store, executor *executor.Executor, interval time.Durat
 		maxConcurrent = n
 	}
 
+	queueConfigs, err := parseQueues(os.Getenv("SCHEDY_QUEUES"))
+	if err != nil {
+		slog.Error("invalid SCHEDY_QUEUES", "error", err)
+		os.Exit(1)
+	}
+	paused, err := store.PausedQueues()
+	if err != nil {
+		slog.Error("read paused queues", "error", err)
+		os.Exit(1)
+	}
+	maintenance, err := store.Maintenance()
+	if err != nil {
+		slog.Error("read maintenance", "error", err)
+		os.Exit(1)
+	}
+	metrics.SetPaused(maintenance != nil)
+
+	rules, err := parseLimits(os.Getenv("SCHEDY_DESTINATION_LIMITS"))
+	if err != nil {
+		slog.Error("invalid SCHEDY_DESTINATION_LIMITS", "error", err)
+		os.Exit(1)
+	}
+
+	var threshold int
+	if v := os.Getenv("SCHEDY_BREAKER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			slog.Error("invalid SCHEDY_BREAKER_THRESHOLD", "value", v, "want", "a positive integer")
+			os.Exit(1)
+		}
+		threshold = n
+	}
+	cooldown := DefaultBreakerCooldown
+	if v := os.Getenv("SCHEDY_BREAKER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			slog.Error("invalid SCHEDY_BREAKER_COOLDOWN", "value", v, "want", `a positive Go duration like "30s"`)
+			os.Exit(1)
+		}
+		cooldown = d
+	}
+
 	var maxStaleness time.Duration
 	if v := os.Getenv("SCHEDY_MAX_STALENESS"); v != "" {
 		d, err := time.ParseDuration(v)
@@ -70,276 +154,701 @@ func New(store scheduler.Store, executor *executor.Executor, interval time.Durat
 		maxStaleness = d
 	}
 
-	return &Runner{
-		ticker:       NewTicker(interval),
+	deliveries, abort := context.WithCancel(context.Background())
+	r := &Runner{
 		store:        store,
 		executor:     executor,
 		interval:     interval,
 		onFailureURL: os.Getenv("SCHEDY_ON_FAILURE_URL"),
-		sem:          make(chan struct{}, maxConcurrent),
+		sem:          newSlots(maxConcurrent),
+		queues:       newQueues(queueConfigs, paused),
+		limits:       newLimits(rules),
+		breakers:     newBreakers(threshold, cooldown),
 		maxStaleness: maxStaleness,
-		inflight:     make(map[string]struct{}),
+		maintenance:  maintenance,
+		inflight:     make(map[string]time.Time),
+		queued:       newQueue(),
+		wake:         make(chan struct{}, 1),
+		deliveries:   deliveries,
+		abort:        abort,
+		drainTimeout: drainTimeout,
 	}
+	store.OnPending(r.notify)
+	return r
 }
 
-// claim reserves a task for delivery. It reports false if another goroutine
-// already holds it, in which case the caller must not touch the task.
-func (r *Runner) claim(id string) bool {
+// notify is the store's OnPending hook. A task due before the current poll
+// window closes is queued, and the loop woken if it is now the earliest; a
+// later one is left for the poll that covers it.
+func (r *Runner) notify(t scheduler.Task) {
+	r.qmu.Lock()
+	earliest := t.DueAt().Before(r.horizon) && r.queued.push(t)
+	r.qmu.Unlock()
+	if earliest {
+		select {
+		case r.wake <- struct{}{}:
+		default: // a wake-up is already pending
+		}
+	}
+}
+
+// claim reserves a task for delivery at its current due time. It reports false
+// if another goroutine already holds that same run, in which case the caller
+// must not touch the task.
+//
+// A different due time is a different run - a retry the holder has just
+// scheduled, or a reschedule the holder will notice and drop - so it doesn't
+// have to wait for the holder to return; the pre-fire transition keeps the two
+// from both delivering.
+func (r *Runner) claim(t scheduler.Task) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if _, held := r.inflight[id]; held {
+	if due, held := r.inflight[t.ID]; held && due.Equal(t.DueAt()) {
 		return false
 	}
-	r.inflight[id] = struct{}{}
+	r.inflight[t.ID] = t.DueAt()
 	return true
 }
 
-func (r *Runner) release(id string) {
+// release drops a claim, unless a later run of the same task has taken it over.
+func (r *Runner) release(t scheduler.Task) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.inflight, id)
+	if due, held := r.inflight[t.ID]; held && due.Equal(t.DueAt()) {
+		delete(r.inflight, t.ID)
+	}
 }
 
-// Start runs the delivery loop until ctx is cancelled, then drains: goroutines
-// still waiting on their pre-fire timer or a delivery slot return immediately
-// (the task stays pending and is re-queued on the next start), and deliveries
-// already firing get up to drainTimeout to finish and record their outcome
-// before Start returns and the caller closes the store.
+// Start runs the delivery loop until ctx is cancelled, then drains: deliveries
+// still waiting on a slot return immediately (the task stays pending and is
+// picked up on the next start), and deliveries already firing get up to
+// drainTimeout to finish and record their outcome. Any still in flight after
+// that are cut off and written back as pending, so by the time Start returns
+// and the caller closes the store no task is left running.
+//
+// The loop sleeps until the earliest queued task is due, or the next poll,
+// whichever is sooner. A task written after the poll that covers its due time
+// reaches the queue through the store's OnPending hook, which wakes the loop
+// if it is now the earliest; so a task due in two seconds fires in two
+// seconds, not at the next poll. The poll stays as the backstop for whatever
+// the hook can't see: tasks stored before this process started, and backlogs
+// larger than one batch.
+//
+// During maintenance the loop neither polls nor takes anything off the queue;
+// it only wakes to end a pause that has an end.
 func (r *Runner) Start(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var nextPoll time.Time
 	for {
+		now := time.Now()
+		r.expireMaintenance(now)
+
+		var wakeAt time.Time
+		if m := r.Maintenance(); m != nil {
+			// Tasks the hook queues meanwhile wait in the queue, and the
+			// resume polls for the rest.
+			wakeAt = now.Add(r.interval)
+			if m.Until != nil && m.Until.Before(wakeAt) {
+				wakeAt = *m.Until
+			}
+		} else {
+			if !now.Before(nextPoll) || r.repoll.Swap(false) {
+				r.poll(now)
+				nextPoll = now.Add(r.interval)
+			}
+
+			r.qmu.Lock()
+			due := r.queued.popDue(now)
+			wakeAt = nextPoll
+			if next, ok := r.queued.next(); ok && next.Before(wakeAt) {
+				wakeAt = next
+			}
+			r.qmu.Unlock()
+
+			for _, t := range due {
+				r.dispatch(ctx, t)
+			}
+		}
+
+		timer.Reset(time.Until(wakeAt))
 		select {
 		case <-ctx.Done():
-			r.ticker.Stop()
-			r.drain(drainTimeout)
+			r.drain(r.drainTimeout)
 			return
-		case now := <-r.ticker.C():
-			r.runOnce(ctx, now, now.Add(r.interval))
+		case <-timer.C:
+		case <-r.wake:
 		}
 	}
 }
 
 // drainTimeout bounds how long shutdown waits for in-flight deliveries. Long
-// enough for a delivery plus a few retries; short enough that a supervisor's
-// own kill timeout doesn't fire first.
-// ponytail: retry sleeps are not ctx-aware, so a long exponential chain can
-// outlive this and lose its final status record (re-queued as running on next
-// start). Interrupt the retry sleep on ctx if that ever matters.
+// enough for a delivery at the default timeout; short enough that a
+// supervisor's own kill timeout doesn't fire first. Retries wait in the store,
+// not here, so a task between attempts has nothing to drain. A single attempt
+// may be allowed up to MaxTimeoutMs, longer than this; one still running when
+// it is up is interrupted (see interrupted).
 const drainTimeout = 30 * time.Second
 
-// drain waits for in-flight delivery goroutines, giving up after timeout.
+// abortGrace is how long an interrupted delivery gets to write itself back -
+// one store transaction, so only a wedged store comes close.
+const abortGrace = 5 * time.Second
+
+// drain waits for in-flight delivery goroutines. After timeout it cuts off the
+// requests still outstanding and waits, briefly, for them to record it.
 func (r *Runner) drain(timeout time.Duration) {
 	done := make(chan struct{})
 	go func() { r.wg.Wait(); close(done) }()
 	select {
 	case <-done:
+		return
 	case <-time.After(timeout):
-		slog.Warn("shutdown: gave up on in-flight deliveries", "timeout", timeout)
+	}
+	slog.Warn("shutdown: interrupting in-flight deliveries", "timeout", timeout)
+	r.abort()
+	select {
+	case <-done:
+	case <-time.After(abortGrace):
+		slog.Warn("shutdown: gave up on in-flight deliveries", "grace", abortGrace)
 	}
 }
 
-func (r *Runner) runOnce(ctx context.Context, start, end time.Time) {
-	// One bounded batch per tick. A backlog larger than the batch is drained
-	// over successive ticks, oldest first, rather than read in at once.
-	tasks, err := r.store.GetDueTasks(start, end, scheduler.MaxDueBatch)
+// poll queues every pending task due within the next interval. The horizon
+// moves first, so a task written while the read is in flight is queued by the
+// hook if the read misses it; one caught by both is queued once.
+func (r *Runner) poll(now time.Time) {
+	end := now.Add(r.interval)
+	r.qmu.Lock()
+	r.horizon = end
+	r.qmu.Unlock()
+
+	// One bounded batch per poll. A backlog larger than the batch is drained
+	// over successive polls, highest priority first and oldest first within
+	// a priority, rather than read in at once.
+	tasks, err := r.store.GetDueTasks(now, end, scheduler.MaxDueBatch)
 	if err != nil {
 		slog.Error("get due tasks", "error", err)
 		return
 	}
 
-	for i, task := range tasks {
-		// Already being delivered by an earlier tick: leave it alone.
-		if !r.claim(task.ID) {
-			continue
-		}
-		r.wg.Add(1)
-		go func(t scheduler.Task, idx int) {
-			defer r.wg.Done()
-			defer r.release(t.ID)
-
-			taskTime := time.Until(t.ExecuteAt)
-			if max(taskTime, 0) == 0 {
-				taskTime = 0
-			}
+	r.qmu.Lock()
+	defer r.qmu.Unlock()
+	for _, t := range tasks {
+		r.queued.push(t)
+	}
+}
 
-			timer := NewTimer(taskTime)
-			defer timer.Stop()
+// dispatch delivers a task that has come due on a goroutine of its own.
+func (r *Runner) dispatch(ctx context.Context, t scheduler.Task) {
+	// Already being delivered after an earlier pass: leave it alone.
+	if !r.claim(t) {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.release(t)
+
+		due := t.DueAt()
+		queue := t.QueueName()
+
+		// A paused queue's tasks stay pending, untouched; the store leaves
+		// them out of polls until it is resumed. Likewise everything during
+		// maintenance.
+		if r.queues.isPaused(queue) || r.paused() {
+			return
+		}
 
-			select {
-			case <-timer.C():
-			case <-ctx.Done():
-				// Not fired yet: leave the task pending for the next start.
+		// Wait on the queue's cap, then the destination's own limits, then
+		// the global slot, so a queue or destination at its cap waits here
+		// without holding a slot anyone else could use. The queue comes
+		// first: a destination slot held by a task waiting on its queue's
+		// cap would throttle every other queue delivering there.
+		if ln := r.queues.forTask(t); ln != nil {
+			if !ln.acquire(ctx) {
 				return
 			}
-
-			// Wait for a delivery slot. Taken before the fire timestamp on
-			// purpose: time spent queued here is time the task is late, and
-			// hiding that would make saturation invisible in the one metric
-			// meant to show it. Abort on shutdown: a task still queued here has
-			// not fired, so it stays pending for the next start instead of
-			// holding the drain hostage.
-			select {
-			case r.sem <- struct{}{}:
-			case <-ctx.Done():
+			defer ln.release()
+		}
+		lim := r.limits.forTask(t)
+		if lim != nil {
+			if !lim.acquire(ctx) {
 				return
 			}
-			metrics.InflightAdd(1)
-			defer func() {
-				metrics.InflightAdd(-1)
-				<-r.sem
-			}()
-
-			fireTime := time.Now().UTC()
-
-			// The task may have been cancelled or updated after it was picked up
-			// but before its timer fired. Re-read its current state: a cancel
-			// (or any non-pending status) wins the race, a reschedule drops this
-			// run so the next tick picks the task up at its new time, and any
-			// other edit fires the fresh field values instead of the stale copy.
-			// ponytail: residual TOCTOU between this read and the Update below
-			// (single process, microsecond window); add a CAS status transition
-			// in the store if that window ever matters.
-			cur, err := r.store.GetTask(t.ID)
-			if err != nil {
-				slog.Error("re-read task before firing", "task_id", t.ID, "error", err)
-				return
+			defer lim.release()
+		}
+
+		// Wait for a delivery slot, behind any waiting task of higher
+		// priority. Taken before the fire timestamp on purpose: time spent
+		// queued here is time the task is late, and hiding that would make
+		// saturation invisible in the one metric meant to show it. Abort on
+		// shutdown: a task still queued here has not fired, so it stays
+		// pending for the next start instead of holding the drain hostage.
+		if !r.sem.acquire(ctx, t) {
+			return
+		}
+		metrics.InflightAdd(1)
+		defer func() {
+			metrics.InflightAdd(-1)
+			r.sem.release()
+		}()
+
+		// Paused while this waited for a slot: leave it for the resume.
+		if r.queues.isPaused(queue) || r.paused() {
+			if lim != nil {
+				lim.refund()
 			}
-			// Cancelled or deleted mid-flight: expected, not an error.
-			if cur == nil || cur.Status != scheduler.StatusPending {
-				return
+			return
+		}
+
+		fireTime := time.Now().UTC()
+
+		// Too late to be worth firing: skip rather than deliver. Checked
+		// against the real fire time, so a task delayed by a queue of its
+		// peers is judged by when it would actually go out.
+		//
+		// A task with a deadline of its own is judged by that alone, in
+		// either direction: an OTP reminder can expire long before the
+		// server-wide limit, and an invoice run can outlast it. The deadline
+		// holds for retries too - the reminder is as useless on its third
+		// attempt as on its first - whereas server-wide staleness judges a
+		// retry by when it was due, not by the original execute_at: it is
+		// the retry that is late, not the task.
+		late := fireTime.Sub(due)
+		var skip, why string
+		if deadline, ok := t.Deadline(); ok {
+			if fireTime.After(deadline) {
+				skip = metrics.SkipExpired
+				why = fmt.Sprintf("skipped: expired at %s", deadline.Format(time.RFC3339))
 			}
-			if !cur.ExecuteAt.Equal(t.ExecuteAt) {
-				slog.Info("task rescheduled, skipping this run", "task_id", t.ID, "execute_at", cur.ExecuteAt)
-				return
+		} else if r.maxStaleness > 0 && late > r.maxStaleness {
+			skip = metrics.SkipStale
+			why = fmt.Sprintf("skipped: %s past due, exceeds max staleness %s", late.Round(time.Second), r.maxStaleness)
+		}
+		if skip != "" {
+			// Nothing went out, so a skip doesn't spend the destination's
+			// rate: a backlog of dead work is retired at full speed.
+			if lim != nil {
+				lim.refund()
+			}
+			r.skip(t, fireTime, skip, why)
+			return
+		}
+
+		// The task may have been cancelled or updated after it was picked up
+		// but before its timer fired, so claim it with a pending->running
+		// transition against its current stored state: a cancel (or any
+		// non-pending status) wins the race, a reschedule drops this run so
+		// the next tick picks the task up at its new time, and any other
+		// edit fires the fresh field values instead of the stale copy. The
+		// check and the claim are one store transaction, so a cancel can't
+		// land between them.
+		cur, err := r.store.Transition(t.ID, scheduler.StatusPending, scheduler.StatusRunning, unchangedSince(t))
+		switch {
+		// Cancelled or deleted mid-flight: expected, not an error.
+		case errors.Is(err, scheduler.ErrNotFound), errors.Is(err, scheduler.ErrConflict):
+			return
+		case errors.Is(err, errRescheduled):
+			slog.Info("task rescheduled, skipping this run", "task_id", t.ID)
+			return
+		case err != nil:
+			slog.Error("mark task running", "task_id", t.ID, "error", err)
+			return
+		}
+		t = *cur
+
+		// A host that keeps failing is given time to recover rather than
+		// having every due task spend a retry on it. Checked once the task
+		// is running, so the probe a half-open breaker lets through always
+		// reports back.
+		host := breakerHost(t)
+		if ok, retryAt := r.breakers.allow(host, time.Now()); !ok {
+			r.deferDelivery(t, retryAt)
+			return
+		}
+
+		// Recorded only once the task is committed to firing: a cancelled or
+		// rescheduled task never ran, so its wait is not delivery lateness.
+		metrics.ObserveLateness(t.Priority, late)
+
+		// A recurring successor is anchored to when this run first fired,
+		// so a retry landing later doesn't drag the chain's cadence with it.
+		// Every write-back below stores it with the task.
+		if t.RunStartedAt == nil {
+			t.RunStartedAt = &fireTime
+		}
+		runStart := *t.RunStartedAt
+
+		slog.Info("executing task", "task_id", t.ID, "url", t.URL, "method", t.Method, "late", late, "retry", t.RetryCount)
+
+		// Continue the numbering rather than restarting it: a replayed
+		// task keeps its earlier attempts, and two attempts both called
+		// "n: 1" make the log unreadable at the moment it matters.
+		res := r.executor.ExecuteContext(r.deliveries, t)
+		if r.deliveries.Err() != nil && errors.Is(res.Err, context.Canceled) {
+			r.interrupted(t, res)
+			return
+		}
+		att := scheduler.Attempt{
+			N:          len(t.Attempts) + 1,
+			FiredAt:    time.Now().UTC(),
+			StatusCode: res.StatusCode,
+			DurationMs: res.Duration.Milliseconds(),
+		}
+		if res.Err != nil {
+			att.Error = res.Err.Error()
+			att.ResponseBody = res.ResponseBody
+			att.ResponseBodyTruncated = res.ResponseBodyTruncated
+		}
+		t.Attempts = append(t.Attempts, att)
+		metrics.ObserveDelivery(res.Duration, res.Err == nil)
+		if res.Sent {
+			r.breakers.record(host, time.Now(), res.Unavailable())
+		} else {
+			r.breakers.unsent(host, time.Now())
+		}
+
+		if res.Err == nil {
+			t.Status = scheduler.StatusSucceeded
+			if t.OnSuccess != nil {
+				// Named now so the link is written with the success itself.
+				t.ChildID = uuid.NewString()
 			}
-			t = *cur
-
-			// Too late to be worth firing: skip rather than deliver. Checked
-			// against the real fire time, so a task delayed by a queue of its
-			// peers is judged by when it would actually go out.
-			late := fireTime.Sub(t.ExecuteAt)
-			if r.maxStaleness > 0 && late > r.maxStaleness {
-				r.skipStale(t, late, fireTime)
+		} else {
+			// Built from the re-read copy so an update to the retry
+			// settings takes effect on this run rather than the next one.
+			attempt := newAttempt(t.Retries, t.RetryInterval, t.RetryMode, t.RetryCount)
+			if res.RetryAfter > 0 {
+				attempt.serverHint(res.RetryAfter)
+			}
+			if wait, ok := attempt.next(); ok {
+				r.scheduleRetry(t, attempt.count, wait, res.Err)
 				return
 			}
+			t.Status = scheduler.StatusFailed
+		}
 
-			// Recorded only once the task is committed to firing: a cancelled or
-			// rescheduled task never ran, so its wait is not delivery lateness.
-			metrics.ObserveLateness(late)
+		now := time.Now().UTC()
+		t.FinishedAt = &now
+		t.NextAttemptAt = nil
+		if !r.finalize(t) {
+			return
+		}
+		metrics.ObserveTaskFinished(t.Status == scheduler.StatusSucceeded)
 
-			// Built from the re-read copy so an update to the retry settings
-			// takes effect on this run rather than the next one.
-			attempt := newAttempt(t.Retries, t.RetryInterval, t.RetryMode)
+		if t.Status == scheduler.StatusFailed {
+			r.notifyFailure(t)
+		}
 
-			slog.Info("executing task", "task_id", t.ID, "url", t.URL, "method", t.Method, "late", late)
+		r.followUp(t, now)
+		r.reschedule(t, runStart)
+	}()
+}
 
-			t.Status = scheduler.StatusRunning
-			if err := r.store.Update(t); err != nil {
-				slog.Error("mark task running", "task_id", t.ID, "error", err)
-			}
+// scheduleRetry writes a failed delivery back as pending, due again after wait,
+// and returns its slot. The retry is an ordinary store entry from here on: it
+// survives a restart, is subject to max staleness when it comes due, and
+// queues for a slot like any other task instead of holding one while it waits.
+func (r *Runner) scheduleRetry(t scheduler.Task, retry int, wait time.Duration, cause error) {
+	next := time.Now().UTC().Add(wait)
+	t.Status = scheduler.StatusPending
+	t.NextAttemptAt = &next
+	t.RetryCount = retry
+	slog.Warn("retrying task", "task_id", t.ID, "attempt", retry, "retries", t.Retries, "next_attempt_at", next, "error", cause)
+	r.finalize(t)
+}
 
-			// Continue the numbering rather than restarting it: a replayed
-			// task keeps its earlier attempts, and two attempts both called
-			// "n: 1" make the log unreadable at the moment it matters.
-			n := len(t.Attempts)
-			for {
-				n++
-				res := r.executor.Execute(t)
-				att := scheduler.Attempt{
-					N:          n,
-					FiredAt:    time.Now().UTC(),
-					StatusCode: res.StatusCode,
-					DurationMs: res.Duration.Milliseconds(),
-				}
-				if res.Err != nil {
-					att.Error = res.Err.Error()
-					att.ResponseBody = res.ResponseBody
-					att.ResponseBodyTruncated = res.ResponseBodyTruncated
-				}
-				t.Attempts = append(t.Attempts, att)
-				metrics.ObserveDelivery(res.Duration, res.Err == nil)
-
-				if res.Err == nil {
-					t.Status = scheduler.StatusSucceeded
-					break
-				}
-				if res.RetryAfter > 0 {
-					attempt.serverHint(res.RetryAfter)
-				}
-				if attempt.next() {
-					slog.Warn("retrying task", "task_id", t.ID, "attempt", attempt.count, "retries", attempt.strategy.retries, "error", res.Err)
-					continue
-				}
-				t.Status = scheduler.StatusFailed
-				break
-			}
+// interrupted writes back a delivery that shutdown cut off. The request may have
+// reached the receiver, so it is logged as an attempt, but it was ours to
+// abandon, not the receiver's to fail: no retry is spent, the breaker isn't
+// told, and the task goes back to pending at the due time it already had, to
+// fire first thing on the next start with its history and retry budget intact.
+func (r *Runner) interrupted(t scheduler.Task, res executor.Result) {
+	t.Attempts = append(t.Attempts, scheduler.Attempt{
+		N:          len(t.Attempts) + 1,
+		FiredAt:    time.Now().UTC(),
+		Error:      "interrupted by shutdown: " + res.Err.Error(),
+		DurationMs: res.Duration.Milliseconds(),
+	})
+	t.Status = scheduler.StatusPending
+	slog.Warn("delivery interrupted by shutdown, left pending", "task_id", t.ID, "retry", t.RetryCount)
+	r.finalize(t)
+}
+
+// deferDelivery puts a task back to pending until retryAt because its host's
+// breaker is open. Nothing was sent, so no attempt is logged and no retry is
+// used: the task is simply due later.
+func (r *Runner) deferDelivery(t scheduler.Task, retryAt time.Time) {
+	retryAt = retryAt.UTC()
+	t.Status = scheduler.StatusPending
+	t.NextAttemptAt = &retryAt
+	slog.Info("host breaker open, deferring task", "task_id", t.ID, "url", t.URL, "until", retryAt)
+	if r.finalize(t) {
+		metrics.ObserveDeferred()
+	}
+}
 
-			metrics.ObserveTaskFinished(t.Status == scheduler.StatusSucceeded)
+// Queues reports every queue declared in SCHEDY_QUEUES.
+func (r *Runner) Queues() []scheduler.QueueStatus {
+	return r.queues.list()
+}
 
-			now := time.Now().UTC()
-			t.FinishedAt = &now
-			if err := r.store.Update(t); err != nil {
-				slog.Error("finalize task", "task_id", t.ID, "status", t.Status, "error", err)
-			}
+// HasQueue reports whether SCHEDY_QUEUES declares name. The default queue is
+// always declared.
+func (r *Runner) HasQueue(name string) bool {
+	_, ok := r.queues.byName[name]
+	return ok
+}
 
-			if t.Status == scheduler.StatusFailed {
-				r.notifyFailure(t)
-			}
+// PauseQueue stops deliveries from queue until it is resumed, across restarts.
+// Deliveries already under way finish; everything else in the queue stays
+// pending, and new tasks are still accepted into it.
+func (r *Runner) PauseQueue(name string) error {
+	if !r.HasQueue(name) {
+		return scheduler.ErrUnknownQueue
+	}
+	if err := r.store.SetQueuePaused(name, true); err != nil {
+		return err
+	}
+	r.queues.setPaused(name, true)
+	slog.Info("queue paused", "queue", name)
+	return nil
+}
+
+// ResumeQueue lets a paused queue deliver again, and polls straight away for
+// its backlog. A queue no longer declared can still be resumed, so a pause
+// can't outlive the config that allowed it.
+func (r *Runner) ResumeQueue(name string) error {
+	if !r.HasQueue(name) && !r.queues.isPaused(name) {
+		return scheduler.ErrUnknownQueue
+	}
+	if err := r.store.SetQueuePaused(name, false); err != nil {
+		return err
+	}
+	r.queues.setPaused(name, false)
+	slog.Info("queue resumed", "queue", name)
+	r.repollNow()
+	return nil
+}
+
+// repollNow has the loop poll on its next pass, and wakes it for one.
+func (r *Runner) repollNow() {
+	r.repoll.Store(true)
+	select {
+	case r.wake <- struct{}{}:
+	default: // a wake-up is already pending
+	}
+}
+
+// Pause stops every delivery until Resume, or until until if it is set, across
+// restarts. Deliveries already under way finish; due tasks stay pending, and
+// the API keeps accepting new ones. Pausing while paused moves until and keeps
+// the original start.
+func (r *Runner) Pause(until *time.Time) (scheduler.Maintenance, error) {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	m := scheduler.Maintenance{Since: time.Now().UTC(), Until: until}
+	if r.maintenance != nil {
+		m.Since = r.maintenance.Since
+	}
+	if err := r.store.SetMaintenance(&m); err != nil {
+		return scheduler.Maintenance{}, err
+	}
+	r.maintenance = &m
+	metrics.SetPaused(true)
+	slog.Info("deliveries paused", "until", until)
+	// Wake the loop to sleep until the new end instead of the old one.
+	select {
+	case r.wake <- struct{}{}:
+	default: // a wake-up is already pending
+	}
+	return m, nil
+}
+
+// Resume ends a maintenance pause and polls straight away for the backlog.
+// Resuming while not paused is a no-op.
+func (r *Runner) Resume() error {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	if r.maintenance == nil {
+		return nil
+	}
+	if err := r.store.SetMaintenance(nil); err != nil {
+		return err
+	}
+	r.resumed()
+	return nil
+}
+
+// expireMaintenance ends a pause whose until has passed. The pause ends even if
+// the store can't be told: one left stored is already over, so the next start
+// ends it again.
+func (r *Runner) expireMaintenance(now time.Time) {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	if r.maintenance == nil || !r.maintenance.Over(now) {
+		return
+	}
+	if err := r.store.SetMaintenance(nil); err != nil {
+		slog.Error("clear maintenance", "error", err)
+	}
+	r.resumed()
+}
+
+// resumed drops the pause in memory. r.pmu must be held.
+func (r *Runner) resumed() {
+	r.maintenance = nil
+	metrics.SetPaused(false)
+	slog.Info("deliveries resumed")
+	r.repollNow()
+}
+
+// Maintenance reports the current pause, or nil while delivering.
+func (r *Runner) Maintenance() *scheduler.Maintenance {
+	r.pmu.Lock()
+	defer r.pmu.Unlock()
+	if r.maintenance == nil {
+		return nil
+	}
+	m := *r.maintenance
+	return &m
+}
+
+// paused reports whether deliveries are paused right now. A pause past its
+// until no longer holds anything back, whether or not the loop has got round
+// to ending it.
+func (r *Runner) paused() bool {
+	m := r.Maintenance()
+	return m != nil && !m.Over(time.Now())
+}
+
+// Breakers reports every host whose circuit breaker has recorded failures.
+func (r *Runner) Breakers() []scheduler.BreakerStatus {
+	return r.breakers.list()
+}
+
+// ResetBreaker closes host's circuit breaker, reporting whether it had one.
+// Tasks it already deferred keep their new due time, at most a cool-down away.
+func (r *Runner) ResetBreaker(host string) bool {
+	return r.breakers.reset(strings.ToLower(host))
+}
+
+// errRescheduled aborts a pre-fire transition whose task moved to a new due
+// time after it was picked up.
+var errRescheduled = errors.New("task rescheduled")
 
-			r.reschedule(t, fireTime)
-		}(task, i)
+// unchangedSince returns a Transition mutate that refuses to proceed if the
+// stored task's due time no longer matches the copy the runner picked up.
+func unchangedSince(t scheduler.Task) func(*scheduler.Task) error {
+	return func(cur *scheduler.Task) error {
+		if !cur.DueAt().Equal(t.DueAt()) {
+			return errRescheduled
+		}
+		return nil
 	}
 }
 
-// skipStale retires a task that came due too long ago to be worth delivering,
-// which after an outage is most of the backlog.
+// finalize records a delivery's outcome with a transition out of running -
+// to a terminal status, or back to pending for a retry - and reports whether
+// it stuck. A cancel that landed while the delivery was in
+// flight wins: the task stays cancelled, so it neither calls back nor
+// reschedules, but the attempts that did go out are still written to it so the
+// audit trail matches what the receiver saw.
+func (r *Runner) finalize(t scheduler.Task) bool {
+	_, err := r.store.Transition(t.ID, scheduler.StatusRunning, t.Status, func(cur *scheduler.Task) error {
+		*cur = t
+		return nil
+	})
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, scheduler.ErrConflict) {
+		slog.Error("finalize task", "task_id", t.ID, "status", t.Status, "error", err)
+		return false
+	}
+
+	slog.Info("task cancelled during delivery, keeping the cancel", "task_id", t.ID, "outcome", t.Status)
+	_, err = r.store.Transition(t.ID, scheduler.StatusCancelled, scheduler.StatusCancelled, func(cur *scheduler.Task) error {
+		cur.Attempts = t.Attempts
+		return nil
+	})
+	if err != nil && !errors.Is(err, scheduler.ErrConflict) && !errors.Is(err, scheduler.ErrNotFound) {
+		slog.Error("record attempts on cancelled task", "task_id", t.ID, "error", err)
+	}
+	return false
+}
+
+// skip retires a task too late to be worth delivering - past the staleness
+// limit, which after an outage is most of the backlog, or past its own
+// deadline. reason is the metrics.Skip* it is counted under, and why the error
+// recorded for it.
 //
 // It lands in failed rather than a status of its own: the reason is recorded as
 // an attempt, so the audit trail says what happened, and the failure callback
 // fires - a skipped task must never be silent, or the outage swallows work with
 // no trace. A recurring task still re-enqueues, so an outage interrupts the
 // chain rather than ending it.
-func (r *Runner) skipStale(t scheduler.Task, late time.Duration, fireTime time.Time) {
-	slog.Warn("skipping stale task", "task_id", t.ID, "late", late.Round(time.Second), "max_staleness", r.maxStaleness)
-
-	t.Status = scheduler.StatusFailed
-	t.Attempts = append(t.Attempts, scheduler.Attempt{
-		N:       len(t.Attempts) + 1,
-		FiredAt: fireTime,
-		Error: fmt.Sprintf("skipped: %s past execute_at, exceeds max staleness %s",
-			late.Round(time.Second), r.maxStaleness),
+func (r *Runner) skip(t scheduler.Task, fireTime time.Time, reason, why string) {
+	slog.Warn("skipping task", "task_id", t.ID, "reason", reason, "detail", why)
+
+	// Same guard as firing: a task cancelled or moved since it was picked up is
+	// not this run's to retire.
+	check := unchangedSince(t)
+	cur, err := r.store.Transition(t.ID, scheduler.StatusPending, scheduler.StatusFailed, func(cur *scheduler.Task) error {
+		if err := check(cur); err != nil {
+			return err
+		}
+		cur.Attempts = append(cur.Attempts, scheduler.Attempt{
+			N:       len(cur.Attempts) + 1,
+			FiredAt: fireTime,
+			Error:   why,
+		})
+		cur.FinishedAt = &fireTime
+		cur.NextAttemptAt = nil
+		return nil
 	})
-	t.FinishedAt = &fireTime
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound), errors.Is(err, scheduler.ErrConflict), errors.Is(err, errRescheduled):
+		return
+	case err != nil:
+		slog.Error("finalize skipped task", "task_id", t.ID, "error", err)
+		return
+	}
 
-	metrics.ObserveSkipped()
+	metrics.ObserveSkipped(reason)
 	metrics.ObserveTaskFinished(false)
 
-	if err := r.store.Update(t); err != nil {
-		slog.Error("finalize skipped task", "task_id", t.ID, "error", err)
-	}
-	r.notifyFailure(t)
-	r.reschedule(t, fireTime)
+	r.notifyFailure(*cur)
+	r.reschedule(*cur, fireTime)
 }
 
 // reschedule re-enqueues a recurring task (Schedule set) as a fresh one-shot at
-// fireTime+interval, forming a stateless chain on the existing one-shot engine.
-// Interval-only by design: no cron, no catch-up. Anchoring the next fire to
-// fireTime (not now) keeps a steady cadence; a task that outran its own interval
-// simply becomes due immediately, it is never replayed to catch up missed fires.
+// the schedule's next time after fireTime, forming a stateless chain on the
+// existing one-shot engine. No cron. What a late run does about the runs it
+// missed is the task's CatchUp policy: by default (once) the next fire is
+// anchored to fireTime, not now, and an interval task that outran its own
+// interval simply becomes due immediately; skip realigns to the series' phase
+// and drops the missed runs; all enqueues them one by one.
 //
-// A cancelled task never reaches here - the pre-fire re-read returns early on any
-// non-pending status - so cancelling the pending task stops the chain.
-// ponytail: a cancel landing during the brief run window is overwritten by the
-// finalize Update (the same residual TOCTOU noted above); the common case
-// (cancel while pending between fires) stops the chain reliably.
+// A cancelled task never reaches here: the pre-fire transition refuses any
+// non-pending task, and a cancel landing mid-delivery wins the finalize
+// transition, so cancelling the current link stops the chain either way. The
+// chain also ends at MaxRuns or Until, and the store refuses a successor to a
+// series cancelled as a whole.
 func (r *Runner) reschedule(t scheduler.Task, fireTime time.Time) {
 	if t.Schedule == "" {
 		return
 	}
-	interval, err := time.ParseDuration(t.Schedule)
-	if err != nil || interval <= 0 {
+	at, ok, err := t.NextRun(fireTime)
+	if err != nil {
 		// Validated at create/update time; a bad value here means a hand-edited
 		// record. Drop the chain rather than spin.
-		slog.Error("recurring task has an invalid schedule, not re-enqueuing", "task_id", t.ID, "schedule", t.Schedule)
+		slog.Error("recurring task has an invalid schedule, not re-enqueuing", "task_id", t.ID, "schedule", t.Schedule, "error", err)
+		return
+	}
+	if !ok {
+		slog.Info("recurring task's schedule has no further runs", "task_id", t.ID, "schedule", t.Schedule)
 		return
 	}
 	// The successor is this task at a new time: clone it, then reset identity
@@ -347,31 +856,80 @@ func (r *Runner) reschedule(t scheduler.Task, fireTime time.Time) {
 	next := t
 	next.ID = uuid.NewString()
 	next.IdempotencyKey = ""
-	next.ExecuteAt = fireTime.Add(interval)
+	next.ExecuteAt = at
 	next.Status = scheduler.StatusPending
 	next.Attempts = nil
 	next.FinishedAt = nil
-	if err := r.store.Save(next); err != nil {
+	next.NextAttemptAt = nil
+	next.RetryCount = 0
+	next.RunStartedAt = nil
+	next.Replays = 0
+	// Links are per run: the successor was enqueued by the chain, and has
+	// enqueued no follow-up of its own yet.
+	next.ParentID = ""
+	next.ChildID = ""
+	// A chain stored before series existed becomes one from here, named
+	// after the run that carried it over.
+	if next.SeriesID == "" {
+		next.SeriesID = t.ID
+	}
+	next.RunNumber = max(t.RunNumber, 1) + 1
+	switch {
+	case t.MaxRuns > 0 && next.RunNumber > t.MaxRuns:
+		slog.Info("recurring task reached max_runs", "task_id", t.ID, "series_id", next.SeriesID, "max_runs", t.MaxRuns)
+		return
+	case t.Until != nil && next.ScheduledAt().After(*t.Until):
+		slog.Info("recurring task reached until", "task_id", t.ID, "series_id", next.SeriesID, "until", *t.Until)
+		return
+	}
+	err = r.store.Save(next)
+	switch {
+	case errors.Is(err, scheduler.ErrSeriesCancelled):
+		slog.Info("series cancelled, not re-enqueuing", "task_id", t.ID, "series_id", next.SeriesID)
+	case err != nil:
 		slog.Error("reschedule task", "task_id", t.ID, "error", err)
 	}
 }
 
+// followUp enqueues a succeeded task's on_success follow-up, under the id its
+// finalize recorded. Like reschedule it runs only once the success has stuck,
+// so a task cancelled mid-delivery enqueues nothing.
+//
+// ponytail: the follow-up is saved after the parent is finalized, not with
+// it; a crash in between loses the follow-up and leaves child_id naming a
+// task that never existed, as it would a recurring task's successor.
+func (r *Runner) followUp(t scheduler.Task, succeededAt time.Time) {
+	if t.Status != scheduler.StatusSucceeded || t.OnSuccess == nil {
+		return
+	}
+	child := t.OnSuccess.FollowUp(t.ChildID, t, succeededAt)
+	if err := r.store.Save(child); err != nil {
+		slog.Error("enqueue follow-up", "task_id", t.ID, "child_id", child.ID, "error", err)
+		return
+	}
+	slog.Info("enqueued follow-up", "task_id", t.ID, "child_id", child.ID, "execute_at", child.ExecuteAt)
+}
+
 // notifyFailure fires a single best-effort POST when a task exhausts its
 // retries, so a permanent failure is not silent. The task's own on_failure_url
 // wins; SCHEDY_ON_FAILURE_URL is the fallback. Fire-and-forget: the callback is
 // never retried, and a failing callback never triggers a callback about itself.
 func (r *Runner) notifyFailure(t scheduler.Task) {
-	url := t.OnFailureURL
+	// The task's own callback goes to the task's own receiver, so it is
+	// signed with the task's key and scheme; the global one is the operator's.
+	url, keyID, scheme := t.OnFailureURL, t.SigningKeyID, t.SigningScheme
 	if url == "" {
-		url = r.onFailureURL
+		url, keyID, scheme = r.onFailureURL, "", ""
 	}
 	if url == "" || len(t.Attempts) == 0 {
 		return
 	}
 	last := t.Attempts[len(t.Attempts)-1]
 	res := r.executor.Execute(scheduler.Task{
-		URL:    url,
-		Method: http.MethodPost,
+		URL:           url,
+		Method:        http.MethodPost,
+		SigningKeyID:  keyID,
+		SigningScheme: scheme,
 		Payload: map[string]any{
 			"id":          t.ID,
 			"status":      t.Status,
@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -29,29 +31,51 @@ func TestMain(m *testing.M) {
 // worker goroutine while the test writes to it, which is the whole point of
 // these tests, so the mutex is not optional.
 type fakeStore struct {
-	mu    sync.Mutex
-	tasks map[string]scheduler.Task
+	mu        sync.Mutex
+	tasks     map[string]scheduler.Task
+	paused    map[string]bool
+	maint     *scheduler.Maintenance
+	onPending func(scheduler.Task)
 }
 
 func newFakeStore() *fakeStore {
-	return &fakeStore{tasks: make(map[string]scheduler.Task)}
+	return &fakeStore{tasks: make(map[string]scheduler.Task), paused: make(map[string]bool)}
 }
 
 func (f *fakeStore) Save(task scheduler.Task) error {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	task.Status = scheduler.StatusPending
 	f.tasks[task.ID] = task
+	f.mu.Unlock()
+	f.written(task)
 	return nil
 }
 
 func (f *fakeStore) Update(task scheduler.Task) error {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.tasks[task.ID] = task
+	f.mu.Unlock()
+	f.written(task)
 	return nil
 }
 
+func (f *fakeStore) OnPending(fn func(scheduler.Task)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onPending = fn
+}
+
+// written calls the OnPending hook for a task just stored, as BadgerStore does
+// after commit. f.mu must not be held.
+func (f *fakeStore) written(task scheduler.Task) {
+	f.mu.Lock()
+	fn := f.onPending
+	f.mu.Unlock()
+	if fn != nil && task.Status == scheduler.StatusPending {
+		fn(task)
+	}
+}
+
 func (f *fakeStore) Delete(id string) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -69,16 +93,107 @@ func (f *fakeStore) GetTask(id string) (*scheduler.Task, error) {
 	return &task, nil
 }
 
-func (f *fakeStore) DeleteTasks(url, status string, before, after *time.Time) (int, error) {
+func (f *fakeStore) Transition(id string, from, to scheduler.TaskStatus, mutate func(*scheduler.Task) error) (*scheduler.Task, error) {
+	f.mu.Lock()
+	task, ok := f.tasks[id]
+	if !ok {
+		f.mu.Unlock()
+		return nil, scheduler.ErrNotFound
+	}
+	if task.Status != from {
+		f.mu.Unlock()
+		return nil, scheduler.ErrConflict
+	}
+	if mutate != nil {
+		if err := mutate(&task); err != nil {
+			f.mu.Unlock()
+			return nil, err
+		}
+	}
+	task.Status = to
+	f.tasks[id] = task
+	f.mu.Unlock()
+	f.written(task)
+	return &task, nil
+}
+
+func (f *fakeStore) FindDuplicate(key, url string, executeAt time.Time) (*scheduler.Task, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) DeleteTasks(filter scheduler.ListFilter) (int, error) {
 	return 0, nil
 }
 
+func (f *fakeStore) ListSeries(seriesID, cursor string, limit int) ([]scheduler.Task, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []scheduler.Task
+	for _, t := range f.tasks {
+		if t.SeriesID == seriesID {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RunNumber < out[j].RunNumber })
+	return out, "", nil
+}
+
+func (f *fakeStore) CancelSeries(seriesID string, at time.Time) (int, error) {
+	return 0, scheduler.ErrNotFound
+}
+
+func (f *fakeStore) CreateSigningKey(scheduler.SigningKey) error { return nil }
+
+func (f *fakeStore) RotateSigningKey(string, string, time.Time, time.Duration) (*scheduler.SigningKey, error) {
+	return nil, scheduler.ErrSigningKeyNotFound
+}
+
+func (f *fakeStore) SigningKey(string) (*scheduler.SigningKey, error) { return nil, nil }
+
+func (f *fakeStore) ListSigningKeys() ([]scheduler.SigningKey, error) { return nil, nil }
+
+func (f *fakeStore) DeleteSigningKey(string) error { return scheduler.ErrSigningKeyNotFound }
+
+func (f *fakeStore) SetQueuePaused(queue string, paused bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if paused {
+		f.paused[queue] = true
+	} else {
+		delete(f.paused, queue)
+	}
+	return nil
+}
+
+func (f *fakeStore) PausedQueues() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for queue := range f.paused {
+		out = append(out, queue)
+	}
+	return out, nil
+}
+
+func (f *fakeStore) SetMaintenance(m *scheduler.Maintenance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maint = m
+	return nil
+}
+
+func (f *fakeStore) Maintenance() (*scheduler.Maintenance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maint, nil
+}
+
 func (f *fakeStore) GetDueTasks(start, end time.Time, limit int) ([]scheduler.Task, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	var tasks []scheduler.Task
 	for _, task := range f.tasks {
-		if task.Status == scheduler.StatusPending && !task.ExecuteAt.After(end) {
+		if task.Status == scheduler.StatusPending && !task.DueAt().After(end) && !f.paused[task.QueueName()] {
 			tasks = append(tasks, task)
 		}
 	}
@@ -103,6 +218,25 @@ func (f *fakeStore) Counts(now time.Time) (scheduler.Counts, error) {
 	return scheduler.Counts{}, nil
 }
 
+// start runs r as main does and returns a stop func that cancels it and waits
+// for its drain. Stop is also registered as a cleanup, so a test that doesn't
+// care about shutdown can ignore it.
+func start(t *testing.T, r *Runner) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	stop = sync.OnceFunc(func() {
+		cancel()
+		<-done
+	})
+	t.Cleanup(stop)
+	return stop
+}
+
 // hitRecorder is a target server that reports the path of every delivery.
 func hitRecorder(t *testing.T) (*httptest.Server, chan string) {
 	t.Helper()
@@ -141,7 +275,7 @@ func TestFailureCallback(t *testing.T) {
 
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.onFailureURL = hook.URL
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		select {
 		case b := <-got:
@@ -183,7 +317,7 @@ func TestFailureCallback(t *testing.T) {
 
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.onFailureURL = global.URL
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		select {
 		case <-taskHook:
@@ -217,7 +351,7 @@ func TestFailureCallback(t *testing.T) {
 
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.onFailureURL = hook.URL
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		select {
 		case <-fired:
@@ -227,8 +361,8 @@ func TestFailureCallback(t *testing.T) {
 	})
 }
 
-// A task with a Schedule re-enqueues a fresh one-shot at fire_time+interval
-// after it fires; a task without one does not. Cancelling stops the chain,
+// A task with a Schedule re-enqueues a fresh one-shot at its schedule's next
+// time after it fires; a task without one does not. Cancelling stops the chain,
 // which the "cancel wins the race" case already covers (a cancelled task never
 // fires, so it never reschedules).
 func TestRecurringReschedule(t *testing.T) {
@@ -245,7 +379,7 @@ func TestRecurringReschedule(t *testing.T) {
 		}))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 		<-hits // original delivered
 
 		// The successor is a fresh, distinct, pending one-shot carrying the schedule.
@@ -260,6 +394,128 @@ func TestRecurringReschedule(t *testing.T) {
 		assert.Equal(t, "1h", next.Schedule, "the chain carries the schedule forward")
 		assert.Empty(t, next.Attempts, "the successor starts clean")
 		assert.True(t, next.ExecuteAt.After(time.Now().Add(30*time.Minute)), "next fires ~1h out")
+		assert.Equal(t, "rec1", next.SeriesID, "a chain without a series becomes one named after the run carrying it over")
+		assert.Equal(t, 2, next.RunNumber)
+	})
+
+	t.Run("a calendar task enqueues its next calendar time", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		// Half a day out, so the successor can't come due mid-test.
+		clock := time.Now().UTC().Add(12 * time.Hour).Format("15:04")
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:           "cal1",
+			URL:          srv.URL + "/ping",
+			ExecuteAt:    time.Now(),
+			Schedule:     "at=" + clock,
+			ScheduleType: scheduler.ScheduleCalendar,
+			Timezone:     "UTC",
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+		<-hits
+
+		require.Eventually(t, func() bool {
+			pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+			return len(pending) == 1
+		}, 2*time.Second, 20*time.Millisecond)
+		pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+		next := pending[0]
+		assert.Equal(t, clock, next.ExecuteAt.UTC().Format("15:04"))
+		assert.WithinDuration(t, time.Now().Add(12*time.Hour), next.ExecuteAt, time.Minute)
+		assert.Equal(t, scheduler.ScheduleCalendar, next.ScheduleType)
+	})
+
+	t.Run("catch_up all delivers each missed run, then carries on in phase", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		// Due 2h30m ago, hourly: the 1h30m-ago and 30m-ago runs were missed.
+		anchor := time.Now().Add(-150 * time.Minute)
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:        "late",
+			URL:       srv.URL + "/ping",
+			ExecuteAt: anchor,
+			Anchor:    &anchor,
+			Schedule:  "1h",
+			CatchUp:   scheduler.CatchUpAll,
+		}))
+
+		r := New(store, executor.NewExecutor(), 50*time.Millisecond)
+		start(t, r)
+		for i := 0; i < 3; i++ {
+			select {
+			case <-hits:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("delivery %d never came", i+1)
+			}
+		}
+
+		var pending []scheduler.Task
+		require.Eventually(t, func() bool {
+			pending, _, _ = store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+			return len(pending) == 1
+		}, 2*time.Second, 20*time.Millisecond)
+		assert.True(t, anchor.Add(3*time.Hour).Equal(pending[0].ExecuteAt), "back in phase")
+		assert.Equal(t, 4, pending[0].RunNumber)
+	})
+
+	t.Run("the series and run number carry through", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:        "rec5",
+			URL:       srv.URL + "/ping",
+			ExecuteAt: time.Now(),
+			Schedule:  "1h",
+			SeriesID:  "rec1",
+			RunNumber: 5,
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+		<-hits
+
+		require.Eventually(t, func() bool {
+			runs, _, _ := store.ListSeries("rec1", "", 0)
+			return len(runs) == 2
+		}, 2*time.Second, 20*time.Millisecond)
+		runs, _, _ := store.ListSeries("rec1", "", 0)
+		assert.Equal(t, 6, runs[1].RunNumber)
+	})
+
+	endsAfterOneRun := func(t *testing.T, task scheduler.Task) {
+		t.Helper()
+		srv, hits := hitRecorder(t)
+		task.URL = srv.URL + "/ping"
+		task.ExecuteAt = time.Now()
+		task.Schedule = "1h"
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(task))
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+		<-hits
+
+		require.Eventually(t, func() bool {
+			got, _ := store.GetTask(task.ID)
+			return got != nil && got.Status == scheduler.StatusSucceeded
+		}, 2*time.Second, 20*time.Millisecond)
+		time.Sleep(50 * time.Millisecond) // the successor would be saved right after
+		all, _, _ := store.ListTasks(scheduler.ListFilter{}, "", 0)
+		assert.Len(t, all, 1, "the chain ended")
+	}
+
+	t.Run("max_runs ends the chain", func(t *testing.T) {
+		endsAfterOneRun(t, scheduler.Task{ID: "last", SeriesID: "s", RunNumber: 3, MaxRuns: 3})
+	})
+
+	t.Run("until ends the chain", func(t *testing.T) {
+		until := time.Now().Add(30 * time.Minute)
+		endsAfterOneRun(t, scheduler.Task{ID: "final", Until: &until})
 	})
 
 	t.Run("non-recurring task does not re-enqueue", func(t *testing.T) {
@@ -274,7 +530,7 @@ func TestRecurringReschedule(t *testing.T) {
 		}))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 		<-hits
 
 		require.Eventually(t, func() bool {
@@ -287,10 +543,84 @@ func TestRecurringReschedule(t *testing.T) {
 	})
 }
 
+// A task's on_success follow-up is enqueued when, and only when, it succeeds,
+// linked to it both ways.
+func TestFollowUp(t *testing.T) {
+	t.Run("success enqueues the follow-up", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:        "step-a",
+			URL:       srv.URL + "/a",
+			ExecuteAt: time.Now().Add(100 * time.Millisecond),
+			Status:    scheduler.StatusPending,
+			OnSuccess: &scheduler.TaskTemplate{
+				TaskSpec: scheduler.TaskSpec{
+					URL:     srv.URL + "/b",
+					Method:  http.MethodPost,
+					Payload: map[string]any{"step": "b"},
+					Queue:   scheduler.DefaultQueue,
+				},
+				Delay: "1h", // far enough out that it won't fire mid-test
+			},
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+		<-hits
+
+		require.Eventually(t, func() bool {
+			pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+			return len(pending) == 1
+		}, 2*time.Second, 20*time.Millisecond)
+		pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+		child := pending[0]
+		parent, err := store.GetTask("step-a")
+		require.NoError(t, err)
+
+		assert.Equal(t, scheduler.StatusSucceeded, parent.Status)
+		assert.Equal(t, child.ID, parent.ChildID, "the parent names its follow-up")
+		assert.Equal(t, "step-a", child.ParentID, "the follow-up names its parent")
+		assert.Equal(t, srv.URL+"/b", child.URL)
+		assert.Equal(t, map[string]any{"step": "b"}, child.Payload)
+		assert.WithinDuration(t, parent.FinishedAt.Add(time.Hour), child.ExecuteAt, time.Second, "due delay after the success")
+	})
+
+	t.Run("failure enqueues nothing", func(t *testing.T) {
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(target.Close)
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:        "step-a",
+			URL:       target.URL,
+			ExecuteAt: time.Now().Add(100 * time.Millisecond),
+			Status:    scheduler.StatusPending,
+			OnSuccess: &scheduler.TaskTemplate{TaskSpec: scheduler.TaskSpec{URL: target.URL, Method: http.MethodPost}},
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+
+		require.Eventually(t, func() bool {
+			got, _ := store.GetTask("step-a")
+			return got != nil && got.Status == scheduler.StatusFailed
+		}, 2*time.Second, 20*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		all, _, _ := store.ListTasks(scheduler.ListFilter{}, "", 0)
+		assert.Len(t, all, 1)
+		got, _ := store.GetTask("step-a")
+		assert.Empty(t, got.ChildID)
+	})
+}
+
 // The runner pre-fetches everything due in the next interval and holds an
-// in-memory copy until each task's timer fires. These tests cover what happens
+// in-memory copy until each task comes due. These tests cover what happens
 // when the task is edited inside that window.
-func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
+func TestRereadsTaskBeforeFiring(t *testing.T) {
 	t.Run("reschedule drops the run", func(t *testing.T) {
 		srv, hits := hitRecorder(t)
 
@@ -304,7 +634,7 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 		require.NoError(t, store.Save(task))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		// Push the task an hour out while the runner still holds the stale copy.
 		moved := task
@@ -336,7 +666,7 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 		require.NoError(t, store.Save(task))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		// Same execute_at, different target.
 		edited := task
@@ -378,7 +708,7 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 		require.NoError(t, store.Save(task))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		// Arm retries that the stale copy does not have.
 		edited := task
@@ -386,6 +716,7 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 		edited.RetryInterval = 10
 		require.NoError(t, store.Update(edited))
 
+		// Each retry waits in the store and wakes the runner when written.
 		require.Eventually(t, func() bool {
 			got, err := store.GetTask("t4")
 			return err == nil && got != nil && got.Status == scheduler.StatusFailed
@@ -407,7 +738,7 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 		require.NoError(t, store.Save(task))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		cancelled := task
 		cancelled.Status = scheduler.StatusCancelled
@@ -421,6 +752,256 @@ func TestRunOnceRereadsTaskBeforeFiring(t *testing.T) {
 	})
 }
 
+// A cancel that lands while a delivery is in flight must stick: the finalize
+// can't overwrite it, and a recurring chain must stop there.
+func TestCancelDuringDeliveryWins(t *testing.T) {
+	release := make(chan struct{})
+	releaseAll := sync.OnceFunc(func() { close(release) })
+	t.Cleanup(releaseAll)
+	arrived := make(chan struct{}, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(target.Close)
+
+	store := newFakeStore()
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:        "mid",
+		URL:       target.URL,
+		ExecuteAt: time.Now(),
+		Status:    scheduler.StatusPending,
+		Schedule:  "1h",
+	}))
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	stop := start(t, r)
+
+	select {
+	case <-arrived:
+	case <-time.After(2 * time.Second):
+		t.Fatal("task never fired")
+	}
+	// What DELETE /tasks/{id} does, mid-delivery.
+	_, err := store.Transition("mid", scheduler.StatusRunning, scheduler.StatusCancelled, nil)
+	require.NoError(t, err)
+	releaseAll()
+	stop()
+
+	got, err := store.GetTask("mid")
+	require.NoError(t, err)
+	assert.Equal(t, scheduler.StatusCancelled, got.Status, "finalize overwrote the cancel")
+	assert.Len(t, got.Attempts, 1, "the delivery that went out is still recorded")
+
+	all, _, _ := store.ListTasks(scheduler.ListFilter{}, "", 0)
+	assert.Len(t, all, 1, "a cancelled recurring task must not reschedule")
+}
+
+// A task written after the runner's last poll must not wait for the next one:
+// the store's hook wakes the runner, which fires it on time.
+func TestNewTaskWakesRunner(t *testing.T) {
+	srv, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	r := New(store, executor.NewExecutor(), time.Hour) // the poll would never come
+	start(t, r)
+	time.Sleep(50 * time.Millisecond) // let the first poll go by, empty
+
+	due := time.Now().Add(200 * time.Millisecond)
+	require.NoError(t, store.Save(scheduler.Task{ID: "soon", URL: srv.URL + "/soon", ExecuteAt: due}))
+
+	select {
+	case <-hits:
+		assert.WithinDuration(t, due, time.Now(), 150*time.Millisecond, "fired off schedule")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the hook never woke the runner")
+	}
+
+	// A task beyond the poll window is left for the poll that covers it.
+	require.NoError(t, store.Save(scheduler.Task{ID: "later", URL: srv.URL + "/later", ExecuteAt: time.Now().Add(2 * time.Hour)}))
+	r.qmu.Lock()
+	_, queued := r.queued.latest["later"]
+	r.qmu.Unlock()
+	assert.False(t, queued, "the queue only holds the current poll window")
+}
+
+// A failed attempt with retries left goes back to the store as a pending task
+// due at its next attempt, so the retry survives a restart and its slot is free
+// for other work while it waits.
+func TestRetryWaitsInTheStore(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(target.Close)
+
+	store := newFakeStore()
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:            "flaky",
+		URL:           target.URL,
+		ExecuteAt:     time.Now(),
+		Retries:       3,
+		RetryInterval: int(time.Hour / time.Millisecond),
+		Schedule:      "24h",
+	}))
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.sem = newSlots(1)
+	stop := start(t, r)
+
+	var got *scheduler.Task
+	require.Eventually(t, func() bool {
+		got, _ = store.GetTask("flaky")
+		return got != nil && got.RetryCount == 1
+	}, 2*time.Second, 10*time.Millisecond, "the failed attempt never scheduled a retry")
+	assert.Equal(t, scheduler.StatusPending, got.Status, "a retry waits as pending")
+	assert.Equal(t, 1, got.RetryCount)
+	require.NotNil(t, got.NextAttemptAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *got.NextAttemptAt, time.Minute)
+	assert.Nil(t, got.FinishedAt)
+	require.Len(t, got.Attempts, 1)
+	require.Eventually(t, func() bool { return r.sem.inUse() == 0 }, time.Second, 10*time.Millisecond,
+		"the slot is released while the retry waits")
+
+	// Not due yet: nothing fires while it waits.
+	time.Sleep(200 * time.Millisecond)
+	assert.EqualValues(t, 1, hits.Load())
+	stop()
+
+	// Bring the retry due, as a restart an hour later would find it.
+	due := time.Now().Add(-time.Second)
+	firstFired := got.Attempts[0].FiredAt
+	got.NextAttemptAt = &due
+	require.NoError(t, store.Update(*got))
+	start(t, New(store, executor.NewExecutor(), time.Second))
+
+	require.Eventually(t, func() bool {
+		got, _ = store.GetTask("flaky")
+		return got != nil && got.Status == scheduler.StatusSucceeded
+	}, 2*time.Second, 10*time.Millisecond, "the resumed retry never delivered")
+	assert.Nil(t, got.NextAttemptAt)
+	require.Len(t, got.Attempts, 2)
+	assert.Equal(t, 2, got.Attempts[1].N)
+
+	// The successor is anchored to the run's first attempt, not the retry.
+	pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+	require.Len(t, pending, 1)
+	assert.WithinDuration(t, firstFired.Add(24*time.Hour), pending[0].ExecuteAt, time.Second)
+	assert.Zero(t, pending[0].RetryCount, "the successor starts with a fresh budget")
+}
+
+// A run cut off by shutdown, resumed and then retried is still anchored to its
+// first attempt: the interrupted attempt spends no retry, so counting back
+// RetryCount attempts would land on the resumed one instead.
+func TestInterruptedRunKeepsItsStart(t *testing.T) {
+	var hits atomic.Int32
+	arrived := make(chan struct{}, 1)
+	hung := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch hits.Add(1) {
+		case 1: // hangs past the drain
+			arrived <- struct{}{}
+			select {
+			case <-hung:
+			case <-r.Context().Done():
+			}
+		case 2:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(func() { close(hung); target.Close() })
+
+	store := newFakeStore()
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:            "nightly",
+		URL:           target.URL,
+		ExecuteAt:     time.Now(),
+		Retries:       2,
+		RetryInterval: 10,
+		Schedule:      "24h",
+	}))
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.drainTimeout = 100 * time.Millisecond
+	stop := start(t, r)
+	select {
+	case <-arrived:
+	case <-time.After(2 * time.Second):
+		t.Fatal("task never fired")
+	}
+	stop()
+
+	got, err := store.GetTask("nightly")
+	require.NoError(t, err)
+	require.Equal(t, scheduler.StatusPending, got.Status)
+	require.Len(t, got.Attempts, 1)
+	require.NotNil(t, got.RunStartedAt, "the run's start is stored with the interruption")
+	runStart := *got.RunStartedAt
+
+	// Resumed later: one failure, then a retry that succeeds.
+	time.Sleep(50 * time.Millisecond)
+	start(t, New(store, executor.NewExecutor(), time.Second))
+	require.Eventually(t, func() bool {
+		got, _ = store.GetTask("nightly")
+		return got != nil && got.Status == scheduler.StatusSucceeded
+	}, 2*time.Second, 10*time.Millisecond, "the resumed run never delivered")
+	require.Len(t, got.Attempts, 3)
+	assert.Equal(t, 1, got.RetryCount)
+	assert.True(t, runStart.Equal(*got.RunStartedAt))
+
+	pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
+	require.Len(t, pending, 1)
+	assert.True(t, runStart.Add(24*time.Hour).Equal(pending[0].ExecuteAt),
+		"successor at %s, want 24h after the run's first attempt at %s", pending[0].ExecuteAt, runStart)
+	assert.Nil(t, pending[0].RunStartedAt, "the successor's run hasn't started")
+}
+
+// A retry that comes due past SCHEDY_MAX_STALENESS is skipped like any other
+// stale task, judged by its own due time rather than the original execute_at.
+func TestStaleRetryIsSkipped(t *testing.T) {
+	srv, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	long := time.Now().Add(-6 * time.Hour)
+	recent := time.Now().Add(-time.Second)
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:            "stale-retry",
+		URL:           srv.URL + "/stale",
+		ExecuteAt:     long,
+		Retries:       3,
+		NextAttemptAt: &long,
+		RetryCount:    1,
+	}))
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:            "fresh-retry",
+		URL:           srv.URL + "/fresh",
+		ExecuteAt:     long, // the task is old, but its retry is not
+		Retries:       3,
+		NextAttemptAt: &recent,
+		RetryCount:    1,
+	}))
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.maxStaleness = time.Hour
+	start(t, r)
+
+	select {
+	case path := <-hits:
+		assert.Equal(t, "/fresh", path)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the retry inside the window did not fire")
+	}
+	require.Eventually(t, func() bool {
+		stale, _ := store.GetTask("stale-retry")
+		return stale.Status == scheduler.StatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+	stale, _ := store.GetTask("stale-retry")
+	assert.Equal(t, scheduler.StatusFailed, stale.Status)
+	assert.Nil(t, stale.NextAttemptAt)
+}
+
 // A backlog must not become a thundering herd. Whatever the outage left behind,
 // the runner may only hold maxConcurrent deliveries open at once.
 func TestConcurrencyIsBounded(t *testing.T) {
@@ -464,8 +1045,8 @@ func TestConcurrencyIsBounded(t *testing.T) {
 	}
 
 	r := New(store, executor.NewExecutor(), time.Second)
-	r.sem = make(chan struct{}, limit)
-	r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+	r.sem = newSlots(limit)
+	start(t, r)
 
 	// Let the first wave saturate. Give the excess goroutines time to pile in
 	// too, so an unbounded runner is caught rather than merely slow.
@@ -491,10 +1072,160 @@ func TestConcurrencyIsBounded(t *testing.T) {
 	mu.Unlock()
 }
 
+// A destination at its own cap waits without holding a global slot, so a backlog
+// for one slow host can't starve deliveries to every other.
+func TestDestinationCapDoesNotStarveOthers(t *testing.T) {
+	release := make(chan struct{})
+	releaseAll := sync.OnceFunc(func() { close(release) })
+
+	var slowActive, slowPeak atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := slowActive.Add(1)
+		if n > slowPeak.Load() {
+			slowPeak.Store(n)
+		}
+		<-release
+		slowActive.Add(-1)
+	}))
+	t.Cleanup(slow.Close)
+	fast, hits := hitRecorder(t)
+
+	// Both servers are on loopback, so the slow ones are told apart by their
+	// declared destination rather than by host.
+	store := newFakeStore()
+	for i := 0; i < 6; i++ {
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:          fmt.Sprintf("slow%d", i),
+			URL:         slow.URL,
+			Destination: "partner",
+			ExecuteAt:   time.Now().Add(-time.Minute),
+		}))
+	}
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.sem = newSlots(2)
+	r.limits = newLimits([]limitRule{{pattern: "partner", concurrent: 1, burst: 1}})
+	start(t, r)
+	// Registered last so it runs first: the runner's drain and the servers'
+	// Close both wait on the parked handlers.
+	t.Cleanup(releaseAll)
+
+	require.Eventually(t, func() bool { return slowActive.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, store.Save(scheduler.Task{ID: "fast", URL: fast.URL + "/fast", ExecuteAt: time.Now()}))
+
+	select {
+	case got := <-hits:
+		assert.Equal(t, "/fast", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("a delivery to another destination was starved by the capped one")
+	}
+	assert.EqualValues(t, 1, slowPeak.Load(), "the destination cap was exceeded")
+
+	releaseAll()
+	require.Eventually(t, func() bool {
+		done, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusSucceeded)}, "", 0)
+		return len(done) == 7
+	}, 5*time.Second, 20*time.Millisecond, "the capped backlog did not drain")
+	assert.EqualValues(t, 1, slowPeak.Load(), "the destination cap was exceeded while draining")
+}
+
+// Once a host's breaker opens, its tasks are deferred in the store rather than
+// spending their retries against it: nothing fails while the host is down.
+func TestBreakerDefersDeliveries(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(target.Close)
+
+	store := newFakeStore()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:            fmt.Sprintf("down%d", i),
+			URL:           target.URL,
+			ExecuteAt:     time.Now().Add(-time.Minute),
+			Retries:       3,
+			RetryInterval: 10,
+		}))
+	}
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.sem = newSlots(1) // one at a time, so the trip point is exact
+	r.breakers = newBreakers(2, time.Hour)
+	start(t, r)
+
+	require.Eventually(t, func() bool {
+		all, _, _ := store.ListTasks(scheduler.ListFilter{}, "", 0)
+		for _, task := range all {
+			if task.Status != scheduler.StatusPending || task.NextAttemptAt == nil ||
+				task.NextAttemptAt.Before(time.Now().Add(30*time.Minute)) {
+				return false
+			}
+		}
+		return true
+	}, 3*time.Second, 10*time.Millisecond, "tasks were not deferred past the cool-down")
+
+	assert.EqualValues(t, 2, hits.Load(), "deliveries kept going to a host with an open breaker")
+	all, _, _ := store.ListTasks(scheduler.ListFilter{}, "", 0)
+	for _, task := range all {
+		assert.LessOrEqual(t, task.RetryCount, 1, "a deferral used up a retry")
+	}
+
+	breakers := r.Breakers()
+	require.Len(t, breakers, 1)
+	assert.Equal(t, scheduler.BreakerOpen, breakers[0].State)
+	assert.True(t, r.ResetBreaker(strings.ToUpper(breakers[0].Host)), "hosts are case-insensitive")
+	assert.Empty(t, r.Breakers())
+}
+
+// A delivery that never goes out - here, signed with a key that doesn't exist -
+// is no news about the host: as a half-open breaker's probe it neither closes
+// the breaker nor keeps the probe, so the next delivery probes instead.
+func TestUnsentProbeLeavesBreakerOpen(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	t.Cleanup(target.Close)
+	host := breakerHost(scheduler.Task{URL: target.URL})
+
+	store := newFakeStore()
+	require.NoError(t, store.Save(scheduler.Task{
+		ID:           "unsigned",
+		URL:          target.URL,
+		ExecuteAt:    time.Now().Add(-time.Minute),
+		SigningKeyID: "gone",
+	}))
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.breakers = newBreakers(1, time.Hour)
+	// Tripped, with the cool-down just over: the next delivery is the probe.
+	r.breakers.byHost[host] = &breaker{state: scheduler.BreakerOpen, failures: 1, until: time.Now()}
+	start(t, r)
+
+	require.Eventually(t, func() bool {
+		got, _ := store.GetTask("unsigned")
+		return got != nil && got.Status == scheduler.StatusFailed
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Zero(t, hits.Load())
+	breakers := r.Breakers()
+	require.Len(t, breakers, 1, "a signing failure closed the breaker")
+	assert.Equal(t, scheduler.BreakerOpen, breakers[0].State)
+	assert.Equal(t, 1, breakers[0].Failures, "a signing failure counted against the host")
+
+	require.NoError(t, store.Save(scheduler.Task{ID: "probe", URL: target.URL, ExecuteAt: time.Now()}))
+	require.Eventually(t, func() bool {
+		got, _ := store.GetTask("probe")
+		return got != nil && got.Status == scheduler.StatusSucceeded
+	}, 2*time.Second, 10*time.Millisecond, "the next delivery didn't get the probe")
+	assert.Empty(t, r.Breakers())
+}
+
 // A task waits in the store as pending until it actually fires, so a task still
-// queued behind the concurrency cap is visible to the next tick. It must not be
+// queued behind the concurrency cap is visible to the next poll. It must not be
 // delivered twice.
-func TestNoDoubleDeliveryAcrossTicks(t *testing.T) {
+func TestNoDoubleDeliveryAcrossPolls(t *testing.T) {
 	var hits atomic.Int32
 	release := make(chan struct{})
 	releaseAll := sync.OnceFunc(func() { close(release) })
@@ -515,11 +1246,13 @@ func TestNoDoubleDeliveryAcrossTicks(t *testing.T) {
 	}))
 
 	r := New(store, executor.NewExecutor(), time.Second)
-	r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+	start(t, r)
 	require.Eventually(t, func() bool { return hits.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
 
-	// Second tick while the first delivery is still in flight.
-	r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+	// Another poll while the first delivery is still in flight, and a pass
+	// over the queue to dispatch what it found.
+	r.poll(time.Now())
+	r.wake <- struct{}{}
 	time.Sleep(200 * time.Millisecond)
 	assert.EqualValues(t, 1, hits.Load(), "an in-flight task was picked up twice")
 
@@ -555,7 +1288,7 @@ func TestMaxStaleness(t *testing.T) {
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.maxStaleness = time.Hour
 		r.onFailureURL = hook.URL
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		require.Eventually(t, func() bool {
 			task, _ := store.GetTask("ancient")
@@ -590,7 +1323,7 @@ func TestMaxStaleness(t *testing.T) {
 
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.maxStaleness = time.Hour
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		select {
 		case <-hits:
@@ -611,7 +1344,7 @@ func TestMaxStaleness(t *testing.T) {
 		}))
 
 		r := New(store, executor.NewExecutor(), time.Second) // maxStaleness unset
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		select {
 		case <-hits:
@@ -633,7 +1366,7 @@ func TestMaxStaleness(t *testing.T) {
 
 		r := New(store, executor.NewExecutor(), time.Second)
 		r.maxStaleness = time.Minute
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		start(t, r)
 
 		require.Eventually(t, func() bool {
 			pending, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusPending)}, "", 0)
@@ -646,6 +1379,90 @@ func TestMaxStaleness(t *testing.T) {
 	})
 }
 
+func TestTaskDeadline(t *testing.T) {
+	t.Run("an expired task is retired, not delivered", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:          "otp",
+			URL:         srv.URL + "/otp",
+			ExecuteAt:   time.Now().Add(-10 * time.Minute),
+			MaxLateness: "5m",
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second) // maxStaleness unset
+		start(t, r)
+
+		require.Eventually(t, func() bool {
+			task, _ := store.GetTask("otp")
+			return task != nil && task.Status == scheduler.StatusFailed
+		}, 2*time.Second, 20*time.Millisecond, "the expired task was not retired")
+		assert.Empty(t, hits)
+
+		task, _ := store.GetTask("otp")
+		require.Len(t, task.Attempts, 1)
+		assert.Contains(t, task.Attempts[0].Error, "skipped: expired at")
+		assert.NotNil(t, task.FinishedAt)
+	})
+
+	t.Run("a deadline outlasts the server-wide staleness limit", func(t *testing.T) {
+		srv, hits := hitRecorder(t)
+
+		store := newFakeStore()
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:          "invoice",
+			URL:         srv.URL + "/invoice",
+			ExecuteAt:   time.Now().Add(-6 * time.Hour),
+			MaxLateness: "720h",
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		r.maxStaleness = time.Hour
+		start(t, r)
+
+		select {
+		case <-hits:
+		case <-time.After(2 * time.Second):
+			t.Fatal("a task within its own deadline was skipped as stale")
+		}
+	})
+
+	t.Run("the deadline holds for retries", func(t *testing.T) {
+		var calls atomic.Int32
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		t.Cleanup(target.Close)
+
+		store := newFakeStore()
+		expire := time.Now().Add(300 * time.Millisecond)
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:            "flaky",
+			URL:           target.URL,
+			ExecuteAt:     time.Now(),
+			ExpireAt:      &expire,
+			Retries:       5,
+			RetryInterval: 200,
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		start(t, r)
+
+		require.Eventually(t, func() bool {
+			task, _ := store.GetTask("flaky")
+			return task != nil && task.Status == scheduler.StatusFailed
+		}, 3*time.Second, 20*time.Millisecond, "the retries outlived the deadline")
+
+		task, _ := store.GetTask("flaky")
+		last := task.Attempts[len(task.Attempts)-1]
+		assert.Contains(t, last.Error, "skipped: expired at")
+		assert.Less(t, int(calls.Load()), 6, "retries past the deadline are not delivered")
+		assert.Less(t, task.RetryCount, 5)
+	})
+}
+
 // A replayed task keeps its earlier attempts, so the numbering must continue
 // rather than restart - two attempts both called "n: 1" make the log unreadable
 // at exactly the moment someone is reading it.
@@ -666,7 +1483,7 @@ func TestAttemptNumberingContinuesAfterReplay(t *testing.T) {
 	}))
 
 	r := New(store, executor.NewExecutor(), time.Second)
-	r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+	start(t, r)
 	<-hits
 
 	require.Eventually(t, func() bool {
@@ -692,11 +1509,10 @@ func TestShutdownDrain(t *testing.T) {
 		r := New(store, executor.NewExecutor(), time.Second)
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
-		r.runOnce(ctx, time.Now(), time.Now().Add(time.Second))
 
-		start := time.Now()
-		r.drain(2 * time.Second)
-		assert.Less(t, time.Since(start), time.Second, "drain must not wait out the pre-fire timer")
+		began := time.Now()
+		r.Start(ctx)
+		assert.Less(t, time.Since(began), 500*time.Millisecond, "shutdown must not wait for the task to come due")
 
 		task, err := store.GetTask("d1")
 		require.NoError(t, err)
@@ -707,7 +1523,9 @@ func TestShutdownDrain(t *testing.T) {
 
 	t.Run("in-flight delivery records its outcome before drain returns", func(t *testing.T) {
 		release := make(chan struct{})
+		arrived := make(chan struct{}, 1)
 		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived <- struct{}{}
 			<-release
 		}))
 		t.Cleanup(target.Close)
@@ -721,17 +1539,233 @@ func TestShutdownDrain(t *testing.T) {
 		}))
 
 		r := New(store, executor.NewExecutor(), time.Second)
-		r.runOnce(context.Background(), time.Now(), time.Now().Add(time.Second))
+		stop := start(t, r)
 
+		select {
+		case <-arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatal("task never fired")
+		}
 		go func() {
 			time.Sleep(200 * time.Millisecond)
 			close(release)
 		}()
-		r.drain(5 * time.Second)
+		stop()
 
 		task, err := store.GetTask("d2")
 		require.NoError(t, err)
 		require.NotNil(t, task)
 		assert.Equal(t, scheduler.StatusSucceeded, task.Status)
 	})
+	t.Run("delivery outlasting the drain is written back pending", func(t *testing.T) {
+		arrived := make(chan struct{}, 1)
+		hung := make(chan struct{})
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived <- struct{}{}
+			select {
+			case <-hung:
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(func() { close(hung); target.Close() })
+
+		// Mid-run: one attempt already failed and one retry spent.
+		store := newFakeStore()
+		retryAt := time.Now().UTC()
+		require.NoError(t, store.Update(scheduler.Task{
+			ID:            "d3",
+			URL:           target.URL,
+			ExecuteAt:     retryAt.Add(-time.Minute),
+			Status:        scheduler.StatusPending,
+			Retries:       3,
+			RetryCount:    1,
+			NextAttemptAt: &retryAt,
+			Attempts:      []scheduler.Attempt{{N: 1, StatusCode: 500, Error: "unexpected status code: 500"}},
+		}))
+
+		r := New(store, executor.NewExecutor(), time.Second)
+		r.drainTimeout = 100 * time.Millisecond
+		stop := start(t, r)
+
+		select {
+		case <-arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatal("task never fired")
+		}
+		stop()
+
+		task, err := store.GetTask("d3")
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		assert.Equal(t, scheduler.StatusPending, task.Status, "never left running for recovery to guess at")
+		assert.Equal(t, 1, task.RetryCount, "an interruption doesn't spend a retry")
+		require.NotNil(t, task.NextAttemptAt)
+		assert.True(t, retryAt.Equal(*task.NextAttemptAt), "still due when it was, so it fires first on restart")
+		require.Len(t, task.Attempts, 2, "earlier attempts are kept")
+		assert.Contains(t, task.Attempts[1].Error, "interrupted by shutdown")
+		assert.Nil(t, task.FinishedAt)
+	})
+}
+
+// A paused queue's tasks stay pending and undelivered, while other queues keep
+// going; resuming it delivers the backlog without waiting for the next poll.
+func TestPausedQueueWaitsForResume(t *testing.T) {
+	srv, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	r := New(store, executor.NewExecutor(), time.Hour)
+	r.queues = newQueues([]queueConfig{{name: scheduler.DefaultQueue}, {name: "bulk"}}, nil)
+	require.NoError(t, r.PauseQueue("bulk"))
+	assert.ErrorIs(t, r.PauseQueue("nope"), scheduler.ErrUnknownQueue)
+	start(t, r)
+
+	require.NoError(t, store.Save(scheduler.Task{ID: "held", Queue: "bulk", URL: srv.URL + "/held", ExecuteAt: time.Now()}))
+	require.NoError(t, store.Save(scheduler.Task{ID: "free", URL: srv.URL + "/free", ExecuteAt: time.Now()}))
+
+	select {
+	case got := <-hits:
+		assert.Equal(t, "/free", got, "a paused queue doesn't hold up the others")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the unpaused queue was not delivered")
+	}
+	select {
+	case got := <-hits:
+		t.Fatalf("delivered %s from a paused queue", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+	held, _ := store.GetTask("held")
+	assert.Equal(t, scheduler.StatusPending, held.Status)
+	assert.Empty(t, held.Attempts, "a pause costs the task nothing")
+
+	require.NoError(t, r.ResumeQueue("bulk"))
+	select {
+	case got := <-hits:
+		assert.Equal(t, "/held", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the resumed queue's backlog was not delivered")
+	}
+	paused, _ := store.PausedQueues()
+	assert.Empty(t, paused, "the resume is stored")
+}
+
+// Maintenance holds every delivery, and is stored, so a restart mid-pause comes
+// back paused; the resume delivers the backlog.
+func TestMaintenanceHoldsDeliveries(t *testing.T) {
+	srv, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	r := New(store, executor.NewExecutor(), time.Hour)
+	m, err := r.Pause(nil)
+	require.NoError(t, err)
+	assert.Nil(t, m.Until)
+	until := time.Now().Add(time.Hour)
+	again, err := r.Pause(&until)
+	require.NoError(t, err)
+	assert.True(t, again.Since.Equal(m.Since), "pausing again keeps when the pause began")
+	start(t, r)
+
+	require.NoError(t, store.Save(scheduler.Task{ID: "held", URL: srv.URL + "/held", ExecuteAt: time.Now()}))
+	select {
+	case got := <-hits:
+		t.Fatalf("delivered %s during maintenance", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+	held, _ := store.GetTask("held")
+	assert.Equal(t, scheduler.StatusPending, held.Status)
+
+	restarted := New(store, executor.NewExecutor(), time.Hour)
+	require.NotNil(t, restarted.Maintenance(), "the pause outlives a restart")
+	assert.True(t, m.Since.Equal(restarted.Maintenance().Since))
+
+	require.NoError(t, r.Resume())
+	select {
+	case got := <-hits:
+		assert.Equal(t, "/held", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the backlog was not delivered on resume")
+	}
+	assert.Nil(t, r.Maintenance())
+	stored, _ := store.Maintenance()
+	assert.Nil(t, stored, "the resume is stored")
+}
+
+func TestMaintenanceEndsAtUntil(t *testing.T) {
+	srv, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	r := New(store, executor.NewExecutor(), time.Hour)
+	until := time.Now().Add(400 * time.Millisecond)
+	_, err := r.Pause(&until)
+	require.NoError(t, err)
+	start(t, r)
+
+	require.NoError(t, store.Save(scheduler.Task{ID: "held", URL: srv.URL + "/held", ExecuteAt: time.Now()}))
+	select {
+	case got := <-hits:
+		assert.False(t, time.Now().Before(until), "delivered before the pause ran out")
+		assert.Equal(t, "/held", got)
+	case <-time.After(3 * time.Second):
+		t.Fatal("deliveries did not resume at until")
+	}
+	assert.Nil(t, r.Maintenance())
+	stored, _ := store.Maintenance()
+	assert.Nil(t, stored)
+}
+
+func TestQueueConcurrencyCap(t *testing.T) {
+	release := make(chan struct{})
+	releaseAll := sync.OnceFunc(func() { close(release) })
+
+	var active, peak atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		<-release
+		active.Add(-1)
+	}))
+	t.Cleanup(slow.Close)
+	fast, hits := hitRecorder(t)
+
+	store := newFakeStore()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, store.Save(scheduler.Task{
+			ID:        fmt.Sprintf("report%d", i),
+			Queue:     "reports",
+			URL:       slow.URL,
+			ExecuteAt: time.Now().Add(-time.Minute),
+		}))
+	}
+
+	r := New(store, executor.NewExecutor(), time.Second)
+	r.sem = newSlots(4)
+	r.queues = newQueues([]queueConfig{{name: scheduler.DefaultQueue}, {name: "reports", concurrent: 2}}, nil)
+	start(t, r)
+	t.Cleanup(releaseAll)
+
+	require.Eventually(t, func() bool { return active.Load() == 2 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, store.Save(scheduler.Task{ID: "fast", URL: fast.URL + "/fast", ExecuteAt: time.Now()}))
+	select {
+	case got := <-hits:
+		assert.Equal(t, "/fast", got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the default queue was starved by a capped one")
+	}
+	assert.EqualValues(t, 2, peak.Load(), "the queue cap was exceeded")
+
+	var reports scheduler.QueueStatus
+	for _, q := range r.Queues() {
+		if q.Name == "reports" {
+			reports = q
+		}
+	}
+	assert.Equal(t, 2, reports.Inflight)
+
+	releaseAll()
+	require.Eventually(t, func() bool {
+		done, _, _ := store.ListTasks(scheduler.ListFilter{Status: string(scheduler.StatusSucceeded)}, "", 0)
+		return len(done) == 5
+	}, 5*time.Second, 20*time.Millisecond, "the capped backlog did not drain")
+	assert.EqualValues(t, 2, peak.Load(), "the queue cap was exceeded while draining")
 }
@@ -0,0 +1,125 @@
+package runner
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+)
+
+// slots is the global delivery semaphore (SCHEDY_MAX_CONCURRENT_DELIVERIES).
+//
+// A buffered channel would do as a semaphore, but it admits its waiters in no
+// particular order. slots hands each freed slot to the highest-priority waiter,
+// the one due longest ago among equals, so after an outage an urgent task
+// queued behind a month of digests is next in, not somewhere in the middle.
+type slots struct {
+	mu      sync.Mutex
+	size    int
+	free    int
+	waiters waitHeap
+	seq     uint64 // arrival order, the last tie-break
+}
+
+func newSlots(n int) *slots {
+	return &slots{size: n, free: n}
+}
+
+// acquire waits for a slot for t. It reports false, holding nothing, if ctx
+// ends first.
+func (s *slots) acquire(ctx context.Context, t scheduler.Task) bool {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiters) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return true
+	}
+	s.seq++
+	w := &waiter{priority: t.Priority, due: t.DueAt(), seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.waiters, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted while giving up: pass the slot on rather than leak it.
+		s.handOff()
+	default:
+		heap.Remove(&s.waiters, w.index)
+	}
+	return false
+}
+
+// release gives a slot back, to the first waiter if there is one.
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOff()
+}
+
+// handOff passes a slot being freed to the first waiter, or back to the pool.
+// s.mu must be held.
+func (s *slots) handOff() {
+	if len(s.waiters) == 0 {
+		s.free++
+		return
+	}
+	w := heap.Pop(&s.waiters).(*waiter)
+	close(w.ready)
+}
+
+// inUse reports how many slots are held.
+func (s *slots) inUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size - s.free
+}
+
+type waiter struct {
+	priority int
+	due      time.Time
+	seq      uint64
+	ready    chan struct{} // closed when the slot is handed over
+	index    int
+}
+
+// waitHeap orders waiters highest priority first, then earliest due, then
+// first come.
+type waitHeap []*waiter
+
+func (h waitHeap) Len() int { return len(h) }
+func (h waitHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	if !h[i].due.Equal(h[j].due) {
+		return h[i].due.Before(h[j].due)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *waitHeap) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *waitHeap) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return w
+}
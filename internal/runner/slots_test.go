@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ksamirdev/schedy/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotsAdmitHighestPriorityFirst(t *testing.T) {
+	s := newSlots(1)
+	ctx := context.Background()
+	require.True(t, s.acquire(ctx, scheduler.Task{}))
+
+	now := time.Now()
+	admitted := make(chan string, 4)
+	wait := func(id string, priority int, due time.Time) {
+		go func() {
+			if s.acquire(ctx, scheduler.Task{ID: id, Priority: priority, ExecuteAt: due}) {
+				admitted <- id
+			}
+		}()
+		// Let it queue before the next arrives, so arrival order is fixed.
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, w := range s.waiters {
+				if w.due.Equal(due) && w.priority == priority {
+					return true
+				}
+			}
+			return false
+		}, time.Second, time.Millisecond)
+	}
+	wait("digest-old", 0, now.Add(-time.Hour))
+	wait("urgent-new", 9, now)
+	wait("urgent-old", 9, now.Add(-time.Minute))
+	wait("mid", 5, now.Add(-2*time.Hour))
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		s.release()
+		order = append(order, <-admitted)
+	}
+	assert.Equal(t, []string{"urgent-old", "urgent-new", "mid", "digest-old"}, order)
+
+	s.release()
+	assert.Zero(t, s.inUse())
+}
+
+func TestSlotsAcquireCancelled(t *testing.T) {
+	s := newSlots(1)
+	require.True(t, s.acquire(context.Background(), scheduler.Task{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- s.acquire(ctx, scheduler.Task{Priority: 9}) }()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.waiters) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.False(t, <-done)
+
+	// The cancelled waiter holds nothing and isn't handed the next slot.
+	s.release()
+	assert.Zero(t, s.inUse())
+	assert.True(t, s.acquire(context.Background(), scheduler.Task{}))
+}
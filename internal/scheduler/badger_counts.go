@@ -0,0 +1,303 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Per-queue, per-status counters: "meta:count:<queue>:<status>" -> decimal
+// task count.
+//
+// put and drop move them in the same transaction as the row, so a metrics
+// scrape reads a few keys instead of scanning the keyspace. The one thing a
+// transaction can't see is TTL expiry: a purged terminal task leaves its
+// counter one too high until Recount corrects it.
+const countPrefix = "meta:count:"
+
+// statuses is every status a task can be stored under, in lifecycle order.
+var statuses = []TaskStatus{
+	StatusPending, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled,
+}
+
+func countKey(queue string, status TaskStatus) []byte {
+	return []byte(countPrefix + queue + ":" + string(status))
+}
+
+func readCount(txn *badger.Txn, queue string, status TaskStatus) (int, error) {
+	item, err := txn.Get(countKey(queue, status))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = item.Value(func(val []byte) error {
+		n, err = strconv.Atoi(string(val))
+		return err
+	})
+	return n, err
+}
+
+// bumpCount adds delta to queue's counter for status.
+func bumpCount(txn *badger.Txn, queue string, status TaskStatus, delta int) error {
+	n, err := readCount(txn, queue, status)
+	if err != nil {
+		return err
+	}
+	return txn.Set(countKey(queue, status), []byte(strconv.Itoa(n+delta)))
+}
+
+// tallies is a count per queue, per status.
+type tallies map[string]map[TaskStatus]int
+
+func (t tallies) add(queue string, status TaskStatus, n int) {
+	if t[queue] == nil {
+		t[queue] = make(map[TaskStatus]int, len(statuses))
+	}
+	t[queue][status] += n
+}
+
+// readCounts reads every counter.
+func readCounts(txn *badger.Txn) (tallies, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	counts := make(tallies)
+	prefix := []byte(countPrefix)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		queue, status, ok := strings.Cut(strings.TrimPrefix(string(it.Item().Key()), countPrefix), ":")
+		if !ok {
+			continue
+		}
+		var n int
+		err := it.Item().Value(func(val []byte) error {
+			var err error
+			n, err = strconv.Atoi(string(val))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		counts.add(queue, TaskStatus(status), n)
+	}
+	return counts, nil
+}
+
+// Counts reads the counters and counts the pending backlog, in total and per
+// queue.
+//
+// Overdue can't be a counter - tasks become overdue by the clock passing, not
+// by a write - so it is a keys-only seek over the due head of each pending
+// priority band: O(overdue), which is zero on a healthy server.
+func (s *BadgerStore) Counts(now time.Time) (Counts, error) {
+	counts := Counts{
+		ByStatus: make(map[TaskStatus]int, len(statuses)),
+		Queues:   make(map[string]QueueCounts),
+	}
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		byQueue, err := readCounts(txn)
+		if err != nil {
+			return err
+		}
+		for queue, byStatus := range byQueue {
+			qc := QueueCounts{ByStatus: make(map[TaskStatus]int, len(byStatus))}
+			for status, n := range byStatus {
+				if n != 0 {
+					qc.ByStatus[status] = n
+					counts.ByStatus[status] += n
+				}
+			}
+			if len(qc.ByStatus) > 0 {
+				counts.Queues[queue] = qc
+			}
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for _, queue := range queuesIn(txn, StatusPending) {
+			overdue := 0
+			for _, priority := range prioritiesIn(txn, StatusPending, queue) {
+				cutoff := dueBound(queue, priority, now)
+				prefix := []byte(bandPrefix(StatusPending, queue, priority))
+				for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+					// Keys are ordered by due time, so the first one not yet due ends it.
+					if string(it.Item().Key()) > cutoff {
+						break
+					}
+					overdue++
+				}
+			}
+			counts.Overdue += overdue
+			if qc, ok := counts.Queues[queue]; ok {
+				qc.Overdue = overdue
+				counts.Queues[queue] = qc
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Counts{}, err
+	}
+	return counts, nil
+}
+
+// tally counts the stored rows per queue and status with a keys-only scan.
+func tally(txn *badger.Txn) tallies {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	counts := make(tallies)
+	prefix := []byte(keyPrefix)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if k, ok := parseKey(string(it.Item().Key())); ok {
+			counts.add(k.queue, k.status, 1)
+		}
+	}
+	return counts
+}
+
+// Recount recomputes every counter from a full keys-only scan and corrects any
+// that have drifted, returning the correction applied per status, summed over
+// queues (absent when every counter for it was already right).
+//
+// The scan and the counters it is compared against are read from one
+// snapshot, and the correction is applied as a delta rather than an
+// overwrite, so writes committed while the scan runs are neither lost nor
+// counted twice. The scan holds no write lock: the API and runner keep going.
+// Recounts do hold one against each other, though - two that read the same
+// snapshot would both apply its drift, correcting it twice.
+func (s *BadgerStore) Recount() (map[TaskStatus]int, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+
+	drift := make(tallies)
+	err := s.db.View(func(txn *badger.Txn) error {
+		actual := tally(txn)
+		stored, err := readCounts(txn)
+		if err != nil {
+			return err
+		}
+		for _, queue := range unionKeys(actual, stored) {
+			for _, status := range statuses {
+				if d := actual[queue][status] - stored[queue][status]; d != 0 {
+					drift.add(queue, status, d)
+				}
+			}
+		}
+		return nil
+	})
+	byStatus := make(map[TaskStatus]int)
+	if err != nil || len(drift) == 0 {
+		return byStatus, err
+	}
+	err = s.update(func(txn *badger.Txn) error {
+		for queue, d := range drift {
+			for status, n := range d {
+				if err := bumpCount(txn, queue, status, n); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	for _, d := range drift {
+		for status, n := range d {
+			byStatus[status] += n
+		}
+	}
+	for status, n := range byStatus {
+		if n == 0 {
+			delete(byStatus, status)
+		}
+	}
+	return byStatus, err
+}
+
+// unionKeys lists the queues in either tally.
+func unionKeys(a, b tallies) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var queues []string
+	for _, t := range []tallies{a, b} {
+		for queue := range t {
+			if !seen[queue] {
+				seen[queue] = true
+				queues = append(queues, queue)
+			}
+		}
+	}
+	return queues
+}
+
+// RunReconcile calls Recount on a ticker until ctx is cancelled, so counters
+// left high by history TTL expiry come back down. Drift from expiry is
+// expected and logged at debug; there is no other source of it.
+func (s *BadgerStore) RunReconcile(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			drift, err := s.Recount()
+			if err != nil {
+				slog.Error("recount tasks", "error", err)
+				continue
+			}
+			if len(drift) > 0 {
+				slog.Debug("corrected task counters", "drift", drift)
+			}
+		}
+	}
+}
+
+// initCounts seeds the counters from a tally, replacing any already there.
+// It runs as a migration, for data directories written before the counters
+// (or their current layout) existed: nothing else has the store open then, so
+// the tally is exact.
+func initCounts(db *badger.DB) error {
+	var actual tallies
+	var stale [][]byte
+	if err := db.View(func(txn *badger.Txn) error {
+		actual = tally(txn)
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(countPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			stale = append(stale, it.Item().KeyCopy(nil))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		for _, key := range stale {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		for queue, byStatus := range actual {
+			for _, status := range statuses {
+				if err := txn.Set(countKey(queue, status), []byte(strconv.Itoa(byStatus[status]))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
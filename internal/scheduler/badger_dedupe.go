@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Deduplication indexes, maintained by put/drop alongside the row itself so a
+// create's duplicate check is a point lookup instead of a partition scan.
+//
+//	"idx:idem:<idempotency-key>"                  -> task id
+//	"idx:sched:<url-hash>:<zero-padded-ns>:<id>"  -> (empty)
+//
+// The schedule entry is at the task's requested time, before any jitter, as
+// that is what a repeat of its create asks for.
+// Both are live while the task is unfinished. When it finishes the schedule
+// entry goes, and the idempotency record either goes too or, with
+// WithIdempotencyRetention, stays for the retention window. The URL is hashed so
+// its length and bytes can't leak into the key layout.
+const (
+	idemIndexPrefix  = "idx:idem:"
+	schedIndexPrefix = "idx:sched:"
+)
+
+func idemIndexKey(key string) []byte {
+	return []byte(idemIndexPrefix + key)
+}
+
+func schedURLPrefix(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return schedIndexPrefix + hex.EncodeToString(sum[:16]) + ":"
+}
+
+func schedIndexKey(t Task) []byte {
+	return []byte(fmt.Sprintf("%s%019d:%s", schedURLPrefix(t.URL), t.ScheduledAt().UnixNano(), t.ID))
+}
+
+// idemOwner returns the id of the task currently holding an idempotency key,
+// or "" if the key is free.
+func idemOwner(txn *badger.Txn, key string) (string, error) {
+	item, err := txn.Get(idemIndexKey(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	id, err := item.ValueCopy(nil)
+	return string(id), err
+}
+
+// putDedupe writes t's deduplication entries for its current state.
+//
+// An idempotency key is only ever claimed, never stolen: a task replayed after
+// its key was released and re-used by a newer task must not take it back. A
+// record naming a task that has since been purged counts as free.
+func (s *BadgerStore) putDedupe(txn *badger.Txn, t Task) error {
+	if !t.Status.IsTerminal() {
+		if err := txn.Set(schedIndexKey(t), nil); err != nil {
+			return err
+		}
+	}
+	if t.IdempotencyKey == "" {
+		return nil
+	}
+
+	owner, err := idemOwner(txn, t.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != t.ID {
+		held, err := findKey(txn, owner)
+		if err != nil || held != nil {
+			return err
+		}
+	}
+
+	key := idemIndexKey(t.IdempotencyKey)
+	switch {
+	case !t.Status.IsTerminal():
+		return txn.Set(key, []byte(t.ID))
+	case s.idemTTL > 0:
+		return txn.SetEntry(badger.NewEntry(key, []byte(t.ID)).WithTTL(s.idemTTL))
+	default:
+		return txn.Delete(key)
+	}
+}
+
+// dropDedupe removes the deduplication entries t owns.
+func dropDedupe(txn *badger.Txn, t Task) error {
+	if err := txn.Delete(schedIndexKey(t)); err != nil {
+		return err
+	}
+	if t.IdempotencyKey == "" {
+		return nil
+	}
+	owner, err := idemOwner(txn, t.IdempotencyKey)
+	if err != nil || owner != t.ID {
+		return err
+	}
+	return txn.Delete(idemIndexKey(t.IdempotencyKey))
+}
+
+// FindDuplicate returns the task a create would duplicate, or nil.
+//
+// With an idempotency key it is whichever task holds the key. Without one it is
+// an unfinished task for the same url at exactly executeAt: a seek to that
+// instant in the url's schedule entries, not a scan. Exact, because a second
+// of slop would collapse two deliberately distinct sub-second schedules.
+func (s *BadgerStore) FindDuplicate(idempotencyKey, url string, executeAt time.Time) (*Task, error) {
+	var task *Task
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		if idempotencyKey != "" {
+			owner, err := idemOwner(txn, idempotencyKey)
+			if err != nil || owner == "" {
+				return err
+			}
+			task, _, err = load(txn, owner)
+			return err
+		}
+
+		prefix := []byte(fmt.Sprintf("%s%019d:", schedURLPrefix(url), executeAt.UnixNano()))
+
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			t, _, err := load(txn, string(it.Item().Key()[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			// Guards a hash collision; the index is advisory, the row decides.
+			if t != nil && t.URL == url && !t.Status.IsTerminal() {
+				task = t
+				return nil
+			}
+		}
+		return nil
+	})
+
+	return task, err
+}
+
+// backfillDedupeIndexes writes the deduplication entries for unfinished tasks
+// stored before the indexes existed. Finished tasks are left alone: before
+// retention was an option, a finished task never held its key.
+func backfillDedupeIndexes(db *badger.DB) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		for _, status := range []TaskStatus{StatusPending, StatusRunning} {
+			err := scanPartition(txn, status, func(t Task) error {
+				if err := wb.Set(schedIndexKey(t), nil); err != nil {
+					return err
+				}
+				if t.IdempotencyKey == "" {
+					return nil
+				}
+				return wb.Set(idemIndexKey(t.IdempotencyKey), []byte(t.ID))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// scanPartition decodes every task in one status partition, skipping rows that
+// no longer parse.
+func scanPartition(txn *badger.Txn, status TaskStatus, fn func(Task) error) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := []byte(statusPrefix(status))
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var t Task
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &t)
+		}); err != nil {
+			continue
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
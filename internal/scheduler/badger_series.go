@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Series index, maintained by put/drop alongside the row itself:
+//
+//	"idx:series:<series-id>:<zero-padded-run>:<id>" -> (empty)
+//
+// It carries the row's TTL, so a run purged from history drops out of its
+// series with it. Runs sort by number, so listing a series is one prefix scan,
+// in order, however many other tasks the store holds.
+//
+// A series cancelled as a whole also leaves "meta:series-cancelled:<id>",
+// which Save checks. Between a run finishing and its successor being saved
+// there is no unfinished run for a cancel to catch; the marker is what keeps
+// that successor from being saved a moment later.
+const (
+	seriesIndexPrefix     = "idx:series:"
+	seriesCancelledPrefix = "meta:series-cancelled:"
+)
+
+func seriesPrefix(seriesID string) string {
+	return seriesIndexPrefix + seriesID + ":"
+}
+
+func seriesIndexKey(t Task) []byte {
+	return []byte(fmt.Sprintf("%s%010d:%s", seriesPrefix(t.SeriesID), t.RunNumber, t.ID))
+}
+
+// validSeriesID keeps a series id from reaching into another series' keys.
+func validSeriesID(id string) bool {
+	return id != "" && !strings.Contains(id, ":")
+}
+
+func seriesCancelled(txn *badger.Txn, seriesID string) (bool, error) {
+	_, err := txn.Get([]byte(seriesCancelledPrefix + seriesID))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// seriesRuns returns the ids indexed under prefix from start, in run order, up
+// to limit (0 = all) along with the index key of each.
+func seriesRuns(txn *badger.Txn, prefix, start []byte, limit int) (ids []string, keys [][]byte) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+		key := it.Item().KeyCopy(nil)
+		if bytes.Equal(key, start) {
+			continue // the cursor names the last run already returned
+		}
+		ids = append(ids, string(key[bytes.LastIndexByte(key, ':')+1:]))
+		keys = append(keys, key)
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+	}
+	return ids, keys
+}
+
+// ListSeries returns one page of a series' runs in run order. The cursor is
+// the index key of the previous page's last run.
+func (s *BadgerStore) ListSeries(seriesID, cursor string, limit int) ([]Task, string, error) {
+	if !validSeriesID(seriesID) {
+		return nil, "", nil
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	prefix := []byte(seriesPrefix(seriesID))
+	start := prefix
+	if cursor != "" {
+		k, err := decodeCursor(cursor)
+		if err != nil || !bytes.HasPrefix(k, prefix) {
+			return nil, "", ErrInvalidCursor
+		}
+		start = k
+	}
+
+	var (
+		tasks []Task
+		next  string
+	)
+	err := s.db.View(func(txn *badger.Txn) error {
+		// One past the page, to know whether there is another.
+		ids, keys := seriesRuns(txn, prefix, start, limit+1)
+		for i, id := range ids {
+			if len(tasks) == limit {
+				next = encodeCursor(keys[i-1])
+				break
+			}
+			t, _, err := load(txn, id)
+			if err != nil {
+				return err
+			}
+			if t != nil {
+				tasks = append(tasks, *t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return tasks, next, nil
+}
+
+// CancelSeries cancels every unfinished run of a series, running ones included
+// - a cancel wins the runner's finalize, so a run cancelled mid-delivery
+// doesn't enqueue a successor either - and marks the series cancelled.
+func (s *BadgerStore) CancelSeries(seriesID string, at time.Time) (int, error) {
+	if !validSeriesID(seriesID) {
+		return 0, ErrNotFound
+	}
+	var cancelled int
+	err := s.update(func(txn *badger.Txn) error {
+		cancelled = 0 // reset on a conflict re-run
+		prefix := []byte(seriesPrefix(seriesID))
+		ids, _ := seriesRuns(txn, prefix, prefix, 0)
+		if len(ids) == 0 {
+			return ErrNotFound
+		}
+		for _, id := range ids {
+			t, key, err := load(txn, id)
+			if err != nil {
+				return err
+			}
+			if t == nil || t.Status.IsTerminal() {
+				continue
+			}
+			if err := drop(txn, key, *t); err != nil {
+				return err
+			}
+			t.Status = StatusCancelled
+			t.FinishedAt = &at
+			if err := s.put(txn, *t); err != nil {
+				return err
+			}
+			cancelled++
+		}
+		// The marker only has to outlive a successor being saved, but a
+		// history-long life lets a late one be refused too.
+		e := badger.NewEntry([]byte(seriesCancelledPrefix+seriesID), nil)
+		if s.ttl > 0 {
+			e.ExpiresAt = uint64(time.Now().Add(s.ttl).Unix())
+		}
+		return txn.SetEntry(e)
+	})
+	return cancelled, err
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Signing keys: "meta:signing-key:<id>" -> JSON SigningKey.
+//
+// ponytail: secrets are stored as written, unencrypted, so the data directory
+// and its backups are as sensitive as the keys themselves.
+const signingKeyPrefix = "meta:signing-key:"
+
+// The Ed25519 key: "meta:ed25519-key" -> JSON Ed25519Key. Unencrypted, like
+// the signing keys.
+const ed25519KeyKey = "meta:ed25519-key"
+
+func getSigningKey(txn *badger.Txn, id string) (*SigningKey, error) {
+	item, err := txn.Get([]byte(signingKeyPrefix + id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := new(SigningKey)
+	return k, item.Value(func(val []byte) error { return json.Unmarshal(val, k) })
+}
+
+func putSigningKey(txn *badger.Txn, k SigningKey) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return txn.Set([]byte(signingKeyPrefix+k.ID), data)
+}
+
+// CreateSigningKey stores a new key, or fails with ErrSigningKeyExists.
+func (s *BadgerStore) CreateSigningKey(k SigningKey) error {
+	return s.update(func(txn *badger.Txn) error {
+		cur, err := getSigningKey(txn, k.ID)
+		if err != nil {
+			return err
+		}
+		if cur != nil {
+			return ErrSigningKeyExists
+		}
+		return putSigningKey(txn, k)
+	})
+}
+
+// RotateSigningKey gives key id a new secret as of at, the old one signing
+// alongside it for overlap, and returns the key as written.
+func (s *BadgerStore) RotateSigningKey(id, secret string, at time.Time, overlap time.Duration) (*SigningKey, error) {
+	var k *SigningKey
+	err := s.update(func(txn *badger.Txn) error {
+		var err error
+		if k, err = getSigningKey(txn, id); err != nil {
+			return err
+		}
+		if k == nil {
+			return ErrSigningKeyNotFound
+		}
+		k.Rotate(secret, at, overlap)
+		return putSigningKey(txn, *k)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// SigningKey returns key id, or nil if there is none.
+func (s *BadgerStore) SigningKey(id string) (*SigningKey, error) {
+	var k *SigningKey
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		k, err = getSigningKey(txn, id)
+		return err
+	})
+	return k, err
+}
+
+// ListSigningKeys returns every key, sorted by id.
+func (s *BadgerStore) ListSigningKeys() ([]SigningKey, error) {
+	var keys []SigningKey
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(signingKeyPrefix)
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var k SigningKey
+			if err := it.Item().Value(func(val []byte) error { return json.Unmarshal(val, &k) }); err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// DeleteSigningKey removes key id, or fails with ErrSigningKeyNotFound.
+func (s *BadgerStore) DeleteSigningKey(id string) error {
+	return s.update(func(txn *badger.Txn) error {
+		k, err := getSigningKey(txn, id)
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			return ErrSigningKeyNotFound
+		}
+		return txn.Delete([]byte(signingKeyPrefix + id))
+	})
+}
+
+// Ed25519Key returns the stored Ed25519 key, generating and storing one the
+// first time.
+func (s *BadgerStore) Ed25519Key() (*Ed25519Key, error) {
+	var k *Ed25519Key
+	err := s.update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(ed25519KeyKey))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			if k, err = NewEd25519Key(); err != nil {
+				return err
+			}
+			data, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			return txn.Set([]byte(ed25519KeyKey), data)
+		}
+		if err != nil {
+			return err
+		}
+		k = new(Ed25519Key)
+		return item.Value(func(val []byte) error { return json.Unmarshal(val, k) })
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
@@ -5,45 +5,150 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
 )
 
-// Key layout: "task:<status>:<zero-padded-unix-ts>:<id>"
+// Key layout: "task:<status>:<queue>:<band>:<zero-padded-unix-ns>:<id>"
 //
 // Partitioning by status keeps the hot path (find pending due tasks) scanning
-// only live work, and lets terminal tasks carry an independent TTL. The
-// zero-padded timestamp preserves chronological ordering within a status.
+// only live work, and lets terminal tasks carry an independent TTL. Within a
+// status, each queue has a partition of its own, so a paused queue's backlog
+// can be stepped over with one seek rather than read past. Within a queue,
+// each priority has a band of its own (see priorityBand), so the most urgent
+// due work is found without reading past a backlog of less urgent work. The
+// zero-padded timestamp is the task's DueAt - its ExecuteAt, or its next retry
+// while one is waiting - and preserves chronological ordering within a band,
+// down to the nanosecond: two tasks in the same second still sort by when they
+// are due, not by id.
 const keyPrefix = "task:"
 
 func taskKey(t Task) string {
-	return fmt.Sprintf("task:%s:%016d:%s", t.Status, t.ExecuteAt.Unix(), t.ID)
+	return fmt.Sprintf("%s%019d:%s", bandPrefix(t.Status, t.QueueName(), t.Priority), keyNanos(t.DueAt()), t.ID)
+}
+
+// priorityBand is the one-digit key field for priority p: MaxPriority-p, so
+// the highest priority sorts first. Out-of-range values are clamped.
+func priorityBand(p int) int {
+	return MaxPriority - min(max(p, MinPriority), MaxPriority)
+}
+
+// keyNanos is t in unix nanoseconds, clamped to what the 19-digit key field
+// holds. UnixNano is undefined outside 1678-2262; no real schedule gets near
+// either end, but a zero time must still sort first rather than wrap.
+func keyNanos(t time.Time) int64 {
+	switch {
+	case t.Before(time.Unix(0, 0)):
+		return 0
+	case t.After(time.Unix(0, math.MaxInt64)):
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// dueBound is the key every pending task in queue due at or before t sorts
+// before, and every later one after. The trailing ';' sorts just above the
+// ':' that follows the timestamp, so a task due at exactly t is inside the
+// bound.
+func dueBound(queue string, priority int, t time.Time) string {
+	return fmt.Sprintf("%s%019d;", bandPrefix(StatusPending, queue, priority), keyNanos(t))
 }
 
 func statusPrefix(status TaskStatus) string {
 	return fmt.Sprintf("task:%s:", status)
 }
 
+func queuePrefix(status TaskStatus, queue string) string {
+	return fmt.Sprintf("task:%s:%s:", status, queue)
+}
+
+func bandPrefix(status TaskStatus, queue string, priority int) string {
+	return fmt.Sprintf("task:%s:%s:%d:", status, queue, priorityBand(priority))
+}
+
+// Paused queues: "meta:paused:<queue>" -> (empty), present while paused.
+const pausedPrefix = "meta:paused:"
+
+// Maintenance: "meta:maintenance" -> JSON Maintenance, present while every
+// delivery is paused.
+const maintenanceKey = "meta:maintenance"
+
+// Secondary index: "idx:id:<id>" -> the task's current primary key.
+//
+// A task's primary key moves whenever its status or due time changes, so a
+// by-id lookup would otherwise have to scan every partition for the ":<id>"
+// suffix. The index entry is written in the same transaction as the row it
+// points at, and carries the same TTL, so a purged task leaves nothing behind.
+const idIndexPrefix = "idx:id:"
+
+func idIndexKey(id string) []byte {
+	return []byte(idIndexPrefix + id)
+}
+
 type BadgerStore struct {
 	db  *badger.DB
-	ttl time.Duration // retention for terminal tasks
+	ttl time.Duration // retention for succeeded and cancelled tasks
+	// dlqTTL is how long a failed task - a dead letter - is retained; zero
+	// keeps it until it is redriven or deleted.
+	dlqTTL time.Duration
+	// idemTTL is how long a finished task keeps its Idempotency-Key record;
+	// zero releases the key as soon as the task finishes.
+	idemTTL time.Duration
+	wmu     sync.Mutex // serialises update; see there
+	rmu     sync.Mutex // serialises Recount; see there
+
+	// onPending is the OnPending listener. written collects the pending
+	// tasks put by the transaction in progress, for it to hear about once
+	// the commit lands; both are guarded by wmu.
+	onPending func(Task)
+	written   []Task
 }
 
-// NewBadgerStore opens the store. historyTTL bounds how long terminal
-// (succeeded/failed/cancelled) tasks are retained for history.
-func NewBadgerStore(path string, historyTTL time.Duration) (*BadgerStore, error) {
-	opts := badger.DefaultOptions(path).WithLogger(nil)
-	db, err := badger.Open(opts)
+// Option configures optional BadgerStore behaviour.
+type Option func(*BadgerStore)
+
+// WithIdempotencyRetention keeps a finished task's Idempotency-Key claimed for
+// d after it finishes, so a create retried after delivery returns the original
+// task instead of scheduling the work again. The record can't outlive the task
+// it names: once history TTL purges the task, the key is free again.
+func WithIdempotencyRetention(d time.Duration) Option {
+	return func(s *BadgerStore) { s.idemTTL = d }
+}
+
+// WithDeadLetterRetention purges failed tasks d after they fail. Without it they
+// are kept until redriven or deleted: a dead letter is work still owed, not
+// history, so the history TTL doesn't apply to it.
+func WithDeadLetterRetention(d time.Duration) Option {
+	return func(s *BadgerStore) { s.dlqTTL = d }
+}
+
+// NewBadgerStore opens the store. historyTTL bounds how long succeeded and
+// cancelled tasks are retained for history; failed tasks have their own
+// retention (WithDeadLetterRetention).
+func NewBadgerStore(path string, historyTTL time.Duration, opts ...Option) (*BadgerStore, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
 	if err != nil {
 		return nil, err
 	}
-	return &BadgerStore{db: db, ttl: historyTTL}, nil
+	s := &BadgerStore{db: db, ttl: historyTTL}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := migrate(s); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate store: %w", err)
+	}
+	return s, nil
 }
 
 // Close flushes and releases the underlying BadgerDB. Call once on shutdown so
@@ -116,34 +221,161 @@ func (s *BadgerStore) put(txn *badger.Txn, task Task) error {
 	if err != nil {
 		return err
 	}
-	e := badger.NewEntry([]byte(taskKey(task)), data)
-	if task.Status.IsTerminal() && s.ttl > 0 {
-		e = e.WithTTL(s.ttl)
+	key := []byte(taskKey(task))
+	var expiresAt uint64
+	switch {
+	case task.Status == StatusFailed:
+		if s.dlqTTL > 0 {
+			expiresAt = uint64(time.Now().Add(s.dlqTTL).Unix())
+		}
+	case task.Status.IsTerminal() && s.ttl > 0:
+		expiresAt = uint64(time.Now().Add(s.ttl).Unix())
+	}
+	// The row and its index entries expire together, so an index never
+	// outlives the task it points at.
+	entries := []*badger.Entry{
+		badger.NewEntry(key, data),
+		badger.NewEntry(idIndexKey(task.ID), key),
+	}
+	if task.SeriesID != "" {
+		entries = append(entries, badger.NewEntry(seriesIndexKey(task), nil))
+	}
+	for _, e := range entries {
+		e.ExpiresAt = expiresAt
+		if err := txn.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	if err := bumpCount(txn, task.QueueName(), task.Status, 1); err != nil {
+		return err
+	}
+	if task.Status == StatusPending {
+		s.written = append(s.written, task)
 	}
-	return txn.SetEntry(e)
+	return s.putDedupe(txn, task)
+}
+
+// drop removes the row stored at key along with every index entry it owns, and
+// takes it off its status counter.
+func drop(txn *badger.Txn, key []byte, task Task) error {
+	if err := txn.Delete(key); err != nil {
+		return err
+	}
+	if err := txn.Delete(idIndexKey(task.ID)); err != nil {
+		return err
+	}
+	if task.SeriesID != "" {
+		if err := txn.Delete(seriesIndexKey(task)); err != nil {
+			return err
+		}
+	}
+	if err := bumpCount(txn, task.QueueName(), task.Status, -1); err != nil {
+		return err
+	}
+	return dropDedupe(txn, task)
 }
 
 // findKey returns the current storage key for a task id, or nil if absent.
-// ponytail: O(n) scan across all partitions; add an id->key index if task
-// volume makes per-write lookups (Update/Delete) hot.
-func findKey(txn *badger.Txn, id string) []byte {
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
-	defer it.Close()
-	prefix := []byte(keyPrefix)
-	suffix := ":" + id
-	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		k := it.Item().KeyCopy(nil)
-		if strings.HasSuffix(string(k), suffix) {
-			return k
+func findKey(txn *badger.Txn, id string) ([]byte, error) {
+	item, err := txn.Get(idIndexKey(id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// load returns the stored task for id and the key it lives under, or a nil
+// task if there is none.
+func load(txn *badger.Txn, id string) (*Task, []byte, error) {
+	key, err := findKey(txn, id)
+	if err != nil || key == nil {
+		return nil, nil, err
+	}
+	item, err := txn.Get(key)
+	// The row expired a moment before its index entry: already gone.
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var t Task
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &t)
+	}); err != nil {
+		return nil, nil, err
+	}
+	return &t, key, nil
+}
+
+// maxConflictRetries bounds how often update re-runs a transaction that lost a
+// race to a concurrent commit. Contention is a handful of goroutines touching
+// the same task, so a few rounds always settle it; the bound only keeps a bug
+// from spinning forever.
+const maxConflictRetries = 10
+
+// update runs fn in a read-write transaction, re-running it from a fresh
+// snapshot when Badger rejects the commit because a concurrent transaction
+// wrote something fn read. Every read-modify-write goes through here, which is
+// what makes Transition's status check and write a single atomic step.
+//
+// Writers are also serialised on wmu. Every write moves a status counter, so
+// concurrent writers would otherwise all conflict on the same few keys and
+// burn retries under load; queueing them costs nothing Badger's single commit
+// pipeline wasn't already costing.
+func (s *BadgerStore) update(fn func(txn *badger.Txn) error) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	for i := 0; ; i++ {
+		s.written = s.written[:0]
+		err := s.db.Update(fn)
+		if err == nil {
+			s.notifyPending()
+		}
+		if !errors.Is(err, badger.ErrConflict) || i == maxConflictRetries {
+			return err
 		}
 	}
-	return nil
 }
 
-// Save creates a new task in the pending keyspace.
+// OnPending registers fn to hear about every task a committed write leaves
+// pending - created, rescheduled, re-armed or waiting to retry - so the runner
+// can wake for it instead of polling. There is one listener; a later call
+// replaces it. fn runs on the writer's goroutine after the commit, while
+// writes are still serialised, so it must be quick and must not call back
+// into the store.
+func (s *BadgerStore) OnPending(fn func(Task)) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.onPending = fn
+}
+
+func (s *BadgerStore) notifyPending() {
+	if s.onPending == nil {
+		return
+	}
+	for _, t := range s.written {
+		s.onPending(t)
+	}
+}
+
+// Save creates a new task in the pending keyspace, unless it is a run of a
+// cancelled series.
 func (s *BadgerStore) Save(task Task) error {
 	task.Status = StatusPending
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
+		if task.SeriesID != "" {
+			cancelled, err := seriesCancelled(txn, task.SeriesID)
+			if err != nil {
+				return err
+			}
+			if cancelled {
+				return ErrSeriesCancelled
+			}
+		}
 		return s.put(txn, task)
 	})
 }
@@ -151,9 +383,13 @@ func (s *BadgerStore) Save(task Task) error {
 // Update relocates a task to match its current status. The old key (which may
 // live in a different status partition) is removed and the task re-written.
 func (s *BadgerStore) Update(task Task) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		if old := findKey(txn, task.ID); old != nil {
-			if err := txn.Delete(old); err != nil {
+	return s.update(func(txn *badger.Txn) error {
+		old, key, err := load(txn, task.ID)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			if err := drop(txn, key, *old); err != nil {
 				return err
 			}
 		}
@@ -163,24 +399,70 @@ func (s *BadgerStore) Update(task Task) error {
 
 // Delete hard-removes a task by id regardless of status.
 func (s *BadgerStore) Delete(id string) error {
-	return s.db.Update(func(txn *badger.Txn) error {
-		if k := findKey(txn, id); k != nil {
-			return txn.Delete(k)
+	return s.update(func(txn *badger.Txn) error {
+		old, key, err := load(txn, id)
+		if err != nil || old == nil {
+			return err
+		}
+		return drop(txn, key, *old)
+	})
+}
+
+// Transition moves a task between statuses as one read-check-write
+// transaction. Badger's conflict detection covers the window between the read
+// and the commit: if another transaction rewrites the task in between, this
+// one is re-run against the new state and sees the changed status.
+func (s *BadgerStore) Transition(id string, from, to TaskStatus, mutate func(*Task) error) (*Task, error) {
+	var result Task
+	err := s.update(func(txn *badger.Txn) error {
+		cur, key, err := load(txn, id)
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			return ErrNotFound
+		}
+		if cur.Status != from {
+			return ErrConflict
+		}
+		next := *cur
+		if mutate != nil {
+			if err := mutate(&next); err != nil {
+				return err
+			}
 		}
+		next.ID = id
+		next.Status = to
+		if err := drop(txn, key, *cur); err != nil {
+			return err
+		}
+		if err := s.put(txn, next); err != nil {
+			return err
+		}
+		result = next
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
-// GetDueTasks returns at most limit pending tasks due at or before end.
+// GetDueTasks returns at most limit pending tasks due at or before end, leaving
+// out paused queues, highest priority first and oldest first within a
+// priority.
 //
-// The scan starts at the beginning of the pending partition, not at `start`, so
-// tasks that came due while the server was down - and tasks re-queued by
-// RecoverRunning, whose ExecuteAt is always in the past - are caught up rather
+// The scan starts at the beginning of each band's partition, not at `start`,
+// so tasks that came due while the server was down - and tasks re-queued by
+// RecoverRunning, whose due time is always in the past - are caught up rather
 // than skipped. `start` is retained for interface symmetry.
 //
-// The limit bounds the batch, not the catch-up: keys are ordered by ExecuteAt,
-// so a backlog is drained oldest-first over successive calls instead of being
-// read into memory in one go.
+// The limit bounds the batch, not the catch-up: keys are ordered by DueAt
+// within a priority band, so each band gives up at most limit of its oldest,
+// and the merge keeps the limit most urgent overall. A backlog is drained
+// over successive calls instead of being read into memory in one go, an
+// urgent task is in the first batch however much older work is due, and a
+// paused queue's backlog, however large, is never read at all.
 func (s *BadgerStore) GetDueTasks(start, end time.Time, limit int) ([]Task, error) {
 	if limit <= 0 || limit > MaxDueBatch {
 		limit = MaxDueBatch
@@ -188,51 +470,193 @@ func (s *BadgerStore) GetDueTasks(start, end time.Time, limit int) ([]Task, erro
 
 	var tasks []Task
 
-	pfx := statusPrefix(StatusPending)
-	endKey := fmt.Sprintf("%s%016d", pfx, end.Unix())
-
 	err := s.db.View(func(txn *badger.Txn) error {
+		paused := pausedSet(txn)
+
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 
-		for it.Seek([]byte(pfx)); it.ValidForPrefix([]byte(pfx)); it.Next() {
-			key := it.Item().Key()
-
-			// exit once past the due window (keys are zero-padded, ordered)
-			if string(key) > endKey {
-				break
-			}
-			if len(tasks) == limit {
-				break
+		for _, queue := range queuesIn(txn, StatusPending) {
+			if paused[queue] {
+				continue
 			}
-
-			err := it.Item().Value(func(val []byte) error {
-				var t Task
-				if err := json.Unmarshal(val, &t); err == nil {
-					tasks = append(tasks, t)
+			for _, priority := range prioritiesIn(txn, StatusPending, queue) {
+				pfx := []byte(bandPrefix(StatusPending, queue, priority))
+				endKey := dueBound(queue, priority, end)
+				n := 0
+				for it.Seek(pfx); it.ValidForPrefix(pfx) && n < limit; it.Next() {
+					// exit once past the due window (keys are zero-padded, ordered)
+					if string(it.Item().Key()) > endKey {
+						break
+					}
+					err := it.Item().Value(func(val []byte) error {
+						var t Task
+						if err := json.Unmarshal(val, &t); err == nil {
+							tasks = append(tasks, t)
+							n++
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
 				}
-				return nil
-			})
-			if err != nil {
-				return err
 			}
 		}
 		return nil
 	})
-	return tasks, err
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if pi, pj := priorityBand(tasks[i].Priority), priorityBand(tasks[j].Priority); pi != pj {
+			return pi < pj
+		}
+		if !tasks[i].DueAt().Equal(tasks[j].DueAt()) {
+			return tasks[i].DueAt().Before(tasks[j].DueAt())
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+// queuesIn lists the queues holding at least one task in status, in key order.
+// It seeks from each queue's partition straight to the next, so the cost is a
+// seek per queue, not a step per task.
+func queuesIn(txn *badger.Txn, status TaskStatus) []string {
+	var queues []string
+	partitionsIn(txn, statusPrefix(status), func(k taskKeyParts) string {
+		queues = append(queues, k.queue)
+		return queuePrefix(status, k.queue)
+	})
+	return queues
+}
+
+// prioritiesIn lists the priorities holding at least one task in status and
+// queue, highest first, a seek per priority like queuesIn.
+func prioritiesIn(txn *badger.Txn, status TaskStatus, queue string) []int {
+	var priorities []int
+	partitionsIn(txn, queuePrefix(status, queue), func(k taskKeyParts) string {
+		priorities = append(priorities, k.priority)
+		return bandPrefix(status, queue, k.priority)
+	})
+	return priorities
+}
+
+// partitionsIn walks the sub-partitions under prefix: visit gets the first key
+// of each and returns that partition's prefix, which is then skipped whole.
+func partitionsIn(txn *badger.Txn, prefix string, visit func(taskKeyParts) string) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); {
+		k, ok := parseKey(string(it.Item().Key()))
+		if !ok {
+			it.Next()
+			continue
+		}
+		// The prefix ends in ':', and ';' sorts just above it, so this lands
+		// past every key in the partition.
+		next := visit(k)
+		it.Seek([]byte(strings.TrimSuffix(next, ":") + ";"))
+	}
+}
+
+// pausedSet reads which queues are paused.
+func pausedSet(txn *badger.Txn) map[string]bool {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	paused := make(map[string]bool)
+	prefix := []byte(pausedPrefix)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		paused[strings.TrimPrefix(string(it.Item().Key()), pausedPrefix)] = true
+	}
+	return paused
+}
+
+// SetQueuePaused pauses or resumes queue. Resuming writes nothing a runner
+// would hear about through OnPending, so whoever resumes a queue is
+// responsible for waking one.
+func (s *BadgerStore) SetQueuePaused(queue string, paused bool) error {
+	key := []byte(pausedPrefix + queue)
+	return s.update(func(txn *badger.Txn) error {
+		if paused {
+			return txn.Set(key, nil)
+		}
+		return txn.Delete(key)
+	})
+}
+
+// PausedQueues lists every paused queue, sorted by name.
+func (s *BadgerStore) PausedQueues() ([]string, error) {
+	var queues []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		for queue := range pausedSet(txn) {
+			queues = append(queues, queue)
+		}
+		return nil
+	})
+	sort.Strings(queues)
+	return queues, err
+}
+
+// SetMaintenance records m, or clears the pause when m is nil. Clearing it,
+// like resuming a queue, wakes no runner through OnPending.
+func (s *BadgerStore) SetMaintenance(m *Maintenance) error {
+	return s.update(func(txn *badger.Txn) error {
+		if m == nil {
+			return txn.Delete([]byte(maintenanceKey))
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte(maintenanceKey), data)
+	})
+}
+
+// Maintenance returns the recorded pause, or nil when deliveries aren't paused.
+func (s *BadgerStore) Maintenance() (*Maintenance, error) {
+	var m *Maintenance
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(maintenanceKey))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			m = new(Maintenance)
+			return json.Unmarshal(val, m)
+		})
+	})
+	return m, err
 }
 
-// ListTasks returns one page of tasks, optionally filtered by status ("" = all)
-// and exact URL ("" = all). The URL lives in the value, not the key, so a URL
-// filter decodes each candidate row; the page limit counts matches only.
+// ListTasks returns one page of tasks, optionally filtered by status, queue
+// and priority, and the value-level fields of filter (url, execute_at window,
+// last attempt). Those live in the value, not the key, so such a filter decodes
+// each candidate row; the page limit counts matches only. A queue filter with a
+// status narrows the scan to that one partition, and a priority with both to
+// one band; otherwise rows outside them are skipped on the key alone.
 // ponytail: O(partition) when few rows match the URL - add a URL index if
 // filtered listing ever gets hot.
 //
 // Pagination is keyset, not offset: the cursor is the last key of the previous
 // page, so a page is a bounded Seek + scan rather than a full-store read, and
 // inserts or deletions between pages can't shift rows across a page boundary.
-// Keys are already ordered (status partition, then zero-padded ExecuteAt, then
-// id), so no secondary index is needed.
+// Keys are already ordered (status partition, then queue, then priority, then
+// zero-padded due time, then id), so no secondary index is needed.
 //
 // A cursor whose key has since been deleted is still valid: Seek lands on the
 // next key in order and the page continues from there.
@@ -244,10 +668,7 @@ func (s *BadgerStore) ListTasks(filter ListFilter, cursor string, limit int) ([]
 		limit = MaxPageSize
 	}
 
-	prefix := []byte(keyPrefix)
-	if filter.Status != "" {
-		prefix = []byte(statusPrefix(TaskStatus(filter.Status)))
-	}
+	prefix := filter.keyPrefix()
 
 	start := prefix
 	if cursor != "" {
@@ -279,6 +700,9 @@ func (s *BadgerStore) ListTasks(filter ListFilter, cursor string, limit int) ([]
 			if cursor != "" && bytes.Equal(key, start) {
 				continue
 			}
+			if !filter.matchesKey(key) {
+				continue
+			}
 
 			var t Task
 			if err := item.Value(func(val []byte) error {
@@ -286,13 +710,7 @@ func (s *BadgerStore) ListTasks(filter ListFilter, cursor string, limit int) ([]
 			}); err != nil {
 				continue // skip an unreadable record rather than failing the page
 			}
-			if filter.URL != "" && t.URL != filter.URL {
-				continue
-			}
-			if filter.DueBefore != nil && !t.ExecuteAt.Before(*filter.DueBefore) {
-				continue
-			}
-			if filter.DueAfter != nil && !t.ExecuteAt.After(*filter.DueAfter) {
+			if !filter.matches(t) {
 				continue
 			}
 			// One more matching row exists beyond this page, so hand back a cursor.
@@ -322,92 +740,93 @@ func decodeCursor(cursor string) ([]byte, error) {
 	return base64.RawURLEncoding.DecodeString(cursor)
 }
 
-// Counts tallies tasks per status and counts the pending backlog.
-//
-// The scan is keys-only - the status and ExecuteAt it needs are both encoded in
-// the key, so no value is ever decoded, and the whole tally is one pass over the
-// key index.
-//
-// ponytail: still O(total tasks) per call, which at metrics scrape intervals is
-// a repeated full key scan. Maintain incremental counters in the store if that
-// ever costs more than it reports; exactness is why it reads the store instead.
-func (s *BadgerStore) Counts(now time.Time) (Counts, error) {
-	counts := Counts{ByStatus: make(map[TaskStatus]int, 5)}
-	cutoff := now.Unix()
-
-	err := s.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
-		defer it.Close()
+// taskKeyParts is a storage key taken apart.
+type taskKeyParts struct {
+	status   TaskStatus
+	queue    string
+	priority int
+	due      int64
+	id       string
+}
 
-		prefix := []byte(keyPrefix)
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			status, executeAt, ok := parseKey(string(it.Item().Key()))
-			if !ok {
-				continue
-			}
-			counts.ByStatus[status]++
-			if status == StatusPending && executeAt <= cutoff {
-				counts.Overdue++
-			}
+// parseKey takes a storage key apart
+// ("task:<status>:<queue>:<band>:<zero-padded-due>:<id>"). Keys from before
+// priorities ("task:<status>:<queue>:<zero-padded-due>:<id>") and before queues
+// ("task:<status>:<zero-padded-due>:<id>"), which migrations still have to
+// read, are at MinPriority in DefaultQueue. Reports false on a key that isn't
+// one of ours.
+func parseKey(key string) (taskKeyParts, bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) < 4 || parts[0] != "task" {
+		return taskKeyParts{}, false
+	}
+	// Neither ids nor queue names contain a colon, so the field count alone
+	// tells the layouts apart.
+	k := taskKeyParts{status: TaskStatus(parts[1]), queue: DefaultQueue, priority: MinPriority}
+	rest := parts[2:]
+	switch len(parts) {
+	case 5:
+		k.queue, rest = parts[2], parts[3:]
+	case 6:
+		band, err := strconv.Atoi(parts[3])
+		if err != nil || band < 0 || band > MaxPriority-MinPriority {
+			return taskKeyParts{}, false
 		}
-		return nil
-	})
+		k.queue, k.priority, rest = parts[2], MaxPriority-band, parts[4:]
+	}
+	if len(rest) != 2 {
+		return taskKeyParts{}, false
+	}
+	due, err := strconv.ParseInt(rest[0], 10, 64)
 	if err != nil {
-		return Counts{}, err
+		return taskKeyParts{}, false
 	}
-	return counts, nil
+	k.due, k.id = due, rest[1]
+	return k, true
 }
 
-// parseKey pulls the status and unix ExecuteAt back out of a storage key
-// ("task:<status>:<zero-padded-unix-ts>:<id>"). Reports false on a key that
-// isn't one of ours.
-func parseKey(key string) (TaskStatus, int64, bool) {
-	parts := strings.SplitN(key, ":", 4)
-	if len(parts) != 4 || parts[0] != "task" {
-		return "", 0, false
+// keyPrefix is the narrowest key prefix holding every task filter can match:
+// a status partition, narrowed to a queue and then to a priority band as far
+// as the filter names each in order.
+func (f ListFilter) keyPrefix() []byte {
+	switch {
+	case f.Status == "":
+		return []byte(keyPrefix)
+	case f.Queue == "":
+		return []byte(statusPrefix(TaskStatus(f.Status)))
+	case f.Priority == nil:
+		return []byte(queuePrefix(TaskStatus(f.Status), f.Queue))
 	}
-	ts, err := strconv.ParseInt(parts[2], 10, 64)
-	if err != nil {
-		return "", 0, false
+	return []byte(bandPrefix(TaskStatus(f.Status), f.Queue, *f.Priority))
+}
+
+// matchesKey reports whether key passes the filters that live in the key
+// (queue and priority), so rows that can't match are skipped undecoded.
+func (f ListFilter) matchesKey(key []byte) bool {
+	if f.Queue == "" && f.Priority == nil {
+		return true
+	}
+	k, ok := parseKey(string(key))
+	if !ok {
+		return false
 	}
-	return TaskStatus(parts[1]), ts, true
+	return (f.Queue == "" || k.queue == f.Queue) && (f.Priority == nil || k.priority == *f.Priority)
 }
 
 // GetTask retrieves a single task by id. Returns nil if it doesn't exist.
 func (s *BadgerStore) GetTask(id string) (*Task, error) {
 	var task *Task
-
 	err := s.db.View(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		prefix := []byte(keyPrefix)
-		suffix := ":" + id
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			if !strings.HasSuffix(string(item.Key()), suffix) {
-				continue
-			}
-			return item.Value(func(val []byte) error {
-				var t Task
-				if err := json.Unmarshal(val, &t); err != nil {
-					return err
-				}
-				task = &t
-				return nil
-			})
-		}
-		return nil
+		var err error
+		task, _, err = load(txn, id)
+		return err
 	})
-
 	return task, err
 }
 
 // RecoverRunning re-queues tasks stuck in running back to pending.
 func (s *BadgerStore) RecoverRunning() error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.update(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 
 		prefix := []byte(statusPrefix(StatusRunning))
@@ -428,7 +847,7 @@ func (s *BadgerStore) RecoverRunning() error {
 		it.Close()
 
 		for _, t := range stuck {
-			if err := txn.Delete([]byte(taskKey(t))); err != nil {
+			if err := drop(txn, []byte(taskKey(t)), t); err != nil {
 				return err
 			}
 			t.Status = StatusPending
@@ -440,60 +859,61 @@ func (s *BadgerStore) RecoverRunning() error {
 	})
 }
 
-// DeleteTasks hard-deletes tasks across all statuses matching the filters.
-// url: exact match on target URL (optional)
-// before: delete tasks scheduled before this time (optional)
-// after: delete tasks scheduled after this time (optional)
+// deleteBatch bounds how many rows DeleteTasks drops per transaction: a filter
+// can match more rows than one Badger transaction can hold.
+const deleteBatch = 1000
+
+// DeleteTasks hard-deletes tasks across all statuses matching filter. A status
+// or queue narrows the scan the way it does for ListTasks.
 // Returns the number of deleted tasks.
-func (s *BadgerStore) DeleteTasks(url, status string, before, after *time.Time) (int, error) {
+//
+// The rows go in batches of deleteBatch, each its own transaction with its own
+// counter updates, so a failure part-way leaves the earlier batches deleted;
+// the count includes them.
+func (s *BadgerStore) DeleteTasks(filter ListFilter) (int, error) {
 	var deleted int
 
-	err := s.db.Update(func(txn *badger.Txn) error {
-		it := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer it.Close()
-
-		prefix := []byte(keyPrefix)
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			key := item.KeyCopy(nil)
+	prefix := filter.keyPrefix()
+	from := prefix
+	for {
+		var n int
+		var next []byte // where the next batch starts; nil when the scan is done
+		err := s.update(func(txn *badger.Txn) error {
+			n, next = 0, nil // reset on a conflict re-run
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			for it.Seek(from); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				key := item.KeyCopy(nil)
+				if n == deleteBatch {
+					next = key
+					return nil
+				}
+				if !filter.matchesKey(key) {
+					continue
+				}
 
-			shouldDelete := false
-			err := item.Value(func(val []byte) error {
 				var t Task
-				if err := json.Unmarshal(val, &t); err != nil {
+				if err := item.Value(func(val []byte) error {
+					return json.Unmarshal(val, &t)
+				}); err != nil {
 					return err
 				}
-
-				matches := true
-				if url != "" && t.URL != url {
-					matches = false
-				}
-				if status != "" && string(t.Status) != status {
-					matches = false
+				if !filter.matches(t) {
+					continue
 				}
-				if before != nil && !t.ExecuteAt.Before(*before) {
-					matches = false
-				}
-				if after != nil && !t.ExecuteAt.After(*after) {
-					matches = false
-				}
-
-				shouldDelete = matches
-				return nil
-			})
-			if err != nil {
-				return err
-			}
-
-			if shouldDelete {
-				if err := txn.Delete(key); err != nil {
+				if err := drop(txn, key, t); err != nil {
 					return err
 				}
-				deleted++
+				n++
 			}
+			return nil
+		})
+		deleted += n
+		if err != nil || next == nil {
+			return deleted, err
 		}
-		return nil
-	})
-
-	return deleted, err
+		from = next
+	}
 }
@@ -2,12 +2,16 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -241,6 +245,84 @@ func TestKeyOrdering(t *testing.T) {
 	assert.Equal(t, "task3", result[2].ID)
 }
 
+// Keys carry nanoseconds, so tasks due within the same second still come back
+// in order, and a task due exactly at the window's end is included.
+func TestSubSecondOrdering(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	base := time.Now().Truncate(time.Second).Add(time.Minute)
+	require.NoError(t, store.Save(Task{ID: "late", ExecuteAt: base.Add(750 * time.Millisecond)}))
+	require.NoError(t, store.Save(Task{ID: "early", ExecuteAt: base.Add(250 * time.Millisecond)}))
+	require.NoError(t, store.Save(Task{ID: "mid", ExecuteAt: base.Add(500 * time.Millisecond)}))
+
+	due, err := store.GetDueTasks(base, base.Add(500*time.Millisecond), 0)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "early", due[0].ID)
+	assert.Equal(t, "mid", due[1].ID)
+	assert.True(t, due[0].ExecuteAt.Equal(base.Add(250*time.Millisecond)))
+
+	counts, err := store.Counts(base.Add(500 * time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, 2, counts.Overdue)
+}
+
+// A data directory written with second-granular keys is rekeyed on open.
+func TestRekeyNanos(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	base := time.Now().Truncate(time.Second).Add(time.Minute)
+	tasks := []Task{
+		{ID: "b", Status: StatusPending, ExecuteAt: base.Add(750 * time.Millisecond)},
+		{ID: "a", Status: StatusPending, ExecuteAt: base.Add(250 * time.Millisecond)},
+	}
+
+	// Write the rows the way an older build did, then rewind the schema.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		for _, task := range tasks {
+			val, err := json.Marshal(task)
+			if err != nil {
+				return err
+			}
+			key := []byte(fmt.Sprintf("task:%s:%016d:%s", task.Status, task.ExecuteAt.Unix(), task.ID))
+			if err := txn.Set(key, val); err != nil {
+				return err
+			}
+			if err := txn.Set(idIndexKey(task.ID), key); err != nil {
+				return err
+			}
+		}
+		if err := txn.Set([]byte(countPrefix+string(StatusPending)), []byte("2")); err != nil {
+			return err
+		}
+		return txn.Set([]byte(schemaKey), []byte("3"))
+	}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetTask("a")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.True(t, got.ExecuteAt.Equal(base.Add(250*time.Millisecond)))
+
+	due, err := store.GetDueTasks(base, base.Add(time.Second), 0)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "a", due[0].ID)
+	assert.Equal(t, "b", due[1].ID)
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift, "rekeying moves rows without adding or losing any")
+}
+
 func TestEmptyResults(t *testing.T) {
 	store, cleanup := setupBadgerDB(t)
 	defer cleanup()
@@ -279,6 +361,92 @@ func TestGetTask(t *testing.T) {
 	assert.Nil(t, notFound)
 }
 
+// hasIndexEntry reports whether the id->key index holds an entry for id.
+func hasIndexEntry(t *testing.T, store *BadgerStore, id string) bool {
+	t.Helper()
+	var found bool
+	require.NoError(t, store.db.View(func(txn *badger.Txn) error {
+		k, err := findKey(txn, id)
+		found = k != nil
+		return err
+	}))
+	return found
+}
+
+// The id index must follow a task across partitions and vanish with it, or a
+// by-id lookup would resolve to a stale key or a task that no longer exists.
+func TestIDIndex(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, store.Save(Task{ID: "i1", ExecuteAt: now.Add(time.Hour), URL: "http://x/1"}))
+	require.NoError(t, store.Save(Task{ID: "i2", ExecuteAt: now.Add(time.Hour), URL: "http://x/2"}))
+
+	t.Run("follows a task across partitions", func(t *testing.T) {
+		got, err := store.GetTask("i1")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+
+		got.Status = StatusSucceeded
+		got.ExecuteAt = now.Add(2 * time.Hour)
+		require.NoError(t, store.Update(*got))
+
+		got, err = store.GetTask("i1")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, StatusSucceeded, got.Status)
+
+		// The old pending row must be gone, not merely unindexed.
+		pending, _, err := store.ListTasks(ListFilter{Status: string(StatusPending)}, "", 0)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		assert.Equal(t, "i2", pending[0].ID)
+	})
+
+	t.Run("Delete removes the entry", func(t *testing.T) {
+		require.NoError(t, store.Delete("i1"))
+		assert.False(t, hasIndexEntry(t, store, "i1"))
+	})
+
+	t.Run("DeleteTasks removes the entry", func(t *testing.T) {
+		n, err := store.DeleteTasks(ListFilter{URL: "http://x/2"})
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+		assert.False(t, hasIndexEntry(t, store, "i2"))
+	})
+}
+
+// A data directory written before the index existed must have it backfilled
+// when the store opens, so existing tasks stay reachable by id.
+func TestIDIndexBackfill(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(Task{ID: "old1", ExecuteAt: time.Now().Add(time.Hour)}))
+
+	// Strip the index and the schema marker: what an older build left behind.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(idIndexKey("old1")); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(schemaKey))
+	}))
+	require.False(t, hasIndexEntry(t, store, "old1"))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetTask("old1")
+	require.NoError(t, err)
+	require.NotNil(t, got, "a pre-index task must be reachable after the backfill")
+	assert.Equal(t, "old1", got.ID)
+}
+
 func TestDeleteTasks(t *testing.T) {
 	store, cleanup := setupBadgerDB(t)
 	defer cleanup()
@@ -311,7 +479,7 @@ func TestDeleteTasks(t *testing.T) {
 	}
 
 	t.Run("delete by URL", func(t *testing.T) {
-		count, err := store.DeleteTasks("http://example.com/webhook1", "", nil, nil)
+		count, err := store.DeleteTasks(ListFilter{URL: "http://example.com/webhook1"})
 		require.NoError(t, err)
 		assert.Equal(t, 2, count)
 
@@ -345,7 +513,7 @@ func TestDeleteTasksByTimeRange(t *testing.T) {
 
 	t.Run("delete before time", func(t *testing.T) {
 		before := now.Add(12 * time.Second)
-		count, err := store.DeleteTasks("", "", &before, nil)
+		count, err := store.DeleteTasks(ListFilter{DueBefore: &before})
 		require.NoError(t, err)
 		assert.Equal(t, 2, count) // task1 and task2
 
@@ -377,7 +545,7 @@ func TestDeleteTasksAfterTime(t *testing.T) {
 	}
 
 	after := now.Add(12 * time.Second)
-	count, err := store.DeleteTasks("", "", nil, &after)
+	count, err := store.DeleteTasks(ListFilter{DueAfter: &after})
 	require.NoError(t, err)
 	assert.Equal(t, 1, count) // only task3
 
@@ -409,7 +577,7 @@ func TestDeleteTasksCombinedFilters(t *testing.T) {
 	// Delete tasks with specific URL and in time range [8s, 18s]
 	before := now.Add(18 * time.Second)
 	after := now.Add(8 * time.Second)
-	count, err := store.DeleteTasks("http://example.com/webhook", "", &before, &after)
+	count, err := store.DeleteTasks(ListFilter{URL: "http://example.com/webhook", DueBefore: &before, DueAfter: &after})
 	require.NoError(t, err)
 	assert.Equal(t, 2, count) // task2 and task3
 
@@ -435,7 +603,7 @@ func TestDeleteTasksNoMatches(t *testing.T) {
 	require.NoError(t, store.Save(task))
 
 	// Delete with non-matching URL
-	count, err := store.DeleteTasks("http://nonexistent.com/webhook", "", nil, nil)
+	count, err := store.DeleteTasks(ListFilter{URL: "http://nonexistent.com/webhook"})
 	require.NoError(t, err)
 	assert.Equal(t, 0, count)
 
@@ -444,6 +612,45 @@ func TestDeleteTasksNoMatches(t *testing.T) {
 	assert.NotNil(t, retrieved)
 }
 
+// A filter matching more rows than one transaction can hold still deletes them
+// all, with the counters kept in step.
+func TestDeleteTasksBeyondOneTransaction(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	// Seeded straight through put, a thousand rows per transaction: one Save each
+	// would make this the slowest test in the package. Every tenth row is
+	// for another url and must survive.
+	const total = 40_000
+	now := time.Now()
+	for i := 0; i < total; i += 1000 {
+		require.NoError(t, store.update(func(txn *badger.Txn) error {
+			for j := i; j < i+1000; j++ {
+				url := "http://example.com/bulk"
+				if j%10 == 0 {
+					url = "http://example.com/kept"
+				}
+				task := Task{ID: fmt.Sprintf("t%05d", j), URL: url, ExecuteAt: now.Add(time.Duration(j) * time.Millisecond), Status: StatusPending}
+				if err := store.put(txn, task); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+	}
+
+	count, err := store.DeleteTasks(ListFilter{URL: "http://example.com/bulk"})
+	require.NoError(t, err)
+	assert.Equal(t, total*9/10, count)
+
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	assert.Equal(t, total/10, counts.ByStatus[StatusPending])
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+}
+
 // Paging must walk the whole store exactly once - no row returned twice, none
 // skipped - and it must stay correct across the seams: a page boundary that
 // lands exactly on the last row, a cursor whose row was deleted mid-walk, and a
@@ -594,6 +801,199 @@ func TestCountsEmptyStore(t *testing.T) {
 	assert.Zero(t, counts.Overdue)
 }
 
+// The counters must agree with the keyspace after every kind of write, without
+// a recount to help them.
+func TestCountersTrackWrites(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, store.Save(Task{ID: fmt.Sprintf("c%d", i), ExecuteAt: now.Add(time.Hour)}))
+	}
+	_, err := store.Transition("c0", StatusPending, StatusRunning, nil)
+	require.NoError(t, err)
+	_, err = store.Transition("c1", StatusPending, StatusCancelled, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Update(Task{ID: "c2", Status: StatusSucceeded, ExecuteAt: now}))
+	require.NoError(t, store.Delete("c3"))
+	require.NoError(t, store.Delete("missing"), "deleting nothing moves nothing")
+	require.NoError(t, store.RecoverRunning())
+
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	assert.Equal(t, map[TaskStatus]int{
+		StatusPending:   1,
+		StatusCancelled: 1,
+		StatusSucceeded: 1,
+	}, counts.ByStatus)
+
+	deleted, err := store.DeleteTasks(ListFilter{Status: string(StatusCancelled)})
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift, "incremental counters match a full recount")
+}
+
+// A row that disappears without a transaction - history TTL expiry - leaves its
+// counter high until Recount finds and corrects the difference.
+func TestRecountCorrectsDrift(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, store.Save(Task{ID: "gone", ExecuteAt: now.Add(time.Hour)}))
+	require.NoError(t, store.Save(Task{ID: "kept", ExecuteAt: now.Add(time.Hour)}))
+	gone, err := store.GetTask("gone")
+	require.NoError(t, err)
+
+	// Purge the row behind the counters' back, as expiry does.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(taskKey(*gone)))
+	}))
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	require.Equal(t, 2, counts.ByStatus[StatusPending], "the counter can't see expiry")
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Equal(t, map[TaskStatus]int{StatusPending: -1}, drift)
+
+	counts, err = store.Counts(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts.ByStatus[StatusPending])
+
+	drift, err = store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift, "a corrected counter stays corrected")
+}
+
+// Recounts that overlap - the reconcile ticker and POST /admin/recount - apply
+// a drift once between them, not once each.
+func TestConcurrentRecounts(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, store.Save(Task{ID: "kept", ExecuteAt: now.Add(time.Hour)}))
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		return bumpCount(txn, DefaultQueue, StatusPending, 3)
+	}))
+
+	var wg sync.WaitGroup
+	drifts := make([]map[TaskStatus]int, 8)
+	for i := range drifts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drift, err := store.Recount()
+			assert.NoError(t, err)
+			drifts[i] = drift
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, drift := range drifts {
+		total += drift[StatusPending]
+	}
+	assert.Equal(t, -3, total, "the drift is corrected exactly once")
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts.ByStatus[StatusPending])
+}
+
+// A data directory from before the counters existed gets them seeded on open.
+func TestCountersBackfill(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.Save(Task{ID: "old1", ExecuteAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, store.Save(Task{ID: "old2", ExecuteAt: time.Now().Add(time.Hour)}))
+
+	// Strip the counters and rewind the schema to just before them.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		for _, status := range statuses {
+			if err := txn.Delete(countKey(DefaultQueue, status)); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte(schemaKey), []byte("2"))
+	}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+
+	counts, err := store.Counts(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, counts.ByStatus[StatusPending])
+}
+
+// A task waiting to retry is filed under its next attempt, not its original
+// execute_at: it is not due until the retry is, and leaves nothing behind when
+// it finishes.
+func TestRetryKeyedByNextAttempt(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	retryAt := now.Add(time.Hour)
+	task := Task{ID: "retrying", URL: "http://x/r", ExecuteAt: now.Add(-time.Minute), NextAttemptAt: &retryAt, RetryCount: 1}
+	require.NoError(t, store.Save(task))
+
+	due, err := store.GetDueTasks(now, now, 0)
+	require.NoError(t, err)
+	assert.Empty(t, due, "a waiting retry is not due yet")
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	assert.Zero(t, counts.Overdue)
+
+	due, err = store.GetDueTasks(now, retryAt, 0)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, 1, due[0].RetryCount)
+	assert.True(t, due[0].NextAttemptAt.Equal(retryAt))
+
+	task.Status = StatusSucceeded
+	task.NextAttemptAt = nil
+	require.NoError(t, store.Update(task))
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+	got, err := store.GetTask("retrying")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+}
+
+// The OnPending hook hears about every committed write that leaves a task
+// pending, and nothing else: not terminal writes, and not transactions that
+// failed.
+func TestOnPending(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	var heard []string
+	store.OnPending(func(task Task) { heard = append(heard, task.ID+":"+string(task.Status)) })
+
+	now := time.Now()
+	require.NoError(t, store.Save(Task{ID: "p1", ExecuteAt: now.Add(time.Hour)}))
+	_, err := store.Transition("p1", StatusPending, StatusRunning, nil)
+	require.NoError(t, err)
+	_, err = store.Transition("p1", StatusRunning, StatusPending, nil)
+	require.NoError(t, err)
+	_, err = store.Transition("p1", StatusPending, StatusPending, func(*Task) error { return errors.New("refused") })
+	require.Error(t, err)
+	require.NoError(t, store.Update(Task{ID: "p1", Status: StatusSucceeded, ExecuteAt: now}))
+
+	assert.Equal(t, []string{"p1:pending", "p1:pending"}, heard)
+}
+
 // After an outage the pending partition can hold an arbitrary backlog. One call
 // must return a bounded batch, oldest first, so the caller drains rather than
 // loads everything at once.
@@ -758,7 +1158,7 @@ func TestDeleteTasksByStatus(t *testing.T) {
 	failed.Status = StatusFailed
 	require.NoError(t, store.Update(failed))
 
-	count, err := store.DeleteTasks("", "failed", nil, nil)
+	count, err := store.DeleteTasks(ListFilter{Status: "failed"})
 	require.NoError(t, err)
 	assert.Equal(t, 1, count)
 
@@ -767,3 +1167,745 @@ func TestDeleteTasksByStatus(t *testing.T) {
 	got, _ = store.GetTask("p1")
 	assert.NotNil(t, got)
 }
+
+// Duplicate detection is served from the idempotency and schedule indexes, and
+// must agree with what the handler used to compute by paging pending tasks.
+func TestFindDuplicate(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	base := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, store.Save(Task{ID: "k1", IdempotencyKey: "key-1", URL: "http://x/a", ExecuteAt: base}))
+	require.NoError(t, store.Save(Task{ID: "u1", URL: "http://x/b", ExecuteAt: base.Add(900 * time.Millisecond)}))
+
+	t.Run("an idempotency key matches on the key alone", func(t *testing.T) {
+		got, err := store.FindDuplicate("key-1", "http://x/other", base.Add(5*time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "k1", got.ID)
+
+		got, err = store.FindDuplicate("key-2", "http://x/a", base)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("without a key, same url at the same instant matches", func(t *testing.T) {
+		got, err := store.FindDuplicate("", "http://x/b", base.Add(900*time.Millisecond))
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "u1", got.ID)
+
+		got, err = store.FindDuplicate("", "http://x/b", base.Add(901*time.Millisecond))
+		require.NoError(t, err)
+		assert.Nil(t, got, "a millisecond away is a distinct schedule")
+
+		got, err = store.FindDuplicate("", "http://x/c", base.Add(900*time.Millisecond))
+		require.NoError(t, err)
+		assert.Nil(t, got, "a different url never matches")
+	})
+
+	t.Run("a jittered task matches at its requested time", func(t *testing.T) {
+		task := Task{ID: "j1", URL: "http://x/j", Jitter: "10m"}
+		task.ExecuteAt = base.Add(task.JitterOffset())
+		require.NotEqual(t, base, task.ExecuteAt)
+		require.NoError(t, store.Save(task))
+
+		dup, err := store.FindDuplicate("", "http://x/j", base)
+		require.NoError(t, err)
+		require.NotNil(t, dup)
+		assert.Equal(t, "j1", dup.ID)
+	})
+
+	t.Run("a rescheduled task is found at its new time only", func(t *testing.T) {
+		got, err := store.GetTask("u1")
+		require.NoError(t, err)
+		got.ExecuteAt = base.Add(time.Hour)
+		require.NoError(t, store.Update(*got))
+
+		dup, err := store.FindDuplicate("", "http://x/b", base)
+		require.NoError(t, err)
+		assert.Nil(t, dup)
+		dup, err = store.FindDuplicate("", "http://x/b", base.Add(time.Hour))
+		require.NoError(t, err)
+		require.NotNil(t, dup)
+		assert.Equal(t, "u1", dup.ID)
+	})
+
+	t.Run("finishing releases the key by default", func(t *testing.T) {
+		got, err := store.GetTask("k1")
+		require.NoError(t, err)
+		got.Status = StatusSucceeded
+		require.NoError(t, store.Update(*got))
+
+		dup, err := store.FindDuplicate("key-1", "http://x/a", base)
+		require.NoError(t, err)
+		assert.Nil(t, dup)
+		dup, err = store.FindDuplicate("", "http://x/a", base)
+		require.NoError(t, err)
+		assert.Nil(t, dup, "a finished task is history, not a live schedule")
+	})
+}
+
+// With a retention window, a finished task keeps its key, so a create retried
+// after delivery still resolves to the original. Once the task itself is gone
+// the key is free for a new one.
+func TestIdempotencyRetention(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+	store, err := NewBadgerStore(path, time.Hour, WithIdempotencyRetention(time.Hour))
+	require.NoError(t, err)
+	defer store.Close()
+
+	task := Task{ID: "r1", IdempotencyKey: "key-r", URL: "http://x/r", ExecuteAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.Save(task))
+	task.Status = StatusSucceeded
+	require.NoError(t, store.Update(task))
+
+	dup, err := store.FindDuplicate("key-r", "http://x/r", task.ExecuteAt)
+	require.NoError(t, err)
+	require.NotNil(t, dup, "the key outlives the task's completion")
+	assert.Equal(t, "r1", dup.ID)
+	assert.Equal(t, StatusSucceeded, dup.Status)
+
+	// Purging the task frees the key for a new one.
+	require.NoError(t, store.Delete("r1"))
+	require.NoError(t, store.Save(Task{ID: "r2", IdempotencyKey: "key-r", URL: "http://x/r", ExecuteAt: time.Now().Add(time.Hour)}))
+	dup, err = store.FindDuplicate("key-r", "", time.Time{})
+	require.NoError(t, err)
+	require.NotNil(t, dup)
+	assert.Equal(t, "r2", dup.ID)
+}
+
+func TestTransition(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	at := time.Now().Add(time.Hour)
+	require.NoError(t, store.Save(Task{ID: "tr1", URL: "http://x/1", ExecuteAt: at}))
+
+	t.Run("moves the task and applies the mutation", func(t *testing.T) {
+		got, err := store.Transition("tr1", StatusPending, StatusRunning, func(task *Task) error {
+			task.Attempts = append(task.Attempts, Attempt{N: 1})
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, got.Status)
+
+		stored, err := store.GetTask("tr1")
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, stored.Status)
+		assert.Len(t, stored.Attempts, 1)
+	})
+
+	t.Run("a stale from status is a conflict and writes nothing", func(t *testing.T) {
+		_, err := store.Transition("tr1", StatusPending, StatusCancelled, nil)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		stored, err := store.GetTask("tr1")
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, stored.Status)
+	})
+
+	t.Run("a mutate error aborts the transition", func(t *testing.T) {
+		boom := fmt.Errorf("boom")
+		_, err := store.Transition("tr1", StatusRunning, StatusSucceeded, func(*Task) error { return boom })
+		assert.ErrorIs(t, err, boom)
+
+		stored, err := store.GetTask("tr1")
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, stored.Status)
+	})
+
+	t.Run("a missing task is not found", func(t *testing.T) {
+		_, err := store.Transition("nope", StatusPending, StatusRunning, nil)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// The cancel-vs-fire race: many goroutines try to move the same pending task
+// out of pending at once. Exactly one may win; the rest must see a conflict.
+func TestTransitionIsAtomic(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	require.NoError(t, store.Save(Task{ID: "race", ExecuteAt: time.Now().Add(time.Hour)}))
+
+	const n = 16
+	results := make(chan error, n)
+	start := make(chan struct{})
+	for i := range n {
+		to := StatusRunning
+		if i%2 == 0 {
+			to = StatusCancelled
+		}
+		go func() {
+			<-start
+			_, err := store.Transition("race", StatusPending, to, nil)
+			results <- err
+		}()
+	}
+	close(start)
+
+	wins := 0
+	for range n {
+		err := <-results
+		if err == nil {
+			wins++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrConflict)
+	}
+	assert.Equal(t, 1, wins, "exactly one transition out of pending may succeed")
+}
+
+// expiresAt reads the TTL Badger holds for a task's row, 0 for none.
+func expiresAt(t *testing.T, store *BadgerStore, id string) uint64 {
+	t.Helper()
+	var exp uint64
+	require.NoError(t, store.db.View(func(txn *badger.Txn) error {
+		key, err := findKey(txn, id)
+		if err != nil {
+			return err
+		}
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		exp = item.ExpiresAt()
+		return nil
+	}))
+	return exp
+}
+
+// A failed task is a dead letter: it is exempt from the history TTL, kept
+// until redriven unless it is given a retention of its own.
+func TestDeadLetterRetention(t *testing.T) {
+	finish := func(t *testing.T, store *BadgerStore, id string, status TaskStatus) {
+		t.Helper()
+		require.NoError(t, store.Save(Task{ID: id, ExecuteAt: time.Now()}))
+		_, err := store.Transition(id, StatusPending, status, nil)
+		require.NoError(t, err)
+	}
+
+	t.Run("kept by default", func(t *testing.T) {
+		store, cleanup := setupBadgerDB(t)
+		defer cleanup()
+		finish(t, store, "ok", StatusSucceeded)
+		finish(t, store, "dead", StatusFailed)
+
+		assert.NotZero(t, expiresAt(t, store, "ok"), "history TTL applies to succeeded tasks")
+		assert.Zero(t, expiresAt(t, store, "dead"), "a dead letter does not expire")
+	})
+
+	t.Run("own retention", func(t *testing.T) {
+		path := "./testdb_" + uuid.New().String()
+		defer os.RemoveAll(path)
+		store, err := NewBadgerStore(path, time.Hour, WithDeadLetterRetention(30*24*time.Hour))
+		require.NoError(t, err)
+		defer store.Close()
+		finish(t, store, "dead", StatusFailed)
+
+		exp := time.Unix(int64(expiresAt(t, store, "dead")), 0)
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), exp, time.Minute)
+	})
+}
+
+func TestListTasksLastAttemptFilter(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	for id, att := range map[string]*Attempt{
+		"refused":  {N: 1, Error: "dial tcp: connection refused"},
+		"gateway":  {N: 1, StatusCode: 502, Error: "unexpected status code: 502"},
+		"notfound": {N: 1, StatusCode: 404, Error: "unexpected status code: 404"},
+		"fresh":    nil,
+	} {
+		task := Task{ID: id, ExecuteAt: time.Now(), Status: StatusFailed}
+		if att != nil {
+			task.Attempts = []Attempt{{N: 1, StatusCode: 500, Error: "first try"}, *att}
+		}
+		require.NoError(t, store.Update(task))
+	}
+
+	ids := func(filter ListFilter) []string {
+		tasks, _, err := store.ListTasks(filter, "", 0)
+		require.NoError(t, err)
+		var out []string
+		for _, task := range tasks {
+			out = append(out, task.ID)
+		}
+		return out
+	}
+
+	assert.ElementsMatch(t, []string{"gateway", "notfound"}, ids(ListFilter{Error: "unexpected status"}))
+	assert.ElementsMatch(t, []string{"gateway"}, ids(ListFilter{StatusCode: 502}))
+	assert.Empty(t, ids(ListFilter{StatusCode: 500}), "only the last attempt counts")
+	assert.ElementsMatch(t, []string{"notfound"}, ids(ListFilter{Error: "404", StatusCode: 404}))
+	assert.Len(t, ids(ListFilter{}), 4)
+}
+
+// Each queue is its own partition: a paused queue's backlog is left out of the
+// due scan entirely, so it can't crowd the batch for the queues still running.
+func TestQueuePartitions(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Save(Task{ID: fmt.Sprintf("bulk%d", i), Queue: "bulk", ExecuteAt: now.Add(time.Duration(i-10) * time.Minute)}))
+	}
+	require.NoError(t, store.Save(Task{ID: "billing", Queue: "billing", ExecuteAt: now.Add(-time.Minute)}))
+	require.NoError(t, store.Save(Task{ID: "plain", ExecuteAt: now.Add(-2 * time.Minute)}))
+
+	due, err := store.GetDueTasks(now, now, 3)
+	require.NoError(t, err)
+	require.Len(t, due, 3)
+	assert.Equal(t, []string{"bulk0", "bulk1", "bulk2"}, []string{due[0].ID, due[1].ID, due[2].ID},
+		"queues are merged oldest first")
+
+	require.NoError(t, store.SetQueuePaused("bulk", true))
+	due, err = store.GetDueTasks(now, now, 3)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "plain", due[0].ID)
+	assert.Equal(t, DefaultQueue, due[0].QueueName())
+	assert.Equal(t, "billing", due[1].ID)
+
+	paused, err := store.PausedQueues()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bulk"}, paused)
+
+	require.NoError(t, store.SetQueuePaused("bulk", false))
+	due, err = store.GetDueTasks(now, now, 0)
+	require.NoError(t, err)
+	assert.Len(t, due, 7)
+	paused, err = store.PausedQueues()
+	require.NoError(t, err)
+	assert.Empty(t, paused)
+}
+
+// A maintenance pause is stored, so a restart in the middle of one doesn't
+// quietly resume deliveries.
+func TestMaintenanceSurvivesReopen(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	m, err := store.Maintenance()
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	since := time.Now().UTC().Truncate(time.Second)
+	until := since.Add(time.Hour)
+	require.NoError(t, store.SetMaintenance(&Maintenance{Since: since, Until: &until}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+	m, err = store.Maintenance()
+	require.NoError(t, err)
+	require.NotNil(t, m)
+	assert.True(t, since.Equal(m.Since))
+	require.NotNil(t, m.Until)
+	assert.True(t, until.Equal(*m.Until))
+	assert.False(t, m.Over(since))
+	assert.True(t, m.Over(until))
+
+	require.NoError(t, store.SetMaintenance(nil))
+	m, err = store.Maintenance()
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestListAndDeleteTasksByQueue(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Save(Task{ID: fmt.Sprintf("m%d", i), Queue: "marketing", ExecuteAt: now.Add(time.Duration(i+1) * time.Minute)}))
+	}
+	require.NoError(t, store.Save(Task{ID: "d0", ExecuteAt: now.Add(time.Minute)}))
+	done := Task{ID: "m-done", Queue: "marketing", ExecuteAt: now, Status: StatusSucceeded}
+	require.NoError(t, store.Update(done))
+
+	// A queue alone walks every status; with a status it is one partition.
+	all, _, err := store.ListTasks(ListFilter{Queue: "marketing"}, "", 0)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	var ids []string
+	cursor := ""
+	for {
+		page, next, err := store.ListTasks(ListFilter{Status: string(StatusPending), Queue: "marketing"}, cursor, 2)
+		require.NoError(t, err)
+		for _, task := range page {
+			ids = append(ids, task.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, []string{"m0", "m1", "m2"}, ids)
+
+	def, _, err := store.ListTasks(ListFilter{Queue: DefaultQueue}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, def, 1)
+	assert.Equal(t, "d0", def[0].ID)
+
+	counts, err := store.Counts(now.Add(90 * time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 3, counts.Queues["marketing"].ByStatus[StatusPending])
+	assert.Equal(t, 1, counts.Queues["marketing"].ByStatus[StatusSucceeded])
+	assert.Equal(t, 1, counts.Queues["marketing"].Overdue)
+	assert.Equal(t, 1, counts.Queues[DefaultQueue].Overdue)
+	assert.Equal(t, 4, counts.ByStatus[StatusPending])
+
+	deleted, err := store.DeleteTasks(ListFilter{Status: string(StatusPending), Queue: "marketing"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+	left, _, err := store.ListTasks(ListFilter{}, "", 0)
+	require.NoError(t, err)
+	assert.Len(t, left, 2, "other queues and statuses are untouched")
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+}
+
+func TestRekeyQueues(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	at := time.Now().Add(time.Minute)
+	legacy := Task{ID: "old", Status: StatusPending, ExecuteAt: at}
+
+	// Write the row the way the last build before queues did, then rewind the
+	// schema.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		val, err := json.Marshal(legacy)
+		if err != nil {
+			return err
+		}
+		key := []byte(fmt.Sprintf("task:%s:%019d:%s", legacy.Status, at.UnixNano(), legacy.ID))
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		if err := txn.Set(idIndexKey(legacy.ID), key); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(countPrefix+string(StatusPending)), []byte("1")); err != nil {
+			return err
+		}
+		return txn.Set([]byte(schemaKey), []byte("4"))
+	}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetTask("old")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, DefaultQueue, got.Queue, "the queue is recorded on the row")
+
+	listed, _, err := store.ListTasks(ListFilter{Status: string(StatusPending), Queue: DefaultQueue}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+
+	counts, err := store.Counts(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts.ByStatus[StatusPending])
+	assert.Equal(t, 1, counts.Queues[DefaultQueue].ByStatus[StatusPending])
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+}
+
+// An urgent task is drawn ahead of a backlog of older, less urgent work, even
+// when the backlog alone would fill the batch.
+func TestGetDueTasksByPriority(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, store.Save(Task{ID: fmt.Sprintf("digest%d", i), ExecuteAt: now.Add(time.Duration(i-60) * time.Minute)}))
+	}
+	require.NoError(t, store.Save(Task{ID: "reset", Priority: 9, ExecuteAt: now.Add(-time.Second)}))
+	require.NoError(t, store.Save(Task{ID: "report", Priority: 5, Queue: "reports", ExecuteAt: now.Add(-2 * time.Second)}))
+	require.NoError(t, store.Save(Task{ID: "later", Priority: 9, ExecuteAt: now.Add(time.Hour)}))
+
+	due, err := store.GetDueTasks(now, now, 3)
+	require.NoError(t, err)
+	require.Len(t, due, 3)
+	assert.Equal(t, "reset", due[0].ID)
+	assert.Equal(t, "report", due[1].ID, "priority orders across queues too")
+	assert.Equal(t, "digest0", due[2].ID, "oldest first within a priority")
+
+	counts, err := store.Counts(now)
+	require.NoError(t, err)
+	assert.Equal(t, 12, counts.Overdue, "every band's overdue head is counted")
+
+	p := 9
+	urgent, _, err := store.ListTasks(ListFilter{Status: string(StatusPending), Queue: DefaultQueue, Priority: &p}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, urgent, 2)
+	assert.Equal(t, "reset", urgent[0].ID)
+	assert.Equal(t, "later", urgent[1].ID)
+
+	p = 5
+	mid, _, err := store.ListTasks(ListFilter{Priority: &p}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, mid, 1)
+	assert.Equal(t, "report", mid[0].ID)
+
+	// Changing a task's priority moves it to its new band.
+	got, err := store.Transition("digest9", StatusPending, StatusPending, func(t *Task) error {
+		t.Priority = 9
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 9, got.Priority)
+	due, err = store.GetDueTasks(now, now, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "digest9", due[0].ID, "due before reset at the same priority")
+}
+
+func TestRekeyPriorities(t *testing.T) {
+	path := "./testdb_" + uuid.New().String()
+	defer os.RemoveAll(path)
+
+	store, err := NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	at := time.Now().Add(time.Minute)
+	legacy := Task{ID: "old", Status: StatusPending, Queue: "billing", ExecuteAt: at}
+
+	// Write the row the way the last build before priorities did, then rewind
+	// the schema.
+	require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+		val, err := json.Marshal(legacy)
+		if err != nil {
+			return err
+		}
+		key := []byte(fmt.Sprintf("task:%s:%s:%019d:%s", legacy.Status, legacy.Queue, at.UnixNano(), legacy.ID))
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		if err := txn.Set(idIndexKey(legacy.ID), key); err != nil {
+			return err
+		}
+		if err := txn.Set(countKey(legacy.Queue, StatusPending), []byte("1")); err != nil {
+			return err
+		}
+		return txn.Set([]byte(schemaKey), []byte("5"))
+	}))
+	require.NoError(t, store.Close())
+
+	store, err = NewBadgerStore(path, time.Hour)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.GetTask("old")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+
+	p := MinPriority
+	listed, _, err := store.ListTasks(ListFilter{Status: string(StatusPending), Queue: "billing", Priority: &p}, "", 0)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+
+	due, err := store.GetDueTasks(at, at, 0)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	drift, err := store.Recount()
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+}
+
+// Dead letters written while failed tasks still took the history TTL are given
+// the dead-letter expiry on upgrade, indexes included.
+func TestRetainDeadLetters(t *testing.T) {
+	finished := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	legacy := Task{ID: "dead", Status: StatusFailed, SeriesID: "s1", RunNumber: 2,
+		ExecuteAt: finished.Add(-time.Minute), FinishedAt: &finished}
+
+	// seed writes the failed row the way the last build before dead-letter
+	// retention did, expiring an hour out, then rewinds the schema.
+	seed := func(t *testing.T) string {
+		path := "./testdb_" + uuid.New().String()
+		t.Cleanup(func() { os.RemoveAll(path) })
+		store, err := NewBadgerStore(path, time.Hour)
+		require.NoError(t, err)
+		expiresAt := uint64(time.Now().Add(time.Hour).Unix())
+		require.NoError(t, store.db.Update(func(txn *badger.Txn) error {
+			val, err := json.Marshal(legacy)
+			if err != nil {
+				return err
+			}
+			key := []byte(taskKey(legacy))
+			for _, e := range []*badger.Entry{
+				badger.NewEntry(key, val),
+				badger.NewEntry(idIndexKey(legacy.ID), key),
+				badger.NewEntry(seriesIndexKey(legacy), nil),
+			} {
+				e.ExpiresAt = expiresAt
+				if err := txn.SetEntry(e); err != nil {
+					return err
+				}
+			}
+			return txn.Set([]byte(schemaKey), []byte("6"))
+		}))
+		require.NoError(t, store.Close())
+		return path
+	}
+	expiries := func(t *testing.T, store *BadgerStore) []uint64 {
+		var got []uint64
+		require.NoError(t, store.db.View(func(txn *badger.Txn) error {
+			for _, key := range [][]byte{[]byte(taskKey(legacy)), idIndexKey(legacy.ID), seriesIndexKey(legacy)} {
+				item, err := txn.Get(key)
+				if err != nil {
+					return err
+				}
+				got = append(got, item.ExpiresAt())
+			}
+			return nil
+		}))
+		return got
+	}
+
+	t.Run("kept by default", func(t *testing.T) {
+		store, err := NewBadgerStore(seed(t), time.Hour)
+		require.NoError(t, err)
+		defer store.Close()
+		assert.Equal(t, []uint64{0, 0, 0}, expiries(t, store))
+	})
+
+	t.Run("with a dead-letter retention", func(t *testing.T) {
+		store, err := NewBadgerStore(seed(t), time.Hour, WithDeadLetterRetention(48*time.Hour))
+		require.NoError(t, err)
+		defer store.Close()
+		want := uint64(finished.Add(48 * time.Hour).Unix())
+		assert.Equal(t, []uint64{want, want, want}, expiries(t, store), "counted from when it failed")
+	})
+}
+
+func TestSeries(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	run := func(n int, status TaskStatus) Task {
+		return Task{ID: fmt.Sprintf("run%d", n), SeriesID: "s1", RunNumber: n, Schedule: "1h",
+			ExecuteAt: now.Add(time.Duration(n-3) * time.Hour), Status: status}
+	}
+	// Stored out of order: the listing is by run number, not by write or due.
+	require.NoError(t, store.Update(run(2, StatusFailed)))
+	require.NoError(t, store.Update(run(1, StatusSucceeded)))
+	require.NoError(t, store.Save(run(3, StatusPending)))
+	require.NoError(t, store.Save(Task{ID: "other", SeriesID: "s2", RunNumber: 1, ExecuteAt: now}))
+
+	runs, next, err := store.ListSeries("s1", "", 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, []string{"run1", "run2"}, []string{runs[0].ID, runs[1].ID})
+	require.NotEmpty(t, next)
+	runs, next, err = store.ListSeries("s1", next, 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, "run3", runs[0].ID)
+	assert.Empty(t, next)
+
+	_, _, err = store.ListSeries("s2", encodeCursor(seriesIndexKey(run(1, StatusPending))), 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor from another series")
+
+	// A status change moves the row, not its place in the series.
+	_, err = store.Transition("run3", StatusPending, StatusRunning, nil)
+	require.NoError(t, err)
+	runs, _, err = store.ListSeries("s1", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, runs, 3)
+
+	n, err := store.CancelSeries("s1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "only the unfinished run is cancelled")
+	got, err := store.GetTask("run3")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCancelled, got.Status)
+	got, err = store.GetTask("run1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+
+	assert.ErrorIs(t, store.Save(run(4, StatusPending)), ErrSeriesCancelled,
+		"a successor saved after the cancel is refused")
+	require.NoError(t, store.Save(Task{ID: "other2", SeriesID: "s2", RunNumber: 2, ExecuteAt: now}))
+
+	require.NoError(t, store.Delete("run2"))
+	runs, _, err = store.ListSeries("s1", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, runs, 2, "a deleted run leaves its series")
+
+	_, err = store.CancelSeries("nope", now)
+	assert.ErrorIs(t, err, ErrNotFound)
+	runs, _, err = store.ListSeries("s1:run1", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
+
+func TestSigningKeys(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	created := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.CreateSigningKey(SigningKey{ID: "tenant-b", Secret: "b-secret", CreatedAt: created}))
+	require.NoError(t, store.CreateSigningKey(SigningKey{ID: "tenant-a", Secret: "a-secret", CreatedAt: created}))
+	assert.ErrorIs(t, store.CreateSigningKey(SigningKey{ID: "tenant-a", Secret: "other"}), ErrSigningKeyExists)
+
+	keys, err := store.ListSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "tenant-a", keys[0].ID)
+	assert.Equal(t, "a-secret", keys[0].Secret, "the first create stands")
+
+	at := created.Add(time.Hour)
+	k, err := store.RotateSigningKey("tenant-a", "a-secret-2", at, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a-secret-2", "a-secret"}, k.Secrets(at.Add(time.Hour)), "both sign inside the window")
+	assert.Equal(t, []string{"a-secret-2"}, k.Secrets(at.Add(24*time.Hour)), "the old one stops at its end")
+	got, err := store.SigningKey("tenant-a")
+	require.NoError(t, err)
+	assert.Equal(t, k, got)
+
+	k, err = store.RotateSigningKey("tenant-a", "a-secret-3", at, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a-secret-3"}, k.Secrets(at), "no overlap retires the old secret at once")
+
+	_, err = store.RotateSigningKey("missing", "x", at, time.Hour)
+	assert.ErrorIs(t, err, ErrSigningKeyNotFound)
+
+	require.NoError(t, store.DeleteSigningKey("tenant-a"))
+	assert.ErrorIs(t, store.DeleteSigningKey("tenant-a"), ErrSigningKeyNotFound)
+	got, err = store.SigningKey("tenant-a")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestEd25519KeyStored(t *testing.T) {
+	store, cleanup := setupBadgerDB(t)
+	defer cleanup()
+
+	first, err := store.Ed25519Key()
+	require.NoError(t, err)
+	again, err := store.Ed25519Key()
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, again.ID, "generated once, then kept")
+	assert.True(t, first.PrivateKey.Equal(again.PrivateKey))
+}
@@ -0,0 +1,47 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+)
+
+// The delivery side's state as the admin API reports it. The runner keeps it;
+// the types live here so the API can report it without depending on the
+// runner.
+
+// ErrUnknownQueue is returned for a queue SCHEDY_QUEUES doesn't declare.
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// QueueStatus is one queue as reported by GET /queues.
+type QueueStatus struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+	// Concurrency caps the queue's deliveries in flight; 0 leaves it to the
+	// global limit alone.
+	Concurrency int `json:"concurrency,omitempty"`
+	// Inflight is how many of the queue's deliveries hold a slot right now.
+	Inflight int `json:"inflight"`
+}
+
+// BreakerState is where a host's circuit breaker stands.
+type BreakerState string
+
+const (
+	// BreakerClosed delivers normally, counting consecutive failures.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen defers every delivery to the host until the cool-down ends.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe through; its outcome closes the
+	// breaker or opens it for another cool-down.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStatus is one host's breaker as reported by GET /admin/breakers.
+type BreakerStatus struct {
+	Host  string       `json:"host"`
+	State BreakerState `json:"state"`
+	// Failures is the current run of consecutive failed deliveries.
+	Failures int `json:"consecutive_failures"`
+	// RetryAt is when an open breaker lets its probe through.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
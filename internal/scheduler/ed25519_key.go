@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Ed25519Key is the private key deliveries in the ed25519 scheme are signed
+// with. Receivers verify with its public half, published at
+// /.well-known/schedy-keys, so unlike an HMAC secret nothing a receiver holds
+// lets it sign requests to another receiver.
+//
+// ponytail: there is one key and no rotation. The published set is a list so
+// that a rotation, once there is one, can publish the next key beside it.
+type Ed25519Key struct {
+	// ID is the RFC 7638 thumbprint of the public key, sent with each
+	// signature so a receiver knows which published key to check.
+	ID         string             `json:"id"`
+	PrivateKey ed25519.PrivateKey `json:"private_key"`
+}
+
+// NewEd25519Key generates a key.
+func NewEd25519Key() (*Ed25519Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519KeyOf(priv), nil
+}
+
+func ed25519KeyOf(priv ed25519.PrivateKey) *Ed25519Key {
+	pub := priv.Public().(ed25519.PublicKey)
+	// The thumbprint hashes the required members, in lexical order, with no
+	// whitespace: exactly what encoding/json writes for this struct.
+	canonical, _ := json.Marshal(struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+	}{"Ed25519", "OKP", base64.RawURLEncoding.EncodeToString(pub)})
+	sum := sha256.Sum256(canonical)
+	return &Ed25519Key{ID: base64.RawURLEncoding.EncodeToString(sum[:]), PrivateKey: priv}
+}
+
+// JWK is a public key as published in a JSON Web Key Set (RFC 8037).
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWK returns k's public half.
+func (k Ed25519Key) JWK() JWK {
+	pub := k.PrivateKey.Public().(ed25519.PublicKey)
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+		Kid: k.ID,
+		Alg: "EdDSA",
+		Use: "sig",
+	}
+}
+
+// LoadEd25519KeyFile reads the PKCS #8 PEM private key at path, or generates
+// one and writes it there, readable by its owner only, if there is no file.
+func LoadEd25519KeyFile(path string) (*Ed25519Key, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		k, err := NewEd25519Key()
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		// O_EXCL: two processes racing to create the file can't each write a
+		// key and sign with different ones.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return k, f.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM \"PRIVATE KEY\" block", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return ed25519KeyOf(priv), nil
+}
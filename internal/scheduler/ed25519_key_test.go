@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEd25519KeyID(t *testing.T) {
+	// RFC 8037 appendix A: the example key and its RFC 7638 thumbprint.
+	seed, err := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	require.NoError(t, err)
+	k := ed25519KeyOf(ed25519.NewKeyFromSeed(seed))
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", k.ID)
+
+	jwk := k.JWK()
+	assert.Equal(t, "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo", jwk.X)
+	assert.Equal(t, k.ID, jwk.Kid)
+	assert.Equal(t, "OKP", jwk.Kty)
+	assert.Equal(t, "EdDSA", jwk.Alg)
+}
+
+func TestLoadEd25519KeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedy.pem")
+
+	created, err := LoadEd25519KeyFile(path)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := LoadEd25519KeyFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, loaded.ID)
+	assert.True(t, created.PrivateKey.Equal(loaded.PrivateKey))
+
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	require.NoError(t, os.WriteFile(bad, []byte("not a key"), 0o600))
+	_, err = LoadEd25519KeyFile(bad)
+	assert.Error(t, err)
+}
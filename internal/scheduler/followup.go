@@ -0,0 +1,36 @@
+package scheduler
+
+import "time"
+
+// MaxFollowUpDepth bounds how deeply on_success templates nest: a task, its
+// follow-up, the follow-up's follow-up, and so on.
+const MaxFollowUpDepth = 10
+
+// TaskTemplate is a task to create later: the follow-up a Task's OnSuccess
+// enqueues when it succeeds. It carries the client-owned fields of a one-shot
+// task, with Delay, a Go duration from the success, in place of a fire time.
+// Its OnSuccess is the follow-up's own follow-up, so a flow of steps can be
+// set up in one create.
+type TaskTemplate struct {
+	TaskSpec
+	Delay string `json:"delay,omitempty"`
+}
+
+// Depth reports how many templates nest here, this one included.
+func (tpl *TaskTemplate) Depth() int {
+	n := 0
+	for ; tpl != nil; tpl = tpl.OnSuccess {
+		n++
+	}
+	return n
+}
+
+// FollowUp builds the task tpl describes, enqueued by parent's success at
+// now.
+func (tpl TaskTemplate) FollowUp(id string, parent Task, now time.Time) Task {
+	delay, _ := time.ParseDuration(tpl.Delay)
+	t := Task{ID: id, ParentID: parent.ID, Status: StatusPending}
+	tpl.Apply(&t)
+	t.ExecuteAt = now.Add(delay).Add(t.JitterOffset())
+	return t
+}
@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowUpFromTemplate(t *testing.T) {
+	interval := 500
+	tpl := TaskTemplate{
+		TaskSpec: TaskSpec{
+			URL:           "http://example.com/b",
+			Method:        http.MethodPost,
+			RetryInterval: &interval,
+			Jitter:        "1m",
+		},
+		Delay: "5m",
+	}
+	now := time.Now().UTC()
+	child := tpl.FollowUp("child", Task{ID: "parent"}, now)
+
+	assert.Equal(t, "child", child.ID)
+	assert.Equal(t, "parent", child.ParentID)
+	assert.Equal(t, StatusPending, child.Status)
+	assert.Equal(t, 500, child.RetryInterval)
+	assert.Equal(t, now.Add(5*time.Minute), child.ScheduledAt(), "due delay after the success, before jitter")
+	assert.Equal(t, now.Add(5*time.Minute).Add(child.JitterOffset()), child.ExecuteAt)
+}
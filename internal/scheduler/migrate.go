@@ -0,0 +1,289 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// schemaKey records how many entries of migrations a data directory has been
+// through. Absent means a directory written before the first migration (or a
+// brand-new one, for which every step is a cheap no-op).
+const schemaKey = "meta:schema"
+
+// migrations bring an existing data directory up to the current layout when
+// the store opens. Entry i upgrades schema version i to i+1, so the slice is
+// append-only: reordering or removing a step would skip or repeat it on
+// directories already part-way through.
+var migrations = []func(s *BadgerStore) error{
+	onDB(backfillIDIndex),
+	onDB(backfillDedupeIndexes),
+	onDB(initCounts),
+	onDB(rekeyNanos),
+	onDB(rekeyQueues),
+	onDB(rekeyPriorities),
+	(*BadgerStore).retainDeadLetters,
+}
+
+// onDB adapts a migration that needs only the database, not the store's
+// options.
+func onDB(step func(db *badger.DB) error) func(s *BadgerStore) error {
+	return func(s *BadgerStore) error { return step(s.db) }
+}
+
+// migrate runs every migration the data directory has not seen yet, recording
+// progress after each step so an interrupted upgrade resumes rather than
+// restarts.
+func migrate(s *BadgerStore) error {
+	db := s.db
+	version := 0
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(schemaKey))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			version, err = strconv.Atoi(string(val))
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](s); err != nil {
+			return err
+		}
+		next := []byte(strconv.Itoa(version + 1))
+		if err := db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(schemaKey), next)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillIDIndex writes the id->key index for tasks stored before it existed.
+//
+// It goes through a WriteBatch rather than one transaction: a store large
+// enough to need the index is exactly the store whose backfill would blow
+// Badger's per-transaction size limit. Each index entry copies its row's
+// expiry so history TTL keeps applying to both.
+func backfillIDIndex(db *badger.DB) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			k, ok := parseKey(string(key))
+			if !ok {
+				continue
+			}
+			e := badger.NewEntry(idIndexKey(k.id), key)
+			e.ExpiresAt = item.ExpiresAt()
+			if err := wb.SetEntry(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// rekeyNanos moves every task from the old second-granular key
+// ("task:<status>:<16-digit-unix-s>:<id>") to the nanosecond layout, keeping
+// each row's expiry and repointing its id index entry.
+//
+// The new key is derived from the row, not the old key, so the step is safe to
+// re-run after an interruption: a row already moved derives its own key and is
+// skipped, and one moved but not yet deleted is simply moved again. The View's
+// snapshot never sees the batch's writes, so nothing is visited twice.
+func rekeyNanos(db *badger.DB) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			var t Task
+			if err := json.Unmarshal(val, &t); err != nil {
+				continue // unreadable either way; leave it where it is
+			}
+			key := []byte(taskKey(t))
+			if bytes.Equal(key, item.Key()) {
+				continue
+			}
+			for _, e := range []*badger.Entry{
+				badger.NewEntry(key, val),
+				badger.NewEntry(idIndexKey(t.ID), key),
+			} {
+				e.ExpiresAt = item.ExpiresAt()
+				if err := wb.SetEntry(e); err != nil {
+					return err
+				}
+			}
+			if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// rekeyQueues moves every task into its queue's partition
+// ("task:<status>:<queue>:<zero-padded-ns>:<id>"), recording DefaultQueue on
+// rows written before tasks had one, then rebuilds the counters per queue.
+//
+// Like rekeyNanos it derives the new key from the row, so an interrupted run
+// is safe to repeat; a row is left alone only once it both sits at its derived
+// key and names its queue.
+func rekeyQueues(db *badger.DB) error {
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			var t Task
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &t)
+			}); err != nil {
+				continue // unreadable either way; leave it where it is
+			}
+			key := []byte(taskKey(t))
+			if bytes.Equal(key, item.Key()) && t.Queue != "" {
+				continue
+			}
+			t.Queue = t.QueueName()
+			val, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			for _, e := range []*badger.Entry{
+				badger.NewEntry(key, val),
+				badger.NewEntry(idIndexKey(t.ID), key),
+			} {
+				e.ExpiresAt = item.ExpiresAt()
+				if err := wb.SetEntry(e); err != nil {
+					return err
+				}
+			}
+			if !bytes.Equal(key, item.Key()) {
+				if err := wb.Delete(item.KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	return initCounts(db)
+}
+
+// rekeyPriorities moves every task into its priority band
+// ("task:<status>:<queue>:<band>:<zero-padded-ns>:<id>"). A row written before
+// tasks had a priority reads as MinPriority, which the key records as it is,
+// so this is rekeyNanos's move - derived from the row, safe to repeat - against
+// the new layout; the counters are per queue and status and don't change.
+func rekeyPriorities(db *badger.DB) error {
+	return rekeyNanos(db)
+}
+
+// retainDeadLetters gives the failed tasks stored before dead letters had a
+// retention of their own the dead-letter expiry in place of the history TTL
+// they were written with: none by default, or WithDeadLetterRetention's from
+// when they failed. Each row's id and series index entries get the same
+// expiry; a finished task has no schedule index entry.
+//
+// Rewriting a row with its own value is idempotent, so an interrupted run is
+// safe to repeat.
+func (s *BadgerStore) retainDeadLetters() error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(statusPrefix(StatusFailed))
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			var t Task
+			if err := json.Unmarshal(val, &t); err != nil {
+				continue // unreadable either way; leave it where it is
+			}
+			var expiresAt uint64
+			if s.dlqTTL > 0 {
+				failedAt := time.Now()
+				if t.FinishedAt != nil {
+					failedAt = *t.FinishedAt
+				}
+				expiresAt = uint64(failedAt.Add(s.dlqTTL).Unix())
+			}
+			key := item.KeyCopy(nil)
+			entries := []*badger.Entry{
+				badger.NewEntry(key, val),
+				badger.NewEntry(idIndexKey(t.ID), key),
+			}
+			if t.SeriesID != "" {
+				entries = append(entries, badger.NewEntry(seriesIndexKey(t), nil))
+			}
+			for _, e := range entries {
+				e.ExpiresAt = expiresAt
+				if err := wb.SetEntry(e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A payload template is a Task's body, url query and header values with
+// {{name}} references to DeliveryVars, filled in afresh for every attempt.
+// It is substitution and nothing more: there are no expressions, functions or
+// conditionals to evaluate, so a template can't run code or loop, and can only
+// fail at create time, when it is checked.
+
+// DeliveryVars are the values a payload template can reference, as of one
+// delivery attempt.
+type DeliveryVars struct {
+	TaskID      string    // {{task_id}}
+	SeriesID    string    // {{series_id}}: the task id, for a one-shot task
+	RunNumber   int       // {{run_number}}: the run's place in its series; 1 for a one-shot task
+	ScheduledAt time.Time // {{scheduled_at}}: when the run was requested for, before jitter
+	FiredAt     time.Time // {{fired_at}}: when this attempt was sent
+	Attempt     int       // {{attempt}}: this attempt's number, counting every earlier one
+}
+
+// templateVars names every variable a template may reference.
+var templateVars = map[string]func(DeliveryVars) string{
+	"task_id":      func(v DeliveryVars) string { return v.TaskID },
+	"series_id":    func(v DeliveryVars) string { return v.SeriesID },
+	"run_number":   func(v DeliveryVars) string { return strconv.Itoa(v.RunNumber) },
+	"scheduled_at": func(v DeliveryVars) string { return v.ScheduledAt.UTC().Format(time.RFC3339Nano) },
+	"fired_at":     func(v DeliveryVars) string { return v.FiredAt.UTC().Format(time.RFC3339Nano) },
+	"attempt":      func(v DeliveryVars) string { return strconv.Itoa(v.Attempt) },
+}
+
+// DeliveryVars returns the template values for t's next attempt, sent at
+// firedAt.
+func (t Task) DeliveryVars(firedAt time.Time) DeliveryVars {
+	series := t.SeriesID
+	if series == "" {
+		series = t.ID
+	}
+	return DeliveryVars{
+		TaskID:      t.ID,
+		SeriesID:    series,
+		RunNumber:   max(t.RunNumber, 1),
+		ScheduledAt: t.ScheduledAt(),
+		FiredAt:     firedAt,
+		Attempt:     len(t.Attempts) + 1,
+	}
+}
+
+// CheckTemplate reports a malformed or unknown reference in s. Every "{{"
+// opens a reference; there is no escaping a literal one.
+func CheckTemplate(s string) error {
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			return nil
+		}
+		s = s[i+2:]
+		j := strings.Index(s, "}}")
+		if j < 0 {
+			return errors.New(`"{{" is never closed`)
+		}
+		name := strings.TrimSpace(s[:j])
+		if _, ok := templateVars[name]; !ok {
+			return fmt.Errorf("unknown variable %q (task_id, series_id, run_number, scheduled_at, fired_at or attempt)", name)
+		}
+		s = s[j+2:]
+	}
+}
+
+// RenderTemplate fills in s's references, passing each value through escape
+// (nil for none). s should have passed CheckTemplate; a reference that hasn't
+// is left as it is.
+func RenderTemplate(s string, vars DeliveryVars, escape func(string) string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			break
+		}
+		j := strings.Index(s[i+2:], "}}")
+		if j < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		ref := s[i : i+2+j+2]
+		if value, ok := templateVars[strings.TrimSpace(ref[2:len(ref)-2])]; ok {
+			v := value(vars)
+			if escape != nil {
+				v = escape(v)
+			}
+			b.WriteString(v)
+		} else {
+			b.WriteString(ref)
+		}
+		s = s[i+2+j+2:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// CheckPayloadTemplate checks every templated part of a task: each string in
+// its payload, each header value, and its url's query. The rest of the url is
+// not templated, so a reference there is an error rather than sent as is.
+func CheckPayloadTemplate(rawURL string, headers map[string]string, payload any) error {
+	path, query, _ := strings.Cut(rawURL, "?")
+	if strings.Contains(path, "{{") {
+		return errors.New("url: only the query can reference variables")
+	}
+	if err := CheckTemplate(query); err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+	for name, v := range headers {
+		if err := CheckTemplate(v); err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+	}
+	if err := checkPayload(payload); err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	return nil
+}
+
+func checkPayload(p any) error {
+	switch v := p.(type) {
+	case string:
+		return CheckTemplate(v)
+	case map[string]any:
+		for _, e := range v {
+			if err := checkPayload(e); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if err := checkPayload(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RenderURL fills in the references in rawURL's query, escaped as query text.
+func RenderURL(rawURL string, vars DeliveryVars) string {
+	path, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	return path + "?" + RenderTemplate(query, vars, url.QueryEscape)
+}
+
+// RenderPayload returns a copy of p with the references in every string
+// filled in; p itself is left alone. Only string values are templated, never
+// object keys, so a JSON payload stays well-formed whatever the values hold.
+func RenderPayload(p any, vars DeliveryVars) any {
+	switch v := p.(type) {
+	case string:
+		return RenderTemplate(v, vars, nil)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = RenderPayload(e, vars)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = RenderPayload(e, vars)
+		}
+		return out
+	}
+	return p
+}
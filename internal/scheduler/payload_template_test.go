@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadTemplate(t *testing.T) {
+	vars := DeliveryVars{
+		TaskID:      "t1",
+		SeriesID:    "s1",
+		RunNumber:   3,
+		ScheduledAt: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC),
+		FiredAt:     time.Date(2030, 1, 1, 9, 0, 1, 500_000_000, time.UTC),
+		Attempt:     2,
+	}
+
+	t.Run("renders every variable", func(t *testing.T) {
+		s := "{{task_id}} {{series_id}} #{{run_number}} {{ scheduled_at }} {{fired_at}} try {{attempt}}"
+		require.NoError(t, CheckTemplate(s))
+		assert.Equal(t, "t1 s1 #3 2030-01-01T09:00:00Z 2030-01-01T09:00:01.5Z try 2", RenderTemplate(s, vars, nil))
+	})
+
+	t.Run("rejects what it can't render", func(t *testing.T) {
+		for _, s := range []string{"{{task_id", "{{ now }}", "{{}}", `{{index .Payload 0}}`} {
+			assert.Error(t, CheckTemplate(s), s)
+		}
+		assert.NoError(t, CheckTemplate("no references, and a lone }} is just text"))
+	})
+
+	t.Run("escapes url query values", func(t *testing.T) {
+		got := RenderURL("https://example.com/a?at={{scheduled_at}}&run={{run_number}}", vars)
+		assert.Equal(t, "https://example.com/a?at=2030-01-01T09%3A00%3A00Z&run=3", got)
+		assert.Equal(t, "https://example.com/a", RenderURL("https://example.com/a", vars))
+	})
+
+	t.Run("templates payload strings, not keys", func(t *testing.T) {
+		p := map[string]any{
+			"{{task_id}}": "{{task_id}}",
+			"list":        []any{"run {{run_number}}", 1.5, nil},
+			"ok":          true,
+		}
+		got := RenderPayload(p, vars)
+		assert.Equal(t, map[string]any{
+			"{{task_id}}": "t1",
+			"list":        []any{"run 3", 1.5, nil},
+			"ok":          true,
+		}, got)
+		assert.Equal(t, "{{task_id}}", p["{{task_id}}"], "the template itself is untouched")
+	})
+
+	t.Run("checks every templated part", func(t *testing.T) {
+		assert.NoError(t, CheckPayloadTemplate("https://example.com/a?run={{run_number}}",
+			map[string]string{"X-Run": "{{run_number}}"}, map[string]any{"a": []any{"{{attempt}}"}}))
+		assert.ErrorContains(t, CheckPayloadTemplate("https://example.com/{{task_id}}", nil, nil), "only the query")
+		assert.ErrorContains(t, CheckPayloadTemplate("https://example.com/a?x={{x}}", nil, nil), "url")
+		assert.ErrorContains(t, CheckPayloadTemplate("https://example.com/a", map[string]string{"X-Run": "{{x}}"}, nil), "header X-Run")
+		assert.ErrorContains(t, CheckPayloadTemplate("https://example.com/a", nil, map[string]any{"a": []any{"{{x}}"}}), "payload")
+	})
+
+	t.Run("vars for a task's next attempt", func(t *testing.T) {
+		at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+		task := Task{ID: "t1", ExecuteAt: at, Attempts: []Attempt{{N: 1}}}
+		v := task.DeliveryVars(at.Add(time.Second))
+		assert.Equal(t, "t1", v.SeriesID, "a one-shot task is its own series")
+		assert.Equal(t, 1, v.RunNumber)
+		assert.Equal(t, 2, v.Attempt)
+		assert.Equal(t, at, v.ScheduledAt)
+	})
+}
@@ -0,0 +1,296 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	// Calendar schedules name IANA zones; embedding the database keeps them
+	// resolvable in a container without one, and the same on every host.
+	_ "time/tzdata"
+)
+
+// ScheduleType selects how a recurring Task's Schedule is read.
+type ScheduleType string
+
+const (
+	// ScheduleInterval reads Schedule as a Go duration, measured from each
+	// fire ("15m", "24h"). The default.
+	ScheduleInterval ScheduleType = "interval"
+	// ScheduleCalendar reads Schedule as wall-clock times in the Task's
+	// Timezone: see ParseCalendar.
+	ScheduleCalendar ScheduleType = "calendar"
+)
+
+// Valid reports whether s is a recognised schedule type. Empty is an interval,
+// as it was before schedule types existed.
+func (s ScheduleType) Valid() bool {
+	return s == "" || s == ScheduleInterval || s == ScheduleCalendar
+}
+
+// CatchUp is a recurring Task's policy for the runs its schedule had due while
+// a run was late - after downtime, say.
+type CatchUp string
+
+const (
+	// CatchUpOnce fires the late run once and measures on from when it fired,
+	// so an interval chain takes on the late run's phase. The default.
+	CatchUpOnce CatchUp = "once"
+	// CatchUpSkip fires the late run, drops the runs missed since, and
+	// realigns to the schedule's phase.
+	CatchUpSkip CatchUp = "skip"
+	// CatchUpAll delivers every missed run, one after another, up to the
+	// latest MaxCatchUpRuns, then carries on in phase.
+	CatchUpAll CatchUp = "all"
+)
+
+// MaxCatchUpRuns bounds how many missed runs CatchUpAll delivers. The older
+// ones are dropped, as CatchUpSkip would.
+const MaxCatchUpRuns = 100
+
+// MaxCatchUpWalk bounds how many of a calendar's times CatchUpAll steps
+// through to find the missed runs: a calendar can only be walked forward, from
+// the first run missed. An outage with more runs than this in it - a year of
+// a calendar with 27 times a day - is caught up as CatchUpSkip would, rather
+// than walked on every late run.
+const MaxCatchUpWalk = 10_000
+
+// Valid reports whether c is a recognised policy. Empty is CatchUpOnce, as it
+// was before policies existed.
+func (c CatchUp) Valid() bool {
+	return c == "" || c == CatchUpOnce || c == CatchUpSkip || c == CatchUpAll
+}
+
+// Recurrence computes a recurring Task's runs.
+type Recurrence interface {
+	// Next returns the first fire time strictly after after, or false if
+	// there is none.
+	Next(after time.Time) (time.Time, bool)
+}
+
+// ParseSchedule reads a schedule of the given type. timezone applies to a
+// calendar only; empty is UTC.
+func ParseSchedule(kind ScheduleType, spec, timezone string) (Recurrence, error) {
+	switch kind {
+	case "", ScheduleInterval:
+		if timezone != "" {
+			return nil, errors.New("timezone applies to calendar schedules only")
+		}
+		d, err := time.ParseDuration(spec)
+		if err != nil || d <= 0 {
+			return nil, errors.New(`positive Go duration like "15m" required`)
+		}
+		return interval(d), nil
+	case ScheduleCalendar:
+		loc, err := LoadTimezone(timezone)
+		if err != nil {
+			return nil, err
+		}
+		c, err := ParseCalendar(spec)
+		if err != nil {
+			return nil, err
+		}
+		c.loc = loc
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown schedule_type %q", kind)
+}
+
+// LoadTimezone resolves an IANA zone name ("Europe/Berlin"); empty is UTC.
+// "Local" is refused: it would mean whatever zone the server happens to run
+// in.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if name == "Local" {
+		return nil, errors.New(`timezone "Local" is not allowed (name an IANA zone)`)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+type interval time.Duration
+
+func (d interval) Next(after time.Time) (time.Time, bool) {
+	return after.Add(time.Duration(d)), true
+}
+
+// phased is an interval held to a phase: its runs fall on anchor + k*every,
+// however late any of them fires.
+type phased struct {
+	every  time.Duration
+	anchor time.Time
+}
+
+func (p phased) Next(after time.Time) (time.Time, bool) {
+	if after.Before(p.anchor) {
+		return p.anchor, true
+	}
+	n := after.Sub(p.anchor)/p.every + 1
+	return p.anchor.Add(n * p.every), true
+}
+
+// Calendar is a calendar schedule: times of day, optionally limited to some
+// weekdays and/or days of the month, in a time zone.
+type Calendar struct {
+	times    []int  // minutes after midnight, ascending
+	weekdays uint8  // bit per time.Weekday; 0 is every weekday
+	days     uint32 // bit per day of the month; 0 is every day
+	loc      *time.Location
+}
+
+// ParseCalendar reads a calendar spec: space-separated name=value fields,
+//
+//	at=09:00,17:30 weekdays=mon-fri
+//	at=08:00 days=1,15
+//
+// at (required) lists 24-hour times of day. weekdays lists mon..sun, with
+// ranges in Monday-first order ("mon-fri", "sat-sun"). days lists days of the
+// month, 1-31, with ranges ("1-7"); a day a month doesn't have is skipped in
+// that month. Given both, a day must match both.
+func ParseCalendar(spec string) (*Calendar, error) {
+	c := &Calendar{loc: time.UTC}
+	seen := map[string]bool{}
+	for _, f := range strings.Fields(spec) {
+		name, val, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not name=value", f)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s given twice", name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "at":
+			c.times, err = parseTimes(val)
+		case "weekdays":
+			err = parseList(val, func(s string) (int, error) {
+				d, ok := weekdayNames[s]
+				if !ok {
+					return 0, fmt.Errorf("%q is not a weekday (mon..sun)", s)
+				}
+				return d, nil
+			}, func(d int) { c.weekdays |= 1 << (d % 7) })
+		case "days":
+			err = parseList(val, func(s string) (int, error) {
+				d, err := strconv.Atoi(s)
+				if err != nil || d < 1 || d > 31 {
+					return 0, fmt.Errorf("%q is not a day of the month (1-31)", s)
+				}
+				return d, nil
+			}, func(d int) { c.days |= 1 << d })
+		default:
+			err = errors.New("unknown field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if len(c.times) == 0 {
+		return nil, errors.New(`at is required (e.g. "at=09:00")`)
+	}
+	return c, nil
+}
+
+// weekdayNames numbers the days Monday-first, so ranges read the way a week
+// does; Sunday's 7 folds to time.Sunday (0) when stored.
+var weekdayNames = map[string]int{"mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6, "sun": 7}
+
+func parseTimes(val string) ([]int, error) {
+	var times []int
+	for _, s := range strings.Split(val, ",") {
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not HH:MM", s)
+		}
+		m := t.Hour()*60 + t.Minute()
+		if !slices.Contains(times, m) {
+			times = append(times, m)
+		}
+	}
+	slices.Sort(times)
+	return times, nil
+}
+
+// parseList reads a comma list of single values and lo-hi ranges, calling set
+// for every value covered.
+func parseList(val string, parse func(string) (int, error), set func(int)) error {
+	for _, item := range strings.Split(val, ",") {
+		lo, hi, isRange := strings.Cut(item, "-")
+		from, err := parse(lo)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			if to, err = parse(hi); err != nil {
+				return err
+			}
+			if to < from {
+				return fmt.Errorf("%q runs backwards", item)
+			}
+		}
+		for v := from; v <= to; v++ {
+			set(v)
+		}
+	}
+	return nil
+}
+
+// calendarHorizon bounds the search for a calendar's next day. Every
+// combination of a weekday and a day of the month comes round within it.
+const calendarHorizon = 4 * 366
+
+// Next returns the first of the calendar's times after after.
+//
+// Times are wall-clock times in the calendar's zone, so a daily 09:00 stays
+// 09:00 across a DST change. A time skipped when clocks go forward fires late
+// by the length of the jump (02:30 becomes 03:30); a time repeated when clocks
+// go back fires once, at its first occurrence.
+func (c *Calendar) Next(after time.Time) (time.Time, bool) {
+	y, m, d := after.In(c.loc).Date()
+	for i := 0; i < calendarHorizon; i++ {
+		// Date arithmetic in UTC, where every day is 24 hours.
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, time.UTC)
+		if !c.onDay(day) {
+			continue
+		}
+		for _, minute := range c.times {
+			at := c.at(day, minute)
+			if at.After(after) {
+				return at.UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (c *Calendar) onDay(day time.Time) bool {
+	if c.weekdays != 0 && c.weekdays&(1<<day.Weekday()) == 0 {
+		return false
+	}
+	return c.days == 0 || c.days&(1<<day.Day()) != 0
+}
+
+// at resolves a time of day on day in the calendar's zone. A wall time that
+// occurs twice, when clocks go back, could resolve to either instant; it is
+// pinned to the first.
+func (c *Calendar) at(day time.Time, minute int) time.Time {
+	at := time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, c.loc)
+	_, off := at.Zone()
+	if _, before := at.Add(-12 * time.Hour).Zone(); before > off {
+		first := at.Add(-time.Duration(before-off) * time.Second)
+		if h, m, _ := first.In(c.loc).Clock(); h*60+m == minute {
+			return first
+		}
+	}
+	return at
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCalendar(t *testing.T) {
+	for _, spec := range []string{
+		"at=09:00",
+		"at=09:00,17:30 weekdays=mon-fri",
+		"at=00:00 weekdays=sat-sun days=1-7",
+		"days=1,15 at=08:00",
+	} {
+		_, err := ParseCalendar(spec)
+		assert.NoError(t, err, spec)
+	}
+	for _, spec := range []string{
+		"",
+		"weekdays=mon",
+		"at=9",
+		"at=24:00",
+		"at=09:00 at=10:00",
+		"at=09:00 weekdays=fri-mon",
+		"at=09:00 weekdays=monday",
+		"at=09:00 days=0",
+		"at=09:00 days=32",
+		"at=09:00 hours=1",
+		"*/5 * * * *",
+	} {
+		_, err := ParseCalendar(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	_, err := ParseSchedule("", "15m", "")
+	assert.NoError(t, err)
+	_, err = ParseSchedule(ScheduleInterval, "15m", "Europe/Berlin")
+	assert.Error(t, err, "a timezone means nothing to an interval")
+	_, err = ParseSchedule(ScheduleCalendar, "at=09:00", "Mars/Olympus_Mons")
+	assert.Error(t, err)
+	_, err = ParseSchedule(ScheduleCalendar, "at=09:00", "Local")
+	assert.Error(t, err, "the server's own zone is not a schedule")
+	_, err = ParseSchedule("cron", "at=09:00", "")
+	assert.Error(t, err)
+}
+
+func TestCalendarNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	calendar := func(spec, tz string) Recurrence {
+		t.Helper()
+		rec, err := ParseSchedule(ScheduleCalendar, spec, tz)
+		require.NoError(t, err)
+		return rec
+	}
+	// runs collects the first n fire times after from, in Berlin time.
+	runs := func(rec Recurrence, from time.Time, n int) []string {
+		var out []string
+		for i := 0; i < n; i++ {
+			next, ok := rec.Next(from)
+			require.True(t, ok)
+			out = append(out, next.In(berlin).Format("Mon 2006-01-02 15:04 MST"))
+			from = next
+		}
+		return out
+	}
+
+	t.Run("weekdays", func(t *testing.T) {
+		// Friday 2030-03-01 10:00: today's 09:00 has passed.
+		from := time.Date(2030, 3, 1, 10, 0, 0, 0, berlin)
+		assert.Equal(t, []string{
+			"Fri 2030-03-01 17:30 CET",
+			"Mon 2030-03-04 09:00 CET",
+			"Mon 2030-03-04 17:30 CET",
+		}, runs(calendar("at=09:00,17:30 weekdays=mon-fri", "Europe/Berlin"), from, 3))
+	})
+
+	t.Run("days of the month a month lacks are skipped", func(t *testing.T) {
+		from := time.Date(2030, 1, 31, 12, 0, 0, 0, berlin)
+		assert.Equal(t, []string{
+			"Sun 2030-03-31 08:00 CEST",
+			"Wed 2030-05-01 08:00 CEST",
+		}, runs(calendar("at=08:00 days=1,31 weekdays=wed,sun", "Europe/Berlin"), from, 2))
+	})
+
+	t.Run("wall-clock time holds across DST", func(t *testing.T) {
+		from := time.Date(2030, 3, 29, 12, 0, 0, 0, berlin)
+		assert.Equal(t, []string{
+			"Sat 2030-03-30 09:00 CET",
+			"Sun 2030-03-31 09:00 CEST",
+		}, runs(calendar("at=09:00", "Europe/Berlin"), from, 2))
+	})
+
+	t.Run("a time skipped by the spring jump fires after it", func(t *testing.T) {
+		from := time.Date(2030, 3, 30, 12, 0, 0, 0, berlin)
+		assert.Equal(t, []string{
+			"Sun 2030-03-31 03:30 CEST",
+			"Mon 2030-04-01 02:30 CEST",
+		}, runs(calendar("at=02:30", "Europe/Berlin"), from, 2))
+	})
+
+	t.Run("a time repeated in the autumn fires once", func(t *testing.T) {
+		from := time.Date(2030, 10, 26, 12, 0, 0, 0, berlin)
+		assert.Equal(t, []string{
+			"Sun 2030-10-27 02:30 CEST",
+			"Mon 2030-10-28 02:30 CET",
+		}, runs(calendar("at=02:30", "Europe/Berlin"), from, 2))
+	})
+
+	t.Run("defaults to UTC", func(t *testing.T) {
+		next, ok := calendar("at=09:00", "").Next(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC), next)
+	})
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Signing key outcomes.
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyExists   = errors.New("signing key already exists")
+)
+
+// SigningKey is a named HMAC secret a Task's deliveries can be signed with,
+// in place of the process-wide SCHEDY_SIGNING_SECRET, so each receiver can
+// hold a key of its own.
+//
+// Rotating a key replaces Secret and keeps the one it replaced as Previous
+// until PreviousUntil. Meanwhile deliveries carry a signature from each, so a
+// receiver can move to the new secret at its own pace rather than at the
+// moment of rotation.
+type SigningKey struct {
+	ID            string     `json:"id"`
+	Secret        string     `json:"secret"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RotatedAt     *time.Time `json:"rotated_at,omitempty"`
+	Previous      string     `json:"previous,omitempty"`
+	PreviousUntil *time.Time `json:"previous_until,omitempty"`
+}
+
+// Secrets returns the secrets a delivery at now is signed with: Secret, then
+// Previous while its window is open.
+func (k SigningKey) Secrets(now time.Time) []string {
+	if k.Previous != "" && k.PreviousUntil != nil && now.Before(*k.PreviousUntil) {
+		return []string{k.Secret, k.Previous}
+	}
+	return []string{k.Secret}
+}
+
+// Rotate replaces k's secret with secret as of at, keeping the old one signing
+// alongside it for overlap. A rotation inside an open window drops the secret
+// that window was for: only the last two secrets are ever live.
+func (k *SigningKey) Rotate(secret string, at time.Time, overlap time.Duration) {
+	until := at.Add(overlap)
+	k.Previous, k.Secret = k.Secret, secret
+	k.RotatedAt = &at
+	k.PreviousUntil = &until
+	if overlap <= 0 {
+		k.Previous, k.PreviousUntil = "", nil
+	}
+}
+
+// ValidSigningKeyID reports whether id can name a signing key. The rules are
+// a queue name's: a key id is part of a storage key too.
+func ValidSigningKeyID(id string) bool {
+	return ValidQueueName(id)
+}
+
+// SigningScheme selects the headers a delivery's signature travels in.
+type SigningScheme string
+
+const (
+	// SchemeSchedy is X-Schedy-Signature: "sha256=<hex>" over
+	// "<timestamp>.<body>", with X-Schedy-Timestamp.
+	SchemeSchedy SigningScheme = "schedy"
+	// SchemeStandardWebhooks follows the Standard Webhooks spec:
+	// webhook-signature "v1,<base64>" over "<id>.<timestamp>.<body>", with
+	// webhook-id and webhook-timestamp.
+	SchemeStandardWebhooks SigningScheme = "standard-webhooks"
+	// SchemeEd25519 is X-Schedy-Signature: "ed25519=<base64>" over
+	// "<timestamp>.<body>", signed with the Ed25519Key rather than a shared
+	// secret.
+	SchemeEd25519 SigningScheme = "ed25519"
+)
+
+// Valid reports whether s is a recognised signing scheme.
+func (s SigningScheme) Valid() bool {
+	return s == SchemeSchedy || s == SchemeStandardWebhooks || s == SchemeEd25519
+}
+
+// standardWebhooksPrefix marks a secret in the Standard Webhooks form, the
+// key's bytes base64-encoded.
+const standardWebhooksPrefix = "whsec_"
+
+// StandardWebhooksKey returns the HMAC key Standard Webhooks signing uses for
+// secret: a "whsec_<base64>" secret's decoded bytes, any other secret's bytes
+// as they are. Only a "whsec_" secret that isn't valid base64 is an error.
+func StandardWebhooksKey(secret string) ([]byte, error) {
+	enc, ok := strings.CutPrefix(secret, standardWebhooksPrefix)
+	if !ok {
+		return []byte(secret), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil || len(key) == 0 {
+		return nil, errors.New(`a "whsec_" secret must be followed by base64`)
+	}
+	return key, nil
+}
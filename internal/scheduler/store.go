@@ -2,13 +2,26 @@ package scheduler
 
 import (
 	"errors"
+	"strings"
 	"time"
 )
 
 // ErrInvalidCursor is returned by ListTasks when the supplied pagination cursor
-// is malformed or does not belong to the requested status partition.
+// is malformed or does not belong to the requested status (and queue)
+// partition.
 var ErrInvalidCursor = errors.New("invalid cursor")
 
+// Transition outcomes. ErrNotFound means the Task no longer exists; ErrConflict
+// means its status was not the expected one, so someone else moved it first.
+var (
+	ErrNotFound = errors.New("task not found")
+	ErrConflict = errors.New("task status changed")
+)
+
+// ErrSeriesCancelled is returned by Save for a run of a series that has been
+// cancelled as a whole.
+var ErrSeriesCancelled = errors.New("series cancelled")
+
 // Page size bounds for ListTasks. A task carries its full attempt history, so
 // an unbounded page is an unbounded response body.
 const (
@@ -27,39 +40,116 @@ const MaxDueBatch = 1000
 type Counts struct {
 	// ByStatus counts Tasks per lifecycle status.
 	ByStatus map[TaskStatus]int
-	// Overdue counts pending Tasks whose ExecuteAt has already passed - the
+	// Overdue counts pending Tasks whose DueAt has already passed - the
 	// backlog the runner has yet to work through.
 	Overdue int
+	// Queues breaks the same tallies down by queue, for every queue holding
+	// at least one Task.
+	Queues map[string]QueueCounts
+}
+
+// QueueCounts is one queue's share of Counts.
+type QueueCounts struct {
+	ByStatus map[TaskStatus]int
+	Overdue  int
+}
+
+// Maintenance is a pause of every delivery, typically while receivers are
+// redeployed. Tasks are still accepted; nothing is delivered until it ends.
+type Maintenance struct {
+	// Since is when the pause began.
+	Since time.Time `json:"since"`
+	// Until, if set, is when deliveries resume on their own.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Over reports whether the pause has run out as of now.
+func (m Maintenance) Over(now time.Time) bool {
+	return m.Until != nil && !now.Before(*m.Until)
 }
 
-// ListFilter selects which Tasks a listing returns. The zero value matches
-// everything.
+// ListFilter selects which Tasks a listing or a bulk delete covers. The zero
+// value matches everything.
 type ListFilter struct {
-	Status string // lifecycle status, "" = all
-	URL    string // exact delivery URL, "" = all
-	// DueBefore/DueAfter bound ExecuteAt (strictly before / strictly after,
-	// matching DeleteTasks), nil = unbounded.
+	Status   string // lifecycle status, "" = all
+	Queue    string // queue name, "" = all
+	Priority *int   // exact priority, nil = all
+	URL      string // exact delivery URL, "" = all
+	// DueBefore/DueAfter bound ExecuteAt (strictly before / strictly after),
+	// nil = unbounded.
 	DueBefore *time.Time
 	DueAfter  *time.Time
+	// Error and StatusCode match a Task's last attempt: a substring of its
+	// error, and its exact HTTP status. "" / 0 = all.
+	Error      string
+	StatusCode int
+}
+
+// matches reports whether t passes every filter that lives in the stored value
+// rather than the key: everything but Status and Queue.
+func (f ListFilter) matches(t Task) bool {
+	if f.URL != "" && t.URL != f.URL {
+		return false
+	}
+	if f.DueBefore != nil && !t.ExecuteAt.Before(*f.DueBefore) {
+		return false
+	}
+	if f.DueAfter != nil && !t.ExecuteAt.After(*f.DueAfter) {
+		return false
+	}
+	return f.matchesLastAttempt(t)
+}
+
+// matchesLastAttempt reports whether t's last attempt passes the Error and
+// StatusCode filters. A Task with no attempts only passes when neither is set.
+func (f ListFilter) matchesLastAttempt(t Task) bool {
+	if f.Error == "" && f.StatusCode == 0 {
+		return true
+	}
+	if len(t.Attempts) == 0 {
+		return false
+	}
+	last := t.Attempts[len(t.Attempts)-1]
+	if f.Error != "" && !strings.Contains(last.Error, f.Error) {
+		return false
+	}
+	return f.StatusCode == 0 || last.StatusCode == f.StatusCode
 }
 
 type Store interface {
-	// Save creates a new Task in the pending keyspace.
+	// Save creates a new Task in the pending keyspace. A run of a cancelled
+	// series is refused with ErrSeriesCancelled.
 	Save(task Task) error
 	// Update relocates a Task to match its current Status, applying the
-	// history TTL when the status is terminal.
+	// history TTL (or, for failed, dead-letter retention) when the status is
+	// terminal.
 	Update(task Task) error
 	// Delete hard-removes a Task by id regardless of status.
 	Delete(id string) error
+	// Transition atomically moves Task id from status from to status to,
+	// applying mutate to the stored copy on the way. Nothing is written if the
+	// Task is gone (ErrNotFound), is no longer in from (ErrConflict), or mutate
+	// returns an error, which is passed back unchanged. On success it returns
+	// the Task as written.
+	//
+	// It is the only safe way to change a Task someone else may be changing
+	// too: the status check and the write cannot be split by a competing one.
+	Transition(id string, from, to TaskStatus, mutate func(*Task) error) (*Task, error)
 	GetTask(id string) (*Task, error)
-	// DeleteTasks hard-removes every Task matching all given filters
-	// (url exact, status exact, ExecuteAt strictly before/after) and reports
-	// how many went. Empty/nil filters match everything.
-	DeleteTasks(url, status string, before, after *time.Time) (int, error)
-	// GetDueTasks returns at most limit pending Tasks whose ExecuteAt falls in
-	// [start, end], oldest first. limit is clamped to [1, MaxDueBatch],
-	// defaulting to MaxDueBatch when <= 0; a backlog larger than one batch is
-	// drained over successive calls rather than loaded at once.
+	// FindDuplicate returns the Task a create would duplicate, or nil. With an
+	// idempotencyKey that is the Task holding the key; without one, an
+	// unfinished Task with the same url and exactly the same ScheduledAt -
+	// ExecuteAt before jitter.
+	FindDuplicate(idempotencyKey, url string, executeAt time.Time) (*Task, error)
+	// DeleteTasks hard-removes every Task matching filter and reports how
+	// many went. The zero filter matches everything.
+	DeleteTasks(filter ListFilter) (int, error)
+	// GetDueTasks returns at most limit pending Tasks whose DueAt falls in
+	// [start, end], highest priority first and oldest first within a priority,
+	// leaving out paused queues. limit is clamped
+	// to [1, MaxDueBatch], defaulting to MaxDueBatch when <= 0; a backlog
+	// larger than one batch is drained over successive calls rather than
+	// loaded at once.
 	GetDueTasks(start, end time.Time, limit int) ([]Task, error)
 	// ListTasks returns one page of Tasks matching filter, starting after
 	// cursor ("" = first page). limit is clamped to [1, MaxPageSize],
@@ -70,6 +160,42 @@ type Store interface {
 	// back to pending. Delivery is at-least-once.
 	RecoverRunning() error
 	// Counts tallies Tasks per status, and how many pending Tasks are already
-	// due as of now.
+	// due as of now, overall and per queue.
 	Counts(now time.Time) (Counts, error)
+	// ListSeries returns one page of the runs of a recurring series, in run
+	// order, paged like ListTasks. Runs purged by the history TTL are gone
+	// from it too.
+	ListSeries(seriesID, cursor string, limit int) ([]Task, string, error)
+	// CancelSeries cancels every unfinished run of a series as of at, and
+	// stops any further run from being saved into it. It reports how many
+	// runs it cancelled, or ErrNotFound if the series has none stored.
+	CancelSeries(seriesID string, at time.Time) (int, error)
+	// SetQueuePaused records whether queue is paused. A paused queue keeps
+	// accepting Tasks, but GetDueTasks leaves them out until it is resumed;
+	// the setting outlives a restart.
+	SetQueuePaused(queue string, paused bool) error
+	// PausedQueues lists every paused queue.
+	PausedQueues() ([]string, error)
+	// SetMaintenance records a pause of every delivery, or clears it when m
+	// is nil. Like a paused queue, it outlives a restart.
+	SetMaintenance(m *Maintenance) error
+	// Maintenance returns the recorded pause, or nil if there is none.
+	Maintenance() (*Maintenance, error)
+	// CreateSigningKey stores a new signing key, or fails with
+	// ErrSigningKeyExists if its id is taken.
+	CreateSigningKey(k SigningKey) error
+	// RotateSigningKey gives key id a new secret as of at, keeping the old
+	// one signing alongside it for overlap, and returns the key as written.
+	// ErrSigningKeyNotFound if there is no such key.
+	RotateSigningKey(id, secret string, at time.Time, overlap time.Duration) (*SigningKey, error)
+	// SigningKey returns key id, or nil if there is none.
+	SigningKey(id string) (*SigningKey, error)
+	// ListSigningKeys returns every signing key, sorted by id.
+	ListSigningKeys() ([]SigningKey, error)
+	// DeleteSigningKey removes key id, or fails with ErrSigningKeyNotFound.
+	DeleteSigningKey(id string) error
+	// OnPending registers fn to be called, after commit, with every Task a
+	// write leaves pending. One listener; fn must not block or call back into
+	// the Store.
+	OnPending(fn func(Task))
 }
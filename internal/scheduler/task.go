@@ -1,6 +1,49 @@
 package scheduler
 
-import "time"
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// DefaultQueue is the queue a Task belongs to when it doesn't name one.
+const DefaultQueue = "default"
+
+// maxQueueName bounds a queue name. It names a partition, not data.
+const maxQueueName = 64
+
+// ValidQueueName reports whether name can name a queue: 1-64 lowercase
+// letters, digits, '-' and '_', starting with a letter or digit. Queue names
+// are part of the storage key and of metric labels, so the charset keeps them
+// clear of both formats' separators and quoting.
+func ValidQueueName(name string) bool {
+	if name == "" || len(name) > maxQueueName {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case (c == '-' || c == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Priorities run from MinPriority to MaxPriority, higher first. A Task that
+// doesn't set one has MinPriority, so urgent work is marked up rather than
+// everything else marked down. The range is small and fixed because a
+// priority is part of the storage key and a metric label.
+const (
+	MinPriority = 0
+	MaxPriority = 9
+)
+
+// ValidPriority reports whether p is in [MinPriority, MaxPriority].
+func ValidPriority(p int) bool {
+	return p >= MinPriority && p <= MaxPriority
+}
 
 // MaxTimeoutMs caps a task's per-attempt delivery timeout at 5 minutes. An
 // unbounded timeout would let one slow endpoint pin a delivery goroutine
@@ -11,8 +54,8 @@ const MaxTimeoutMs = 300_000
 type TaskStatus string
 
 const (
-	StatusPending   TaskStatus = "pending"   // accepted, no attempt started yet
-	StatusRunning   TaskStatus = "running"   // at least one attempt fired, not terminal
+	StatusPending   TaskStatus = "pending"   // accepted, or waiting for its next retry
+	StatusRunning   TaskStatus = "running"   // an attempt is in flight
 	StatusSucceeded TaskStatus = "succeeded" // an attempt got a 2xx response
 	StatusFailed    TaskStatus = "failed"    // retries exhausted, last attempt non-2xx/error
 	StatusCancelled TaskStatus = "cancelled" // user deleted before terminal
@@ -78,16 +121,305 @@ type Task struct {
 	// TimeoutMs bounds a single delivery attempt, in milliseconds. 0 means the
 	// server default (10s). Capped at MaxTimeoutMs.
 	TimeoutMs int `json:"timeout_ms,omitempty"`
+	// PayloadTemplate, if set, has each attempt fill in the {{variable}}
+	// references in Payload's strings, the header values and the url's
+	// query: see DeliveryVars.
+	PayloadTemplate bool `json:"payload_template,omitempty"`
 	// OnFailureURL, if set, receives the best-effort failure callback for this
 	// task instead of the global SCHEDY_ON_FAILURE_URL.
 	OnFailureURL string `json:"on_failure_url,omitempty"`
+	// SigningKeyID, if set, names the SigningKey deliveries are signed with,
+	// instead of the global SCHEDY_SIGNING_SECRET.
+	SigningKeyID string `json:"signing_key_id,omitempty"`
+	// SigningScheme, if set, overrides SCHEDY_SIGNING_SCHEME for this task's
+	// deliveries.
+	SigningScheme SigningScheme `json:"signing_scheme,omitempty"`
 	// Schedule, if set, makes the task recurring: after each fire a fresh
-	// one-shot task is enqueued at fire_time + Schedule. Parsed by stdlib
-	// time.ParseDuration ("15m", "2h"). Deliberately NOT cron - no calendar,
-	// timezone, DST, or catch-up. Cancelling the pending task stops the chain.
-	Schedule string `json:"schedule,omitempty"`
+	// one-shot task is enqueued at the schedule's next time. ScheduleType says
+	// how it reads: an interval is a Go duration ("15m", "2h"); a calendar
+	// names wall-clock times in Timezone (an IANA zone, UTC if empty), so it
+	// keeps to the clock across DST. Deliberately not cron. What the chain
+	// does about runs missed while one was late is CatchUp's to say, and
+	// where it ends is MaxRuns', Until's, or a CancelSeries'.
+	Schedule     string       `json:"schedule,omitempty"`
+	ScheduleType ScheduleType `json:"schedule_type,omitempty"`
+	Timezone     string       `json:"timezone,omitempty"`
+	// CatchUp is what the chain does about runs missed while a run was late.
+	// Anchor is the series' phase, the time its first run was due: under
+	// skip and all an interval's runs fall on Anchor + k*Schedule. Nil
+	// anchors each run at its own ExecuteAt.
+	CatchUp CatchUp    `json:"catch_up,omitempty"`
+	Anchor  *time.Time `json:"anchor,omitempty"`
+	// Jitter, a Go duration ("5m"), spreads tasks scheduled for the same
+	// moment: ExecuteAt is the requested time plus an offset in [0, Jitter)
+	// drawn from the task's id - its series id, if recurring - so the offset
+	// is stable, and the same for every run of a series.
+	Jitter string `json:"jitter,omitempty"`
+	// OnSuccess, if set, is a follow-up enqueued when the task succeeds,
+	// Delay after the success. ChildID is the follow-up its latest success
+	// enqueued, and ParentID, on the follow-up, the task that enqueued it.
+	OnSuccess *TaskTemplate `json:"on_success,omitempty"`
+	ParentID  string        `json:"parent_id,omitempty"`
+	ChildID   string        `json:"child_id,omitempty"`
+	// MaxRuns and Until end a recurring task's chain: no run is enqueued past
+	// run MaxRuns, or due after Until. Zero / nil run until cancelled.
+	MaxRuns int        `json:"max_runs,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+	// SeriesID names the chain a recurring task belongs to - the id of its
+	// first run - and RunNumber is this run's place in it, from 1. Both are
+	// carried through every successor, so the chain can be listed and
+	// cancelled as a whole.
+	SeriesID  string `json:"series_id,omitempty"`
+	RunNumber int    `json:"run_number,omitempty"`
+	// Destination, if set, is the key SCHEDY_DESTINATION_LIMITS rules match
+	// this task against instead of its url's host, so tasks spread across
+	// hosts can share one limit, or tasks on one host can be split apart.
+	Destination string `json:"destination,omitempty"`
+	// Queue is the queue the task is delivered from (DefaultQueue if empty).
+	// A queue can be paused and resumed as a whole, and capped in how many of
+	// its deliveries run at once (SCHEDY_QUEUES).
+	Queue string `json:"queue,omitempty"`
+	// Priority orders due work: the runner takes the highest-priority due
+	// Tasks first, and the oldest first within a priority.
+	Priority int `json:"priority,omitempty"`
+	// ExpireAt and MaxLateness give the task a shelf life of its own, in place
+	// of SCHEDY_MAX_STALENESS: past the earlier of ExpireAt and ExecuteAt +
+	// MaxLateness it is retired rather than delivered, retries included.
+	// MaxLateness is a Go duration ("5m"), measured from ExecuteAt, so it
+	// carries over to each run of a recurring task.
+	ExpireAt    *time.Time `json:"expire_at,omitempty"`
+	MaxLateness string     `json:"max_lateness,omitempty"`
 
 	Status     TaskStatus `json:"status"`
 	Attempts   []Attempt  `json:"attempts,omitempty"`
 	FinishedAt *time.Time `json:"finished_at,omitempty"` // set when terminal
+	// NextAttemptAt is when a pending task fires its next retry. Set when a
+	// delivery fails with retries left, or is deferred by an open circuit
+	// breaker, and cleared when the task finishes; the wait happens in the
+	// store rather than in a goroutine.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// RetryCount is how many of Retries this run has used.
+	RetryCount int `json:"retry_count,omitempty"`
+	// RunStartedAt is when this run's first attempt fired. It is kept
+	// across the run's retries, and attempts cut off by shutdown, so a
+	// recurring successor is anchored to the run and not to its last
+	// attempt. Cleared when the task is re-armed for a new run.
+	RunStartedAt *time.Time `json:"run_started_at,omitempty"`
+	// Replays counts the times the task has been re-armed by a replay or a
+	// dead-letter redrive, so each re-armed run has a MessageID of its own.
+	Replays int `json:"replays,omitempty"`
+}
+
+// TaskSpec is how a task is delivered: the client-owned fields a create or
+// update request and an on_success template have in common. The request adds
+// when and how often it fires, the template a delay from its parent's success.
+type TaskSpec struct {
+	URL             string            `json:"url"`
+	Method          string            `json:"method"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Payload         any               `json:"payload,omitempty"`
+	PayloadTemplate bool              `json:"payload_template,omitempty"`
+	Retries         int               `json:"retries,omitempty"`
+	RetryInterval   *int              `json:"retry_interval"` // milliseconds
+	RetryMode       RetryMode         `json:"retry_mode"`
+	TimeoutMs       int               `json:"timeout_ms,omitempty"`
+	OnFailureURL    string            `json:"on_failure_url,omitempty"`
+	SigningKeyID    string            `json:"signing_key_id,omitempty"`
+	SigningScheme   SigningScheme     `json:"signing_scheme,omitempty"`
+	Destination     string            `json:"destination,omitempty"`
+	Queue           string            `json:"queue,omitempty"`
+	Priority        int               `json:"priority,omitempty"`
+	MaxLateness     string            `json:"max_lateness,omitempty"`
+	Jitter          string            `json:"jitter,omitempty"`
+	OnSuccess       *TaskTemplate     `json:"on_success,omitempty"`
+}
+
+// Apply sets t's fields from s, replacing what was there. A nil RetryInterval
+// leaves t's alone.
+func (s TaskSpec) Apply(t *Task) {
+	t.URL = s.URL
+	t.Method = s.Method
+	t.Headers = s.Headers
+	t.Payload = s.Payload
+	t.PayloadTemplate = s.PayloadTemplate
+	t.Retries = s.Retries
+	if s.RetryInterval != nil {
+		t.RetryInterval = *s.RetryInterval
+	}
+	t.RetryMode = s.RetryMode
+	t.TimeoutMs = s.TimeoutMs
+	t.OnFailureURL = s.OnFailureURL
+	t.SigningKeyID = s.SigningKeyID
+	t.SigningScheme = s.SigningScheme
+	t.Destination = s.Destination
+	t.Queue = s.Queue
+	t.Priority = s.Priority
+	t.MaxLateness = s.MaxLateness
+	t.Jitter = s.Jitter
+	t.OnSuccess = s.OnSuccess
+}
+
+// QueueName is the queue the task belongs to: Queue, or DefaultQueue for a task
+// stored before queues existed.
+func (t Task) QueueName() string {
+	if t.Queue == "" {
+		return DefaultQueue
+	}
+	return t.Queue
+}
+
+// Deadline is the last moment the task may still be delivered, from ExpireAt
+// and MaxLateness, whichever is earlier. ok is false when it has neither.
+func (t Task) Deadline() (deadline time.Time, ok bool) {
+	if t.ExpireAt != nil {
+		deadline, ok = *t.ExpireAt, true
+	}
+	if d, err := time.ParseDuration(t.MaxLateness); err == nil && d > 0 {
+		if byLateness := t.ExecuteAt.Add(d); !ok || byLateness.Before(deadline) {
+			deadline, ok = byLateness, true
+		}
+	}
+	return deadline, ok
+}
+
+// DueAt is when the task next fires: its scheduled retry if one is waiting,
+// otherwise ExecuteAt.
+func (t Task) DueAt() time.Time {
+	if t.NextAttemptAt != nil {
+		return *t.NextAttemptAt
+	}
+	return t.ExecuteAt
+}
+
+// MessageID identifies the message the current run delivers, for a receiver
+// to drop one it has already handled: the same on every retry of the run,
+// different for a replay or redrive. It is the task id, suffixed with the
+// replay count once there has been one. Each run of a series is a task of
+// its own, so it has its own id already.
+func (t Task) MessageID() string {
+	if t.Replays == 0 {
+		return t.ID
+	}
+	return t.ID + "_" + strconv.Itoa(t.Replays)
+}
+
+// JitterOffset is how far Jitter moves the task from its requested time.
+func (t Task) JitterOffset() time.Duration {
+	d, err := time.ParseDuration(t.Jitter)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	seed := t.SeriesID
+	if seed == "" {
+		seed = t.ID
+	}
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return time.Duration(h.Sum64() % uint64(d))
+}
+
+// ScheduledAt is the time the task was requested for: ExecuteAt without its
+// jitter.
+func (t Task) ScheduledAt() time.Time {
+	return t.ExecuteAt.Add(-t.JitterOffset())
+}
+
+// Recurrence parses the task's schedule. It is nil for a one-shot task. An
+// interval under CatchUpSkip or CatchUpAll is held to the series' phase; a
+// calendar keeps its own.
+func (t Task) Recurrence() (Recurrence, error) {
+	if t.Schedule == "" {
+		return nil, nil
+	}
+	rec, err := ParseSchedule(t.ScheduleType, t.Schedule, t.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := rec.(interval); ok && (t.CatchUp == CatchUpSkip || t.CatchUp == CatchUpAll) {
+		anchor := t.ScheduledAt()
+		if t.Anchor != nil {
+			anchor = *t.Anchor
+		}
+		return phased{every: time.Duration(d), anchor: anchor}, nil
+	}
+	return rec, nil
+}
+
+// NextRun returns when the run after t is due, t having fired at fireTime,
+// under t's catch-up policy. ok is false when the schedule has no further
+// run; MaxRuns and Until are the caller's to apply.
+//
+// The schedule is followed in requested times, with the jitter taken off and
+// put back on, so the offset never compounds from run to run.
+func (t Task) NextRun(fireTime time.Time) (next time.Time, ok bool, err error) {
+	rec, err := t.Recurrence()
+	if rec == nil || err != nil {
+		return time.Time{}, false, err
+	}
+	offset := t.JitterOffset()
+	scheduled := t.ExecuteAt.Add(-offset)
+	fireTime = fireTime.Add(-offset)
+	// The next run is strictly after the one t filled, even if the clock
+	// reads earlier.
+	if fireTime.Before(scheduled) {
+		fireTime = scheduled
+	}
+	if t.CatchUp != CatchUpAll {
+		next, ok = rec.Next(fireTime)
+		return next.Add(offset), ok, nil
+	}
+
+	// The run after t's own, however long ago: each missed run comes due in
+	// turn, as the run before it finishes.
+	next, ok = rec.Next(scheduled)
+	if !ok || next.After(fireTime) {
+		return next.Add(offset), ok, nil
+	}
+	if p, isPhased := rec.(phased); isPhased {
+		if missed := fireTime.Sub(next)/p.every + 1; missed > MaxCatchUpRuns {
+			next = next.Add((missed - MaxCatchUpRuns) * p.every)
+		}
+		return next.Add(offset), true, nil
+	}
+	// A calendar is walked, keeping the latest MaxCatchUpRuns missed, for at
+	// most MaxCatchUpWalk steps.
+	var missed []time.Time
+	steps := 0
+	for at := next; ok && !at.After(fireTime); at, ok = rec.Next(at) {
+		if steps++; steps > MaxCatchUpWalk {
+			next, ok = rec.Next(fireTime)
+			return next.Add(offset), ok, nil
+		}
+		missed = append(missed, at)
+		if len(missed) > MaxCatchUpRuns {
+			missed = missed[1:]
+		}
+	}
+	return missed[0].Add(offset), true, nil
+}
+
+// NextRuns projects up to n fire times of an unfinished recurring task: its
+// own, if it is still pending, then its successors', within MaxRuns and
+// Until. An interval's runs are projected from ExecuteAt as though each fired
+// on time; the chain itself measures from the actual fire.
+func (t Task) NextRuns(n int) []time.Time {
+	rec, err := t.Recurrence()
+	if rec == nil || err != nil || t.Status.IsTerminal() || n <= 0 {
+		return nil
+	}
+	var runs []time.Time
+	cur, run := t, max(t.RunNumber, 1)
+	if t.Status == StatusPending {
+		runs = append(runs, t.ExecuteAt)
+	}
+	for len(runs) < n {
+		next, ok, _ := cur.NextRun(cur.ExecuteAt)
+		run++
+		if !ok || (t.MaxRuns > 0 && run > t.MaxRuns) || (t.Until != nil && next.Add(-t.JitterOffset()).After(*t.Until)) {
+			break
+		}
+		runs = append(runs, next)
+		cur.ExecuteAt = next
+	}
+	return runs
 }
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadline(t *testing.T) {
+	at := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	expire := at.Add(time.Hour)
+
+	_, ok := Task{ExecuteAt: at}.Deadline()
+	assert.False(t, ok, "no shelf life, no deadline")
+
+	d, ok := Task{ExecuteAt: at, ExpireAt: &expire}.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, expire, d)
+
+	d, ok = Task{ExecuteAt: at, MaxLateness: "5m"}.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, at.Add(5*time.Minute), d)
+
+	d, _ = Task{ExecuteAt: at, ExpireAt: &expire, MaxLateness: "2h"}.Deadline()
+	assert.Equal(t, expire, d, "the earlier of the two wins")
+
+	retry := at.Add(30 * time.Minute)
+	d, _ = Task{ExecuteAt: at, NextAttemptAt: &retry, MaxLateness: "5m"}.Deadline()
+	assert.Equal(t, at.Add(5*time.Minute), d, "measured from execute_at, not the retry")
+}
+
+func TestNextRuns(t *testing.T) {
+	at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	daily := Task{ExecuteAt: at, Schedule: "at=09:00", ScheduleType: ScheduleCalendar, Status: StatusPending, RunNumber: 1}
+
+	assert.Equal(t, []time.Time{at, at.AddDate(0, 0, 1), at.AddDate(0, 0, 2)}, daily.NextRuns(3))
+
+	running := daily
+	running.Status = StatusRunning
+	assert.Equal(t, []time.Time{at.AddDate(0, 0, 1)}, running.NextRuns(1), "a running task's own fire is under way")
+
+	bounded := daily
+	bounded.RunNumber, bounded.MaxRuns = 2, 3
+	assert.Len(t, bounded.NextRuns(5), 2, "runs 2 and 3")
+	until := at.AddDate(0, 0, 3)
+	bounded = daily
+	bounded.Until = &until
+	assert.Len(t, bounded.NextRuns(10), 4)
+
+	interval := Task{ExecuteAt: at, Schedule: "6h", Status: StatusPending}
+	assert.Equal(t, []time.Time{at, at.Add(6 * time.Hour)}, interval.NextRuns(2))
+
+	done := daily
+	done.Status = StatusSucceeded
+	assert.Empty(t, done.NextRuns(3), "a finished run's successor is its own task")
+	assert.Empty(t, Task{ExecuteAt: at, Status: StatusPending}.NextRuns(3), "one-shot")
+}
+
+func TestNextRun(t *testing.T) {
+	anchor := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	// An hourly run due at 01:00 fires 6h30m late, at 07:30, after downtime.
+	hourly := func(policy CatchUp) Task {
+		return Task{ExecuteAt: anchor.Add(time.Hour), Anchor: &anchor, Schedule: "1h", CatchUp: policy}
+	}
+	fired := anchor.Add(7*time.Hour + 30*time.Minute)
+	next := func(task Task, fireTime time.Time) time.Time {
+		t.Helper()
+		at, ok, err := task.NextRun(fireTime)
+		require.NoError(t, err)
+		require.True(t, ok)
+		return at
+	}
+
+	assert.Equal(t, fired.Add(time.Hour), next(hourly(""), fired), "once: an hour on from the late fire")
+	assert.Equal(t, fired.Add(time.Hour), next(hourly(CatchUpOnce), fired))
+	assert.Equal(t, anchor.Add(8*time.Hour), next(hourly(CatchUpSkip), fired), "skip: back in phase, the missed runs dropped")
+	assert.Equal(t, anchor.Add(2*time.Hour), next(hourly(CatchUpAll), fired), "all: the first missed run")
+
+	t.Run("in phase when on time", func(t *testing.T) {
+		onTime := anchor.Add(time.Hour + 40*time.Millisecond)
+		assert.Equal(t, anchor.Add(2*time.Hour), next(hourly(CatchUpSkip), onTime))
+		assert.Equal(t, anchor.Add(2*time.Hour), next(hourly(CatchUpAll), onTime))
+		assert.Equal(t, onTime.Add(time.Hour), next(hourly(CatchUpOnce), onTime), "once drifts by the delay")
+	})
+
+	t.Run("all is bounded", func(t *testing.T) {
+		late := anchor.Add(time.Duration(MaxCatchUpRuns+50) * time.Hour)
+		assert.Equal(t, late.Add(-(MaxCatchUpRuns-1)*time.Hour), next(hourly(CatchUpAll), late),
+			"only the latest MaxCatchUpRuns missed runs are delivered")
+
+		daily := Task{ExecuteAt: anchor.Add(9 * time.Hour), Schedule: "at=09:00", ScheduleType: ScheduleCalendar, CatchUp: CatchUpAll}
+		late = anchor.AddDate(0, 0, MaxCatchUpRuns+10).Add(10 * time.Hour)
+		assert.Equal(t, anchor.AddDate(0, 0, 11).Add(9*time.Hour), next(daily, late))
+	})
+
+	t.Run("a months-long outage", func(t *testing.T) {
+		late := anchor.AddDate(0, 6, 0).Add(10 * time.Hour)
+
+		daily := Task{ExecuteAt: anchor.Add(9 * time.Hour), Schedule: "at=09:00", ScheduleType: ScheduleCalendar, CatchUp: CatchUpAll}
+		assert.Equal(t, anchor.AddDate(0, 6, -(MaxCatchUpRuns-1)).Add(9*time.Hour), next(daily, late),
+			"the latest MaxCatchUpRuns of half a year's runs")
+
+		// Every quarter hour: some 17,000 runs missed, past MaxCatchUpWalk.
+		var at []string
+		for m := 0; m < 24*60; m += 15 {
+			at = append(at, fmt.Sprintf("%02d:%02d", m/60, m%60))
+		}
+		dense := Task{ExecuteAt: anchor, Schedule: "at=" + strings.Join(at, ","), ScheduleType: ScheduleCalendar, CatchUp: CatchUpAll}
+		assert.Equal(t, late.Add(15*time.Minute), next(dense, late), "too many to walk: caught up as skip")
+	})
+
+	t.Run("a calendar keeps its own phase", func(t *testing.T) {
+		daily := Task{ExecuteAt: anchor.Add(9 * time.Hour), Schedule: "at=09:00", ScheduleType: ScheduleCalendar}
+		late := anchor.AddDate(0, 0, 3).Add(10 * time.Hour)
+		assert.Equal(t, anchor.AddDate(0, 0, 4).Add(9*time.Hour), next(daily, late))
+		daily.CatchUp = CatchUpAll
+		assert.Equal(t, anchor.AddDate(0, 0, 1).Add(9*time.Hour), next(daily, late))
+	})
+
+	t.Run("without an anchor the run's own time is the phase", func(t *testing.T) {
+		task := hourly(CatchUpSkip)
+		task.Anchor = nil
+		task.ExecuteAt = anchor.Add(time.Hour + 15*time.Minute)
+		assert.Equal(t, anchor.Add(8*time.Hour+15*time.Minute), next(task, fired))
+	})
+}
+
+func TestJitter(t *testing.T) {
+	at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	offsets := map[time.Duration]bool{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		task := Task{ID: id, Jitter: "10m"}
+		off := task.JitterOffset()
+		assert.GreaterOrEqual(t, off, time.Duration(0))
+		assert.Less(t, off, 10*time.Minute)
+		assert.Equal(t, off, task.JitterOffset(), "the same task, the same offset")
+		offsets[off] = true
+
+		task.ExecuteAt = at.Add(off)
+		assert.Equal(t, at, task.ScheduledAt())
+	}
+	assert.Greater(t, len(offsets), 1, "different tasks spread out")
+
+	assert.Zero(t, Task{ID: "a"}.JitterOffset())
+	assert.Equal(t, Task{ID: "run7", SeriesID: "a", Jitter: "10m"}.JitterOffset(), Task{ID: "a", Jitter: "10m"}.JitterOffset(),
+		"every run of a series has the first run's offset")
+
+	t.Run("a recurring task's offset doesn't compound", func(t *testing.T) {
+		for _, policy := range []CatchUp{CatchUpOnce, CatchUpSkip, CatchUpAll} {
+			task := Task{ID: "a", SeriesID: "a", Schedule: "1h", CatchUp: policy, Jitter: "10m", Anchor: &at}
+			task.ExecuteAt = at.Add(task.JitterOffset())
+			next, ok, err := task.NextRun(task.ExecuteAt)
+			require.NoError(t, err)
+			require.True(t, ok)
+			assert.Equal(t, task.ExecuteAt.Add(time.Hour), next, policy)
+		}
+
+		daily := Task{ID: "a", Schedule: "at=09:00,09:05", ScheduleType: ScheduleCalendar, Jitter: "1h"}
+		daily.ExecuteAt = at.Add(daily.JitterOffset())
+		next, _, _ := daily.NextRun(daily.ExecuteAt)
+		assert.Equal(t, at.Add(5*time.Minute+daily.JitterOffset()), next, "a wide jitter doesn't skip a calendar time")
+		assert.Equal(t, []time.Time{daily.ExecuteAt, next}, Task{ID: "a", Schedule: daily.Schedule, ScheduleType: ScheduleCalendar,
+			Jitter: "1h", ExecuteAt: daily.ExecuteAt, Status: StatusPending}.NextRuns(2))
+	})
+}